@@ -0,0 +1,110 @@
+// backup exports an organization to an archive, or imports such an archive.
+//
+//	backup export -group acme -o acme.zip
+//	backup import -i acme.zip [-group other]
+//
+// The import refuses a group holding data. Without -group, the archive is restored under the
+// group it was exported from.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/migrations"
+	"github.com/nbittich/wtm/services/superadmin"
+	"github.com/nbittich/wtm/types"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	client, err := db.Connect(context.Background(), db.ConfigFromEnv())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	superadmin.Init(client)
+	migrations.Init(client)
+	switch os.Args[1] {
+	case "export":
+		flags := flag.NewFlagSet("export", flag.ExitOnError)
+		group := flags.String("group", "", "group of the organization to export")
+		output := flags.String("o", "", "archive to write")
+		flags.Parse(os.Args[2:])
+		if *group == "" || *output == "" {
+			usage()
+		}
+		err = export(types.Group(*group), *output)
+	case "import":
+		flags := flag.NewFlagSet("import", flag.ExitOnError)
+		input := flags.String("i", "", "archive to read")
+		group := flags.String("group", "", "group to import into, the exported one when empty")
+		flags.Parse(os.Args[2:])
+		if *input == "" {
+			usage()
+		}
+		err = restore(*input, types.Group(*group))
+	default:
+		usage()
+	}
+	disconnect(client)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func disconnect(client *db.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.MongoCtxTimeout)
+	defer cancel()
+	if err := client.Disconnect(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: backup export -group <group> -o <archive> | backup import -i <archive> [-group <group>]")
+	os.Exit(2)
+}
+
+func export(group types.Group, output string) error {
+	ctx := context.Background()
+	org, err := superadmin.GetOrgByGroup(ctx, group)
+	if err != nil {
+		return fmt.Errorf("organization %s not found: %w", group, err)
+	}
+	file, err := os.OpenFile(output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err = superadmin.ExportOrg(ctx, org.ID, file); err != nil {
+		file.Close()
+		os.Remove(output)
+		return err
+	}
+	return file.Close()
+}
+
+func restore(input string, group types.Group) error {
+	file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	org, err := superadmin.ImportOrg(context.Background(), file, info.Size(), group)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported organization %s into group %s\n", org.ID, org.Group)
+	return nil
+}
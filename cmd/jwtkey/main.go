@@ -0,0 +1,54 @@
+// jwtkey generates a new signing key for the access tokens.
+//
+// Rotation: generate a key in JWT_KEYS_DIRECTORY and restart every instance, the newest key signs
+// from then on (unless JWT_ACTIVE_KID pins one). Keep the previous key file until the tokens it
+// signed expired, i.e. JWT_EXPIRES_AFTER_MINUTES, then delete it and restart again.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nbittich/wtm/services/jwks"
+)
+
+func main() {
+	dir := flag.String("dir", os.Getenv("JWT_KEYS_DIRECTORY"), "directory of the signing keys")
+	alg := flag.String("alg", jwks.EdDSA, "algorithm of the key, RS256 or EdDSA")
+	flag.Parse()
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "missing -dir or JWT_KEYS_DIRECTORY")
+		os.Exit(1)
+	}
+	if err := generate(*dir, *alg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func generate(dir string, alg string) error {
+	signer, err := jwks.GenerateKey(alg)
+	if err != nil {
+		return err
+	}
+	content, err := jwks.EncodePEM(signer)
+	if err != nil {
+		return err
+	}
+	kid, err := jwks.NewKeyID(time.Now())
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	file := filepath.Join(dir, kid+".pem")
+	if err = os.WriteFile(file, content, 0o600); err != nil {
+		return err
+	}
+	fmt.Println(kid)
+	return nil
+}
@@ -0,0 +1,45 @@
+// migrate applies the pending schema migrations to the admin database and every group database,
+// as the server does at startup unless MIGRATE_ON_STARTUP is false.
+//
+//	migrate [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/migrations"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report the pending migrations without applying them")
+	flag.Parse()
+	client, err := db.Connect(context.Background(), db.ConfigFromEnv())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	migrations.Init(client)
+	ctx, cancel := context.WithTimeout(context.Background(), config.MigrationLockTTL)
+	reports, err := migrations.Run(ctx, *dryRun)
+	cancel()
+	disconnectCtx, cancel := context.WithTimeout(context.Background(), config.MongoCtxTimeout)
+	if disconnectErr := client.Disconnect(disconnectCtx); disconnectErr != nil {
+		fmt.Fprintln(os.Stderr, disconnectErr)
+	}
+	cancel()
+	for _, report := range reports {
+		fmt.Printf("%s\t%d\t%s\t%s\n", report.Database, report.Version, report.Name, report.Message)
+	}
+	if len(reports) == 0 && err == nil {
+		fmt.Println("up to date")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"os"
@@ -16,8 +17,12 @@ import (
 	superadminHandlers "github.com/nbittich/wtm/handlers/superadmin"
 	userHandlers "github.com/nbittich/wtm/handlers/user"
 	appMidleware "github.com/nbittich/wtm/middleware"
+	"github.com/nbittich/wtm/services"
 	"github.com/nbittich/wtm/services/db"
 	"github.com/nbittich/wtm/services/email"
+	"github.com/nbittich/wtm/services/migrations"
+	"github.com/nbittich/wtm/services/project"
+	"github.com/nbittich/wtm/services/superadmin"
 	"github.com/nbittich/wtm/types"
 )
 
@@ -32,10 +37,55 @@ func main() {
 	fmt.Println("will use tz", loc)
 	time.Local = loc
 
-	defer db.Disconnect()
+	if err := services.LoadKeySet(); err != nil {
+		panic(err)
+	}
+
+	// retried with back-off, mongo may still be starting next to us
+	client, err := db.Connect(context.Background(), db.ConfigFromEnv())
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), config.MongoCtxTimeout)
+		defer cancel()
+		if err := client.Disconnect(ctx); err != nil {
+			fmt.Println("could not disconnect from mongo:", err)
+		}
+	}()
+	services.Init(client)
+	project.Init(client)
+	superadmin.Init(client)
+	migrations.Init(client)
 	defer close(email.MailChan)
 
+	if config.MigrateOnStartup {
+		ctx, cancel := context.WithTimeout(context.Background(), config.MigrationLockTTL)
+		reports, err := migrations.Run(ctx, false)
+		cancel()
+		for _, report := range reports {
+			fmt.Printf("migration %d %s %s on %s\n", report.Version, report.Name, report.Message, report.Database)
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// indexes are declared by the services owning the collections
+	indexCtx, cancelIndex := context.WithTimeout(context.Background(), config.MongoCtxTimeout)
+	drift, err := client.EnsureAllIndexes(indexCtx)
+	cancelIndex()
+	for _, d := range drift {
+		fmt.Println("index drift:", d)
+	}
+	if err != nil {
+		fmt.Println("could not ensure indexes:", err)
+	}
+
 	e := echo.New()
+	if e.IPExtractor, err = appMidleware.IPExtractor(config.TrustedProxies); err != nil {
+		panic(err)
+	}
 
 	// static assets
 	e.Static("/assets", "assets")
@@ -71,7 +121,7 @@ func main() {
 	// JWT
 
 	e.Use(echojwt.WithConfig(echojwt.Config{
-		SigningKey: config.JWTSecretKey,
+		KeyFunc: services.JWTKeyfunc,
 		// TokenLookup:            fmt.Sprintf("header:Authorization:Bearer ,cookie:%s", config.JWTCookie),
 		TokenLookupFuncs:       []middleware.ValuesExtractor{appMidleware.JWTTokenExtractor},
 		ContinueOnIgnoredError: true,
@@ -101,6 +151,32 @@ func main() {
 		}
 	}()
 
+	// drop the databases of the organizations deleted for longer than the grace period
+	go func() {
+		for ; ; time.Sleep(time.Hour) {
+			ctx, cancel := context.WithTimeout(context.Background(), config.MongoCtxTimeout)
+			purged, err := superadmin.PurgeDeletedOrgs(ctx, time.Now())
+			cancel()
+			if err != nil {
+				e.Logger.Error("could not purge deleted organizations: ", err)
+			}
+			for _, group := range purged {
+				e.Logger.Info("purged organization ", group)
+			}
+
+			// and the projects and planning entries deleted for longer than the retention period
+			ctx, cancel = context.WithTimeout(context.Background(), config.MongoCtxTimeout)
+			documents, err := project.PurgeAllDeleted(ctx, time.Now())
+			cancel()
+			if err != nil {
+				e.Logger.Error("could not purge deleted projects and planning entries: ", err)
+			}
+			if documents > 0 {
+				e.Logger.Info("purged ", documents, " deleted projects and planning entries")
+			}
+		}
+	}()
+
 	fmt.Println()
 
 	fmt.Println(BANNER)
@@ -109,6 +185,8 @@ func main() {
 	handlers.HomeRouter(e)
 	adminHandlers.AdminUserRouter(e)
 	adminHandlers.AdminProjectRouter(e)
+	adminHandlers.AdminPayrollRouter(e)
+	adminHandlers.AdminReportRouter(e)
 	userHandlers.UserPlanningRoute(e)
 	superadminHandlers.SuperAdminRouter(e)
 	e.Logger.Fatal(e.Start(fmt.Sprintf("%s:%s", config.Host, config.Port)))
@@ -12,33 +12,56 @@ import (
 )
 
 var (
-	TZ                       = loadEnvOrDefault("TZ", "Europe/Brussels")
-	Host                     = loadEnvOrDefault("HOST", "0.0.0.0")
-	HostName                 = loadEnvOrDefault("HOSTNAME", "localhost")
-	Port                     = loadEnvOrDefault("PORT", "8080")
-	BaseURL                  = loadEnvOrDefault("BASE_URL", fmt.Sprintf("http://%s:%s", HostName, Port))
-	GoEnv                    = env(loadEnvOrDefault("GO_ENV", "development"))
-	LogLevel                 = logLevel(loadEnvOrDefault("LOG_LEVEL", "INFO"))
-	SMTPHost                 = loadEnvOrDefault("SMTP_HOST", "localhost")
-	SMTPPort                 = loadIntEnvOrDefault("SMTP_PORT", 1025)
-	SMTPFrom                 = loadEnvOrDefault("SMTP_FROM", "test@localhost")
-	SMTPPassword             = loadEnvOrDefault("SMTP_PASSWORD", "")
-	SMTPSSL                  = loadBoolOrDefault("SMTP_SSL", false)
-	MongoHost                = loadEnvOrDefault("MONGO_HOST", "localhost")
-	MongoPort                = loadEnvOrDefault("MONGO_PORT", "27017")
-	MongoUser                = loadEnvOrDefault("MONGO_USER", "root")
-	MongoMigrationCollection = loadEnvOrDefault("MONGO_MIGRATION_COLLECTION", "_migration")
-	MongoPassword            = loadEnvOrDefault("MONGO_PASSWORD", "root")
-	MongoAdminDBName         = loadEnvOrDefault("MONGO_ADMIN_DB_NAME", "wtm")
-	MongoCtxTimeout          = time.Duration(loadIntEnvOrDefault("MONGO_CONTEXT_TIMEOUT_SECONDS", 60)) * time.Second
-	MongoMaxConnectionPool   = loadIntEnvOrDefault("MONGO_MAX_CONNECTION_POOL", 200)
-	ActivationExpiration     = time.Duration(loadIntEnvOrDefault("ACTIVATION_EXPIRATION", 20)) * time.Minute
-	JWTSecretKey             = []byte(loadEnvOrDefault("JWT_SECRET_KEY", "secret"))
-	JWTExpiresAFterMinutes   = time.Duration(loadIntEnvOrDefault("JWT_EXPIRES_AFTER_MINUTES", 240)) * time.Minute
-	JWTIssuer                = loadEnvOrDefault("JWT_ISSUER", "WorkingTimeManagement")
-	DefaultBCryptCost        = loadIntEnvOrDefault("DEFAULT_BCRYPT_COST", 10)
-	TempDir                  = loadEnvOrDefault("TMP_DIRECTORY", os.TempDir())
-	StaticDirectory          = loadEnvOrDefault("STATIC_DIRECTORY", fmt.Sprint(os.TempDir(), "/wtm/static"))
+	TZ                        = loadEnvOrDefault("TZ", "Europe/Brussels")
+	Host                      = loadEnvOrDefault("HOST", "0.0.0.0")
+	HostName                  = loadEnvOrDefault("HOSTNAME", "localhost")
+	Port                      = loadEnvOrDefault("PORT", "8080")
+	BaseURL                   = loadEnvOrDefault("BASE_URL", fmt.Sprintf("http://%s:%s", HostName, Port))
+	GoEnv                     = env(loadEnvOrDefault("GO_ENV", "development"))
+	LogLevel                  = logLevel(loadEnvOrDefault("LOG_LEVEL", "INFO"))
+	SMTPHost                  = loadEnvOrDefault("SMTP_HOST", "localhost")
+	SMTPPort                  = loadIntEnvOrDefault("SMTP_PORT", 1025)
+	SMTPFrom                  = loadEnvOrDefault("SMTP_FROM", "test@localhost")
+	SMTPPassword              = loadEnvOrDefault("SMTP_PASSWORD", "")
+	SMTPSSL                   = loadBoolOrDefault("SMTP_SSL", false)
+	MongoHost                 = loadEnvOrDefault("MONGO_HOST", "localhost")
+	MongoPort                 = loadEnvOrDefault("MONGO_PORT", "27017")
+	MongoUser                 = loadEnvOrDefault("MONGO_USER", "root")
+	MongoMigrationCollection  = loadEnvOrDefault("MONGO_MIGRATION_COLLECTION", "_migration")
+	MigrateOnStartup          = loadBoolOrDefault("MIGRATE_ON_STARTUP", true)
+	MigrationLockTTL          = time.Duration(loadIntEnvOrDefault("MIGRATION_LOCK_TTL_MINUTES", 15)) * time.Minute
+	MongoPassword             = loadEnvOrDefault("MONGO_PASSWORD", "root")
+	MongoAdminDBName          = loadEnvOrDefault("MONGO_ADMIN_DB_NAME", "wtm")
+	MongoCtxTimeout           = time.Duration(loadIntEnvOrDefault("MONGO_CONTEXT_TIMEOUT_SECONDS", 60)) * time.Second
+	BackupCtxTimeout          = time.Duration(loadIntEnvOrDefault("BACKUP_CONTEXT_TIMEOUT_MINUTES", 60)) * time.Minute // export and import of an organization over http
+	MongoMaxConnectionPool    = loadIntEnvOrDefault("MONGO_MAX_CONNECTION_POOL", 200)
+	MongoConnectTimeout       = time.Duration(loadIntEnvOrDefault("MONGO_CONNECT_TIMEOUT_SECONDS", 10)) * time.Second
+	MongoConnectAttempts      = loadIntEnvOrDefault("MONGO_CONNECT_ATTEMPTS", 10)
+	MongoConnectMaxBackoff    = time.Duration(loadIntEnvOrDefault("MONGO_CONNECT_MAX_BACKOFF_SECONDS", 30)) * time.Second
+	MongoGroupRefresh         = time.Duration(loadIntEnvOrDefault("MONGO_GROUP_REFRESH_SECONDS", 5)) * time.Second
+	ActivationExpiration      = time.Duration(loadIntEnvOrDefault("ACTIVATION_EXPIRATION", 20)) * time.Minute
+	PasswordResetExpiration   = time.Duration(loadIntEnvOrDefault("PASSWORD_RESET_EXPIRATION", 30)) * time.Minute
+	PasswordResetMaxPerHour   = loadIntEnvOrDefault("PASSWORD_RESET_MAX_PER_HOUR", 3)
+	PasswordResetMaxPerHourIP = loadIntEnvOrDefault("PASSWORD_RESET_MAX_PER_HOUR_PER_IP", 10)
+	InvitationExpiration      = time.Duration(loadIntEnvOrDefault("INVITATION_EXPIRATION_HOURS", 72)) * time.Hour
+	OrgStatusCacheTTL         = time.Duration(loadIntEnvOrDefault("ORGANIZATION_STATUS_CACHE_SECONDS", 10)) * time.Second
+	OrganizationDeletionGrace = time.Duration(loadIntEnvOrDefault("ORGANIZATION_DELETION_GRACE_DAYS", 30)) * 24 * time.Hour
+	DeletedRetention          = time.Duration(loadIntEnvOrDefault("DELETED_RETENTION_DAYS", 30)) * 24 * time.Hour
+	JWTKeysDirectory          = loadEnvOrDefault("JWT_KEYS_DIRECTORY", "") // <kid>.pem files, see cmd/jwtkey. Required outside development
+	JWTActiveKeyID            = loadEnvOrDefault("JWT_ACTIVE_KID", "")     // newest key when empty
+	JWTExpiresAFterMinutes    = time.Duration(loadIntEnvOrDefault("JWT_EXPIRES_AFTER_MINUTES", 15)) * time.Minute
+	RefreshTokenExpiresAfter  = time.Duration(loadIntEnvOrDefault("REFRESH_TOKEN_EXPIRES_AFTER_HOURS", 24*14)) * time.Hour
+	JWTIssuer                 = loadEnvOrDefault("JWT_ISSUER", "WorkingTimeManagement")
+	DefaultBCryptCost         = loadIntEnvOrDefault("DEFAULT_BCRYPT_COST", 10)
+	TempDir                   = loadEnvOrDefault("TMP_DIRECTORY", os.TempDir())
+	StaticDirectory           = loadEnvOrDefault("STATIC_DIRECTORY", fmt.Sprint(os.TempDir(), "/wtm/static"))
+	FairnessLookbackWeeks     = loadIntEnvOrDefault("FAIRNESS_LOOKBACK_WEEKS", 12)
+	LoginFreeAttempts         = loadIntEnvOrDefault("LOGIN_FREE_ATTEMPTS", 3)
+	LoginLockAfter            = loadIntEnvOrDefault("LOGIN_LOCK_AFTER", 10)
+	LoginLockDuration         = time.Duration(loadIntEnvOrDefault("LOGIN_LOCK_DURATION_MINUTES", 30)) * time.Minute
+	LoginIPMaxFailures        = loadIntEnvOrDefault("LOGIN_IP_MAX_FAILURES", 50)
+	LoginRateLimit            = loadIntEnvOrDefault("LOGIN_RATE_LIMIT_PER_MINUTE", 20)
+	TrustedProxies            = loadEnvOrDefault("TRUSTED_PROXIES", "") // comma separated cidr of the reverse proxies setting X-Forwarded-For. None when empty
 	// JWTCookie             = loadEnvOrDefault("JWT_COOKIE", "jwt")
 )
 
@@ -0,0 +1,122 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services"
+	projectService "github.com/nbittich/wtm/services/project"
+	"github.com/nbittich/wtm/services/repository"
+	"github.com/nbittich/wtm/services/utils"
+)
+
+// deletionError maps the errors of the deletion and restoration to their status.
+func deletionError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, repository.ErrConflict), errors.Is(err, projectService.ErrDeleted), errors.Is(err, projectService.ErrNotDeleted):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, projectService.ErrRetentionExpired):
+		return echo.NewHTTPError(http.StatusGone, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func getDeletedPlanning(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	entries, err := projectService.GetDeletedPlanning(ctx, c.Param("id"), adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+func deletePlanningEntry(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	entry, err := projectService.DeletePlanningEntry(ctx, c.Param("id"), c.Param("entryId"), adminUser.Group)
+	if err != nil {
+		return deletionError(err)
+	}
+	return c.JSON(http.StatusOK, entry)
+}
+
+// deletePlanningRange deletes the entries starting between the from and to query params, both
+// included.
+func deletePlanningRange(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	from, to, err := utils.ParsePeriod(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	entries, err := projectService.DeletePlanningRange(ctx, c.Param("id"), from, to, adminUser.Group)
+	if err != nil {
+		c.Logger().Error("deleted ", len(entries), " entries before failing: ", err)
+		return deletionError(err)
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+func restorePlanningEntry(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	entry, err := projectService.RestorePlanningEntry(ctx, c.Param("id"), c.Param("entryId"), adminUser.Group)
+	if err != nil {
+		return deletionError(err)
+	}
+	utils.SetETag(c, entry.Version)
+	return c.JSON(http.StatusOK, entry)
+}
+
+func deleteProject(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	project, err := projectService.DeleteProject(ctx, c.Param("id"), adminUser.Group)
+	if err != nil {
+		return deletionError(err)
+	}
+	return c.JSON(http.StatusOK, project)
+}
+
+func restoreProject(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	project, err := projectService.RestoreProject(ctx, c.Param("id"), adminUser.Group)
+	if err != nil {
+		return deletionError(err)
+	}
+	utils.SetETag(c, project.Version)
+	return c.JSON(http.StatusOK, project)
+}
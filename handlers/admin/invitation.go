@@ -0,0 +1,82 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/services/utils"
+	"github.com/nbittich/wtm/types"
+)
+
+func inviteUserHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	form := types.InvitationForm{}
+	if err := c.Bind(&form); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	invitation, err := services.InviteUser(ctx, &form, adminUser.Group, adminUser.ID)
+	if err != nil {
+		if err, ok := err.(types.InvalidFormError); ok {
+			if msg, ok := err.Messages["general"].(string); ok {
+				err.Messages["general"] = utils.Translate(c.Request().Context(), msg)
+			}
+			return c.JSON(http.StatusBadRequest, err)
+		}
+		c.Logger().Error("could not invite user: ", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "unexpected error while inviting user")
+	}
+	return c.JSON(http.StatusCreated, invitation)
+}
+
+func listInvitationsHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	invitations, err := services.FindPendingInvitations(ctx, adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, invitations)
+}
+
+func resendInvitationHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	invitation, err := services.ResendInvitation(ctx, c.Param("id"), adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, invitation)
+}
+
+func deleteInvitationHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	if err = services.DeleteInvitation(ctx, c.Param("id"), adminUser.Group); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, types.Message{
+		Type:    types.SUCCESS,
+		Message: "invitation deleted",
+	})
+}
@@ -0,0 +1,111 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/services/payroll"
+	projectService "github.com/nbittich/wtm/services/project"
+	"github.com/nbittich/wtm/services/utils"
+	"github.com/nbittich/wtm/types"
+)
+
+func AdminPayrollRouter(e *echo.Echo) {
+	payrollGroup := e.Group("/admin/payroll")
+	payrollGroup.GET("/rules", getPayrollRules).Name = "admin.payroll.GetRules"
+	payrollGroup.POST("/rules", upsertPayrollRules).Name = "admin.payroll.UpsertRules"
+	payrollGroup.GET("/report", getPayrollReport).Name = "admin.payroll.Report"
+	payrollGroup.GET("/export", exportPayrollReport).Name = "admin.payroll.Export"
+}
+
+func getPayrollRules(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	rules, err := projectService.GetPayrollRules(ctx, adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, rules)
+}
+
+func upsertPayrollRules(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	rules := types.PayrollRules{}
+	if err = c.Bind(&rules); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	saved, err := projectService.SavePayrollRules(ctx, rules, adminUser.Group)
+	if err != nil {
+		if err, ok := err.(types.InvalidFormError); ok {
+			err.Form = rules
+			return c.JSON(http.StatusBadRequest, err)
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, saved)
+}
+
+func getPayrollReport(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	from, to, err := utils.ParsePeriod(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	report, err := projectService.GetPayrollReport(ctx, from, to, adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+func exportPayrollReport(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	from, to, err := utils.ParsePeriod(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "csv"
+	}
+	formatter, err := payroll.GetFormatter(format)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	report, err := projectService.GetPayrollReport(ctx, from, to, adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	var buf bytes.Buffer
+	if err = formatter.Format(&buf, report); err != nil {
+		c.Logger().Error("could not format payroll report:", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "could not format payroll report")
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="payroll-%s-%s.%s"`, from.Format("20060102"), to.AddDate(0, 0, -1).Format("20060102"), formatter.FileExtension()))
+	return c.Blob(http.StatusOK, formatter.ContentType(), buf.Bytes())
+}
@@ -1,25 +1,42 @@
 package admin
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/nbittich/wtm/config"
 	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/services/pdf"
 	projectService "github.com/nbittich/wtm/services/project"
+	"github.com/nbittich/wtm/services/repository"
+	"github.com/nbittich/wtm/services/superadmin"
+	"github.com/nbittich/wtm/services/utils"
 	"github.com/nbittich/wtm/types"
 )
 
 func AdminProjectRouter(e *echo.Echo) {
 	projectsGroup := e.Group("/admin/projects")
+	projectsGroup.GET("/planning/roster", getPlanningRoster).Name = "admin.planning.GetRoster"
+	projectsGroup.GET("/:id/planning/roster", getPlanningRoster).Name = "admin.planning.GetProjectRoster"
 	projectsGroup.POST("/:id/planning/cycle", upsertPlanningCycle).Name = "admin.planning.UpsertPlanningCycle"
 	projectsGroup.POST("/:id/planning/cycle/validate", validatePlanningCycle).Name = "admin.planning.ValidatePlanningCycle"
 	projectsGroup.POST("/:id/planning/validate", validatePlanningEntry).Name = "admin.planning.Validate"
 	projectsGroup.POST("/:id/planning", upsertPlanningEntry).Name = "admin.planning.UpsertPlanning"
 	projectsGroup.GET("/:id/planning", getPlanning).Name = "admin.planning.Get"
+	projectsGroup.DELETE("/:id/planning", deletePlanningRange).Name = "admin.planning.DeleteRange"
+	projectsGroup.GET("/:id/planning/deleted", getDeletedPlanning).Name = "admin.planning.GetDeleted"
+	projectsGroup.GET("/:id/planning/:entryId", getPlanningEntry).Name = "admin.planning.GetEntry"
+	projectsGroup.DELETE("/:id/planning/:entryId", deletePlanningEntry).Name = "admin.planning.DeleteEntry"
+	projectsGroup.POST("/:id/planning/:entryId/restore", restorePlanningEntry).Name = "admin.planning.RestoreEntry"
 	projectsGroup.GET("/:id", getProject).Name = "admin.project.Get"
+	projectsGroup.DELETE("/:id", deleteProject).Name = "admin.project.Delete"
+	projectsGroup.POST("/:id/restore", restoreProject).Name = "admin.project.Restore"
 	projectsGroup.POST("", upsertProject).Name = "admin.planning.UpsertProject"
 	projectsGroup.GET("", listProjects).Name = "admin.project.ListProject"
 }
@@ -95,13 +112,31 @@ func upsertPlanningEntry(c echo.Context) error {
 	if err = c.Bind(&planningEntry); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
+	version, ifMatch, err := utils.IfMatch(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if ifMatch {
+		planningEntry.Version = version
+	}
 
 	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
 	defer cancel()
 	entry, err := projectService.AddOrUpdatePlanningEntry(ctx, planningEntry, true, adminUser.Group)
+	if errors.Is(err, repository.ErrConflict) {
+		current, err := projectService.GetPlanningEntry(ctx, planningEntry.ID, adminUser.Group)
+		if errors.Is(err, repository.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusConflict, "planning entry deleted meanwhile")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return conflict(c, ifMatch, current, current.Version)
+	}
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
+	utils.SetETag(c, entry.Version)
 	return c.JSON(http.StatusOK, entry)
 }
 
@@ -115,12 +150,31 @@ func upsertProject(c echo.Context) error {
 	if err := c.Bind(&project); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
+	version, ifMatch, err := utils.IfMatch(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if ifMatch {
+		project.Version = version
+	}
 
 	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
 	defer cancel()
-	if _, err := projectService.AddOrUpdateProject(ctx, &project, adminUser.Group); err != nil {
+	_, err = projectService.AddOrUpdateProject(ctx, &project, adminUser.Group)
+	if errors.Is(err, repository.ErrConflict) {
+		current, err := projectService.GetProject(ctx, project.ID, adminUser.Group)
+		if errors.Is(err, repository.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusConflict, "project deleted meanwhile")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return conflict(c, ifMatch, current, current.Version)
+	}
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
+	utils.SetETag(c, project.Version)
 	return c.JSON(http.StatusOK, project)
 }
 
@@ -131,7 +185,15 @@ func listProjects(c echo.Context) error {
 	}
 	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
 	defer cancel()
-	projects, err := projectService.GetProjects(ctx, adminUser.Group)
+	page, err := utils.ParsePage(c, projectService.ProjectQuery)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	filter := types.ProjectFilter{Type: types.ProjectType(c.QueryParam("type"))}
+	if filter.Archived, err = utils.QueryBool(c, "archived"); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	projects, err := projectService.ListProjects(ctx, filter, page, adminUser.Group)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
@@ -145,14 +207,39 @@ func getPlanning(c echo.Context) error {
 	}
 	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
 	defer cancel()
-	projectID := c.Param("id")
-	planning, err := projectService.GetPlanning(ctx, projectID, adminUser.Group)
+	page, err := utils.ParsePage(c, projectService.PlanningQuery)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	filter := types.PlanningFilter{EmployeeID: c.QueryParam("employeeId")}
+	if filter.From, err = queryDay(c, "from", 0); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	// to is included
+	if filter.To, err = queryDay(c, "to", 1); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	planning, err := projectService.ListPlanning(ctx, c.Param("id"), filter, page, adminUser.Group)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 	return c.JSON(http.StatusOK, planning)
 }
 
+// queryDay reads an optional day query param (dd/mm/yyyy), shifted by the given days.
+func queryDay(c echo.Context, name string, days int) (*time.Time, error) {
+	param := c.QueryParam(name)
+	if param == "" {
+		return nil, nil
+	}
+	day, err := time.ParseInLocation(types.BelgianDateFormat, param, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date formatted as dd/mm/yyyy", name)
+	}
+	day = day.AddDate(0, 0, days)
+	return &day, nil
+}
+
 func getProject(c echo.Context) error {
 	adminUser, err := services.GetUser(c)
 	if err != nil {
@@ -162,8 +249,100 @@ func getProject(c echo.Context) error {
 	defer cancel()
 	projectID := c.Param("id")
 	project, err := projectService.GetProject(ctx, projectID, adminUser.Group)
+	if errors.Is(err, repository.ErrNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "project not found")
+	}
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
+	utils.SetETag(c, project.Version)
 	return c.JSON(http.StatusOK, project)
 }
+
+func getPlanningEntry(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	entry, err := projectService.GetPlanningEntry(ctx, c.Param("entryId"), adminUser.Group)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && entry.ProjectID != c.Param("id")) {
+		return echo.NewHTTPError(http.StatusNotFound, "planning entry not found")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	utils.SetETag(c, entry.Version)
+	return c.JSON(http.StatusOK, entry)
+}
+
+// conflict answers a save refused because the document was modified meanwhile, with the current
+// document. It is a failed precondition when the version came from If-Match.
+func conflict(c echo.Context, ifMatch bool, current any, version int64) error {
+	status := http.StatusConflict
+	if ifMatch {
+		status = http.StatusPreconditionFailed
+	}
+	utils.SetETag(c, version)
+	return c.JSON(status, current)
+}
+
+func getPlanningRoster(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+
+	date := time.Now()
+	if d := c.QueryParam("date"); d != "" {
+		if date, err = time.ParseInLocation(types.BelgianDateFormat, d, time.Local); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+	opts := pdf.RosterOptions{
+		Period:   pdf.RosterPeriod(strings.ToUpper(c.QueryParam("period"))),
+		Grouping: pdf.RosterGrouping(strings.ToUpper(c.QueryParam("groupBy"))),
+		Date:     date,
+		Labels:   rosterLabels(ctx),
+	}
+	if opts.Period == "" {
+		opts.Period = pdf.Weekly
+	}
+	if org, err := superadmin.GetOrgByGroup(ctx, adminUser.Group); err == nil {
+		opts.OrganizationName = org.FullName
+	} else {
+		opts.OrganizationName = string(adminUser.Group)
+	}
+
+	roster, err := projectService.GetPlanningRoster(ctx, c.Param("id"), opts, adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	var buf bytes.Buffer
+	if err = roster.Render(&buf); err != nil {
+		c.Logger().Error("could not render roster:", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "could not render roster")
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`inline; filename="roster-%s.pdf"`, date.Format("2006-01-02")))
+	return c.Blob(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+func rosterLabels(ctx context.Context) pdf.RosterLabels {
+	days := [7]string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+	months := [12]string{"january", "february", "march", "april", "may", "june", "july", "august", "september", "october", "november", "december"}
+	labels := pdf.RosterLabels{
+		Week:       utils.Translate(ctx, "roster.week"),
+		Unassigned: utils.Translate(ctx, "roster.unassigned"),
+		Empty:      utils.Translate(ctx, "roster.empty"),
+	}
+	for i, day := range days {
+		labels.Days[i] = utils.Translate(ctx, "common.day."+day)
+	}
+	for i, month := range months {
+		labels.Months[i] = utils.Translate(ctx, "common.month."+month)
+	}
+	return labels
+}
@@ -0,0 +1,125 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services"
+	projectService "github.com/nbittich/wtm/services/project"
+	"github.com/nbittich/wtm/services/utils"
+	"github.com/nbittich/wtm/types"
+)
+
+func AdminReportRouter(e *echo.Echo) {
+	reportGroup := e.Group("/admin/reports")
+	reportGroup.GET("/employees", employeeReportHandler).Name = "admin.reports.Employees"
+	reportGroup.GET("/projects", projectReportHandler).Name = "admin.reports.Projects"
+	reportGroup.GET("/periods", periodReportHandler).Name = "admin.reports.Periods"
+	reportGroup.GET("/fairness", fairnessReportHandler).Name = "admin.reports.Fairness"
+}
+
+// queryList accepts both repeated (?id=a&id=b) and comma separated (?id=a,b) values.
+func queryList(c echo.Context, name string) []string {
+	values := make([]string, 0, 5)
+	for _, param := range c.QueryParams()[name] {
+		for _, v := range strings.Split(param, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+func parseReportFilter(c echo.Context) (types.ReportFilter, error) {
+	from, to, err := utils.ParsePeriod(c)
+	if err != nil {
+		return types.ReportFilter{}, err
+	}
+	return types.ReportFilter{
+		From:        from,
+		To:          to,
+		EmployeeIDs: queryList(c, "employeeIds"),
+		ProjectIDs:  queryList(c, "projectIds"),
+	}, nil
+}
+
+func employeeReportHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	filter, err := parseReportFilter(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	report, err := projectService.GetEmployeeReport(ctx, filter, adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+func projectReportHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	filter, err := parseReportFilter(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	report, err := projectService.GetProjectReport(ctx, filter, adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+func periodReportHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	filter, err := parseReportFilter(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	granularity := types.ReportGranularity(strings.ToUpper(c.QueryParam("granularity")))
+	if granularity == "" {
+		granularity = types.ReportByWeek
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	report, err := projectService.GetPeriodReport(ctx, filter, granularity, adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+func fairnessReportHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	from, to, err := utils.ParsePeriod(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	report, err := projectService.GetFairnessReport(ctx, from, to, adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, report)
+}
@@ -4,16 +4,37 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"slices"
 
 	"github.com/labstack/echo/v4"
 	"github.com/nbittich/wtm/config"
 	"github.com/nbittich/wtm/services"
+	projectService "github.com/nbittich/wtm/services/project"
+	"github.com/nbittich/wtm/services/utils"
 	"github.com/nbittich/wtm/types"
 )
 
 func AdminUserRouter(e *echo.Echo) {
 	adminGroup := e.Group("/admin/users")
 	adminGroup.POST("/new", newUserHandler).Name = "admin.users.New"
+	adminGroup.POST("/invitations", inviteUserHandler).Name = "admin.users.Invite"
+	adminGroup.GET("/invitations", listInvitationsHandler).Name = "admin.users.ListInvitations"
+	adminGroup.POST("/invitations/:id/resend", resendInvitationHandler).Name = "admin.users.ResendInvitation"
+	adminGroup.DELETE("/invitations/:id", deleteInvitationHandler).Name = "admin.users.DeleteInvitation"
+	adminGroup.POST("/:id/contractual-hours", setContractualHoursHandler).Name = "admin.users.SetContractualHours"
+	adminGroup.GET("/:id/overtime", userOvertimeHandler).Name = "admin.users.Overtime"
+	adminGroup.GET("/:id/time-in-lieu", userTimeInLieuHandler).Name = "admin.users.TimeInLieu"
+	adminGroup.POST("/:id/time-in-lieu", adjustTimeInLieuHandler).Name = "admin.users.AdjustTimeInLieu"
+	adminGroup.GET("/:id/sessions", listUserSessionsHandler).Name = "admin.users.ListSessions"
+	adminGroup.DELETE("/:id/sessions", revokeUserSessionsHandler).Name = "admin.users.RevokeSessions"
+	adminGroup.DELETE("/:id/totp", resetUserTOTPHandler).Name = "admin.users.ResetTOTP"
+	adminGroup.POST("/:id/unlock", unlockUserHandler).Name = "admin.users.Unlock"
+	adminGroup.GET("/:id", getUserHandler).Name = "admin.users.Get"
+	adminGroup.PATCH("/:id", updateUserHandler).Name = "admin.users.Update"
+	adminGroup.POST("/:id/enable", enableUserHandler).Name = "admin.users.Enable"
+	adminGroup.POST("/:id/disable", disableUserHandler).Name = "admin.users.Disable"
+	adminGroup.PUT("/:id/roles", setUserRolesHandler).Name = "admin.users.SetRoles"
+	adminGroup.POST("/:id/activation", resendActivationHandler).Name = "admin.users.ResendActivation"
 	adminGroup.GET("", listUserHandler).Name = "admin.users.List"
 }
 
@@ -24,14 +45,142 @@ func listUserHandler(c echo.Context) error {
 	}
 	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
 	defer cancel()
-	users, err := services.AllUsers(ctx, adminUser.Group, nil)
+	page, err := utils.ParsePage(c, services.UserQuery)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	filter := types.UserFilter{Query: c.QueryParam("q"), Role: types.Role(c.QueryParam("role"))}
+	if filter.Enabled, err = utils.QueryBool(c, "enabled"); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if filter.Disabled, err = utils.QueryBool(c, "disabled"); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	users, err := services.SearchUsers(ctx, filter, page, adminUser.Group)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
-
 	return c.JSON(http.StatusOK, users)
 }
 
+func getUserHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	user, err := services.FindUserByID(ctx, c.Param("id"), adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	return c.JSON(http.StatusOK, user)
+}
+
+func updateUserHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	form := types.AdminUserForm{}
+	if err := c.Bind(&form); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	user, err := services.UpdateUser(ctx, c.Param("id"), adminUser.Group, &form)
+	if err != nil {
+		if err, ok := err.(types.InvalidFormError); ok {
+			if msg, ok := err.Messages["general"].(string); ok {
+				err.Messages["general"] = utils.Translate(c.Request().Context(), msg)
+			}
+			return c.JSON(http.StatusBadRequest, err)
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, user)
+}
+
+func enableUserHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	user, err := services.SetUserEnabled(ctx, c.Param("id"), true, adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, user)
+}
+
+// disableUserHandler disables the user. With unassignFuture=true, the user is also removed from the
+// planning entries that did not start yet.
+func disableUserHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	if c.Param("id") == adminUser.ID {
+		return echo.NewHTTPError(http.StatusBadRequest, "you cannot disable yourself")
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	user, err := services.SetUserEnabled(ctx, c.Param("id"), false, adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	unassigned := []types.PlanningEntry{}
+	if c.QueryParam("unassignFuture") == "true" {
+		if unassigned, err = projectService.UnassignFutureAssignments(ctx, user.ID, adminUser.Group); err != nil {
+			c.Logger().Error("could not unassign future assignments: ", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "user disabled, but could not unassign all future assignments")
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]any{"user": user, "unassignedEntries": unassigned})
+}
+
+func setUserRolesHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	form := types.UserRolesForm{}
+	if err := c.Bind(&form); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if c.Param("id") == adminUser.ID && !slices.Contains(form.Roles, types.ADMIN) {
+		return echo.NewHTTPError(http.StatusBadRequest, "you cannot remove your own admin role")
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	user, err := services.SetUserRoles(ctx, c.Param("id"), &form, adminUser.Group)
+	if err != nil {
+		if err, ok := err.(types.InvalidFormError); ok {
+			return c.JSON(http.StatusBadRequest, err)
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, user)
+}
+
+func resendActivationHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	if err = services.ResendActivationEmail(ctx, c.Param("id"), adminUser.Group); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, types.Message{
+		Type:    types.SUCCESS,
+		Message: "activation email sent",
+	})
+}
+
 func newUserHandler(c echo.Context) error {
 	adminUser, err := services.GetUser(c)
 	if err != nil {
@@ -59,3 +208,152 @@ func newUserHandler(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, user)
 }
+
+func setContractualHoursHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	form := struct {
+		ContractualHours float64 `json:"contractualHours" form:"contractualHours"`
+	}{}
+	if err = c.Bind(&form); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	user, err := services.SetContractualHours(ctx, c.Param("id"), form.ContractualHours, adminUser.Group)
+	if err != nil {
+		if err, ok := err.(types.InvalidFormError); ok {
+			err.Form = form
+			return c.JSON(http.StatusBadRequest, err)
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, user)
+}
+
+func userOvertimeHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	from, to, err := utils.ParsePeriod(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	overtime, err := projectService.GetOvertime(ctx, c.Param("id"), from, to, adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, overtime)
+}
+
+func userTimeInLieuHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	balance, err := projectService.GetTimeInLieuBalance(ctx, c.Param("id"), adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	adjustments, err := projectService.GetTimeInLieuAdjustments(ctx, c.Param("id"), adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"balance":     balance,
+		"adjustments": adjustments,
+	})
+}
+
+func adjustTimeInLieuHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	adjustment := types.TimeInLieuAdjustment{}
+	if err = c.Bind(&adjustment); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	adjustment.UserID = c.Param("id")
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	saved, err := projectService.AddTimeInLieuAdjustment(ctx, adjustment, adminUser.ID, adminUser.Group)
+	if err != nil {
+		if err, ok := err.(types.InvalidFormError); ok {
+			err.Form = adjustment
+			return c.JSON(http.StatusBadRequest, err)
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, saved)
+}
+
+func listUserSessionsHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	sessions, err := services.FindActiveSessions(ctx, c.Param("id"), adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, sessions)
+}
+
+func revokeUserSessionsHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	revoked, err := services.RevokeUserSessions(ctx, c.Param("id"), adminUser.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, types.Message{
+		Type:    types.SUCCESS,
+		Message: fmt.Sprintf("%d session(s) revoked", revoked),
+	})
+}
+
+func resetUserTOTPHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	if err = services.ResetTOTP(ctx, c.Param("id"), adminUser.Group); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, types.Message{
+		Type:    types.SUCCESS,
+		Message: "two factor authentication reset",
+	})
+}
+
+func unlockUserHandler(c echo.Context) error {
+	adminUser, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("admin user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	if err = services.UnlockUser(ctx, c.Param("id"), adminUser.Group); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, types.Message{
+		Type:    types.SUCCESS,
+		Message: "user unlocked",
+	})
+}
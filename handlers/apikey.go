@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/types"
+)
+
+// sessionUser returns the user of the context when signed in with a session. Api keys cannot be
+// used on the endpoints managing the account and its credentials: a leaked key must not let
+// anyone take the account over.
+func sessionUser(c echo.Context) (*types.UserClaims, error) {
+	user, err := services.GetUser(c)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("user not found in context"))
+	}
+	if user.APIKeyID != "" {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "not allowed with an api key")
+	}
+	return user, nil
+}
+
+func listAPIKeysHandler(c echo.Context) error {
+	user, err := sessionUser(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	keys, err := services.FindAPIKeys(ctx, user.ID, user.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+func newAPIKeyHandler(c echo.Context) error {
+	user, err := sessionUser(c)
+	if err != nil {
+		return err
+	}
+	form := types.NewAPIKeyForm{}
+	if err := c.Bind(&form); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	key, err := services.CreateAPIKey(ctx, user, &form)
+	if err != nil {
+		if err, ok := err.(types.InvalidFormError); ok {
+			return c.JSON(http.StatusBadRequest, err)
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusCreated, key)
+}
+
+func revokeAPIKeyHandler(c echo.Context) error {
+	user, err := sessionUser(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	if err = services.RevokeAPIKey(ctx, c.Param("id"), user.ID, user.Group); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	return c.JSON(http.StatusOK, types.Message{
+		Type:    types.SUCCESS,
+		Message: "api key revoked",
+	})
+}
@@ -4,12 +4,20 @@ import (
 	"net/http"
 
 	"github.com/labstack/echo/v4"
+	"github.com/nbittich/wtm/services"
 	"github.com/nbittich/wtm/services/utils"
 	"github.com/nbittich/wtm/types"
 )
 
 func HomeRouter(e *echo.Echo) {
 	e.GET("/", homeHandler).Name = "home.root"
+	e.GET("/.well-known/jwks.json", jwksHandler).Name = "home.JWKS"
+}
+
+// jwksHandler publishes the public keys verifying our access tokens, old keys included until they are removed.
+func jwksHandler(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, services.JWKS())
 }
 
 func homeHandler(c echo.Context) error {
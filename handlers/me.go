@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/services/utils"
+	"github.com/nbittich/wtm/types"
+)
+
+func getMeHandler(c echo.Context) error {
+	user, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	me, err := services.FindUserByID(ctx, user.ID, user.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	return c.JSON(http.StatusOK, me)
+}
+
+// updateMeHandler answers with the updated user and a new access token reflecting the update.
+func updateMeHandler(c echo.Context) error {
+	user, err := sessionUser(c)
+	if err != nil {
+		return err
+	}
+	form := types.UpdateMeForm{}
+	if err := c.Bind(&form); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	me, err := services.UpdateMe(ctx, user.ID, user.Group, &form)
+	if err != nil {
+		if err, ok := err.(types.InvalidFormError); ok {
+			return c.JSON(http.StatusBadRequest, err)
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	response := map[string]any{"user": me}
+	tokens, err := services.RenewAccessToken(ctx, user)
+	if err != nil {
+		c.Logger().Error("could not renew access token: ", err)
+	} else {
+		response["tokens"] = tokens
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+func changePasswordHandler(c echo.Context) error {
+	user, err := sessionUser(c)
+	if err != nil {
+		return err
+	}
+	form := types.ChangePasswordForm{}
+	if err := c.Bind(&form); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	if err = services.ChangePassword(ctx, user, &form); err != nil {
+		if err, ok := err.(types.InvalidFormError); ok {
+			form.CurrentPassword, form.Password, form.ConfirmPassword = "", "", ""
+			err.Form = form
+			if _, ok := err.Messages["general"]; ok {
+				return handleGeneralFormError(c, err)
+			}
+			return c.JSON(http.StatusBadRequest, err)
+		}
+		c.Logger().Error("could not change password: ", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "unexpected error while changing password")
+	}
+	return c.JSON(http.StatusOK, types.Message{
+		Type:    types.SUCCESS,
+		Message: utils.Translate(c.Request().Context(), "home.password.reset.done"),
+	})
+}
+
+func changeEmailHandler(c echo.Context) error {
+	user, err := sessionUser(c)
+	if err != nil {
+		return err
+	}
+	form := types.ChangeEmailForm{}
+	if err := c.Bind(&form); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	if err = services.RequestEmailChange(ctx, user.ID, user.Group, &form); err != nil {
+		if err, ok := err.(types.InvalidFormError); ok {
+			form.Password = ""
+			err.Form = form
+			if _, ok := err.Messages["general"]; ok {
+				return handleGeneralFormError(c, err)
+			}
+			return c.JSON(http.StatusBadRequest, err)
+		}
+		c.Logger().Error("could not change email: ", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "unexpected error while changing email")
+	}
+	return c.JSON(http.StatusOK, types.Message{
+		Type:    types.INFO,
+		Message: utils.Translate(c.Request().Context(), "home.me.emailChangeSent"),
+	})
+}
+
+func confirmEmailHandler(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	confirmed, err := services.ConfirmEmailChange(ctx, c.QueryParam("hash"), types.Group(c.QueryParam("group")))
+	if err != nil {
+		c.Logger().Error("could not confirm email: ", err)
+	}
+	message := types.Message{Type: types.SUCCESS, Message: "home.me.emailChanged"}
+	if !confirmed {
+		message = types.Message{Type: types.ERROR, Message: "home.me.emailNotChanged"}
+	}
+	message.Message = utils.Translate(c.Request().Context(), message.Message)
+	return c.JSON(http.StatusOK, message)
+}
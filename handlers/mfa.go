@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/types"
+)
+
+// loginTOTPHandler is the second step of the login, for users who enabled two factor authentication.
+func loginTOTPHandler(c echo.Context) error {
+	mfaToken := strings.TrimSpace(c.FormValue("mfaToken"))
+	code := strings.TrimSpace(c.FormValue("code"))
+	group := types.Group(strings.TrimSpace(c.FormValue("group")))
+	invalidFormError := types.InvalidFormError{Messages: types.InvalidMessage{"general": "home.signin.invalidCode"}}
+	if len(mfaToken) == 0 || len(code) == 0 || len(group) == 0 {
+		return handleGeneralFormError(c, invalidFormError)
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	tokens, err := services.CompleteMFAChallenge(ctx, mfaToken, group, code, c.Request().UserAgent(), c.RealIP())
+	if err != nil {
+		var throttled *services.LoginThrottledError
+		if errors.As(err, &throttled) {
+			return loginThrottled(c, err)
+		}
+		if err != services.ErrInvalidSecondFactor {
+			c.Logger().Error("could not complete mfa challenge: ", err)
+		}
+		return handleGeneralFormError(c, invalidFormError)
+	}
+	return c.JSON(http.StatusOK, tokens)
+}
+
+func enrollTOTPHandler(c echo.Context) error {
+	user, err := sessionUser(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	secret, uri, err := services.EnrollTOTP(ctx, user.ID, user.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"secret": secret, "uri": uri})
+}
+
+func confirmTOTPHandler(c echo.Context) error {
+	user, err := sessionUser(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	recoveryCodes, err := services.ConfirmTOTP(ctx, user.ID, user.Group, c.FormValue("code"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string][]string{"recoveryCodes": recoveryCodes})
+}
+
+func disableTOTPHandler(c echo.Context) error {
+	user, err := sessionUser(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	if err = services.DisableTOTP(ctx, user.ID, user.Group, c.FormValue("code")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, types.Message{
+		Type:    types.SUCCESS,
+		Message: "two factor authentication disabled",
+	})
+}
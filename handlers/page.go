@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nbittich/wtm/services/utils"
+)
+
+// tokenFormTemplate is the page opened by the links sent by email, which post the token of the
+// link with the fields filled in by the user.
+var tokenFormTemplate = template.Must(template.New("tokenForm").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="token" value="{{.Token}}">
+<input type="hidden" name="group" value="{{.Group}}">
+{{range .Fields}}<p><label>{{if eq .Type "checkbox"}}<input type="checkbox" name="{{.Name}}" value="true" required> {{.Label}}{{else}}{{.Label}}<br><input type="{{.Type}}" name="{{.Name}}" required>{{end}}</label></p>
+{{end}}<button type="submit">{{.Submit}}</button>
+</form>
+</body>
+</html>
+`))
+
+type tokenFormPage struct {
+	Title  string
+	Action string
+	Token  string
+	Group  string
+	Fields []tokenFormField
+	Submit string
+}
+
+type tokenFormField struct {
+	Name  string
+	Label string // translated by renderTokenForm
+	Type  string
+}
+
+// renderTokenForm renders the form posting the token and group of the link to action. The title
+// and labels are i18n message ids.
+func renderTokenForm(c echo.Context, title string, action string, fields ...tokenFormField) error {
+	ctx := c.Request().Context()
+	token := c.QueryParam("token")
+	group := c.QueryParam("group")
+	if token == "" || group == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "token and group are required")
+	}
+	page := tokenFormPage{
+		Title:  utils.Translate(ctx, title),
+		Action: action,
+		Token:  token,
+		Group:  group,
+		Submit: utils.Translate(ctx, "common.submit"),
+	}
+	for _, field := range fields {
+		field.Label = utils.Translate(ctx, field.Label)
+		page.Fields = append(page.Fields, field)
+	}
+	var html strings.Builder
+	if err := tokenFormTemplate.Execute(&html, page); err != nil {
+		return err
+	}
+	return c.HTML(http.StatusOK, html.String())
+}
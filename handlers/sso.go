@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/types"
+)
+
+// ssoLoginHandler redirects to the identity provider of the organization.
+func ssoLoginHandler(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	authURL, err := services.StartSSO(ctx, types.Group(c.Param("group")))
+	if err != nil {
+		if err == services.ErrSSONotConfigured {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		c.Logger().Error("could not start single sign-on: ", err)
+		return echo.NewHTTPError(http.StatusBadGateway, "identity provider unavailable")
+	}
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// ssoCallbackHandler is where the identity provider sends the user back with an authorization code.
+func ssoCallbackHandler(c echo.Context) error {
+	if idpError := c.QueryParam("error"); idpError != "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, idpError)
+	}
+	state := c.QueryParam("state")
+	code := c.QueryParam("code")
+	if state == "" || code == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "state and code are required")
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	tokens, mfaToken, err := services.CompleteSSO(ctx, types.Group(c.Param("group")), state, code, c.Request().UserAgent(), c.RealIP())
+	if err != nil {
+		if err != services.ErrSSOFailed && err != services.ErrSSONotConfigured {
+			c.Logger().Error("could not complete single sign-on: ", err)
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, services.ErrSSOFailed.Error())
+	}
+	if mfaToken != "" {
+		// completed like a password login, see loginTOTPHandler
+		return c.JSON(http.StatusOK, map[string]any{"mfaRequired": true, "mfaToken": mfaToken})
+	}
+	return c.JSON(http.StatusOK, tokens)
+}
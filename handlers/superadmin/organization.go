@@ -2,18 +2,27 @@ package superadmin
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/nbittich/wtm/config"
 	"github.com/nbittich/wtm/services/superadmin"
 	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func SuperAdminRouter(e *echo.Echo) {
 	superGroup := e.Group("/organizations")
 	superGroup.POST("", upsertOrgHandler).Name = "superadmin.organizations.Upsert"
 	superGroup.GET("", listOrgHandler).Name = "superadmin.organizations.List"
+	superGroup.POST("/:id/suspend", orgStatusHandler(superadmin.SuspendOrg)).Name = "superadmin.organizations.Suspend"
+	superGroup.POST("/:id/reactivate", orgStatusHandler(superadmin.ReactivateOrg)).Name = "superadmin.organizations.Reactivate"
+	superGroup.DELETE("/:id", orgStatusHandler(superadmin.DeleteOrg)).Name = "superadmin.organizations.Delete"
+	superGroup.POST("/:id/restore", orgStatusHandler(superadmin.RestoreOrg)).Name = "superadmin.organizations.Restore"
+	superGroup.GET("/:id/export", exportOrgHandler).Name = "superadmin.organizations.Export"
+	superGroup.POST("/import", importOrgHandler).Name = "superadmin.organizations.Import"
 }
 
 func listOrgHandler(c echo.Context) error {
@@ -49,3 +58,61 @@ func upsertOrgHandler(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, org)
 }
+
+// orgStatusHandler applies a change of status to the organization :id.
+func orgStatusHandler(change func(context.Context, string) (*types.Organization, error)) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+		defer cancel()
+		org, err := change(ctx, c.Param("id"))
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return echo.NewHTTPError(http.StatusNotFound, "organization not found")
+			}
+			c.Logger().Error("could not change organization status: ", err)
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return c.JSON(http.StatusOK, org)
+	}
+}
+
+func exportOrgHandler(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.BackupCtxTimeout)
+	defer cancel()
+	id := c.Param("id")
+	if exist, err := superadmin.OrgExists(ctx, id); err != nil || !exist {
+		if err != nil {
+			c.Logger().Error("could not find organization: ", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "could not export organization")
+		}
+		return echo.NewHTTPError(http.StatusNotFound, "organization not found")
+	}
+	c.Response().Header().Set(echo.HeaderContentType, "application/zip")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s-%s.zip"`, id, time.Now().Format("20060102150405")))
+	c.Response().WriteHeader(http.StatusOK)
+	// the status is already sent, a failure can only truncate the archive
+	if err := superadmin.ExportOrg(ctx, id, c.Response()); err != nil {
+		c.Logger().Error("could not export organization: ", err)
+	}
+	return nil
+}
+
+func importOrgHandler(c echo.Context) error {
+	fileHeader, err := c.FormFile("archive")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "missing archive")
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	defer file.Close()
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.BackupCtxTimeout)
+	defer cancel()
+	org, err := superadmin.ImportOrg(ctx, file, fileHeader.Size, types.Group(c.FormValue("group")))
+	if err != nil {
+		c.Logger().Error("could not import organization: ", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, org)
+}
@@ -2,14 +2,16 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 	"github.com/nbittich/wtm/config"
+	appMidleware "github.com/nbittich/wtm/middleware"
 	"github.com/nbittich/wtm/services"
 	"github.com/nbittich/wtm/services/utils"
 	"github.com/nbittich/wtm/types"
@@ -17,9 +19,32 @@ import (
 
 func UserRouter(e *echo.Echo) {
 	userGroup := e.Group("/users")
+	rateLimit := appMidleware.RateLimit("login", config.LoginRateLimit, time.Minute)
 	userGroup.GET("/activate", activateUserHandler).Name = "users.Activate"
-	userGroup.POST("/login", loginHandler).Name = "users.Login"
+	userGroup.POST("/login", loginHandler, rateLimit).Name = "users.Login"
+	userGroup.POST("/login/totp", loginTOTPHandler, rateLimit).Name = "users.LoginTOTP"
 	userGroup.GET("/logout", logoutHandler).Name = "users.Logout"
+	userGroup.GET("/unlock", unlockHandler, rateLimit).Name = "users.Unlock"
+	userGroup.POST("/refresh", refreshTokenHandler, rateLimit).Name = "users.Refresh"
+	userGroup.GET("/sso/:group/login", ssoLoginHandler, rateLimit).Name = "users.SSOLogin"
+	userGroup.GET("/sso/:group/callback", ssoCallbackHandler, rateLimit).Name = "users.SSOCallback"
+	userGroup.POST("/password/forgot", forgotPasswordHandler, rateLimit,
+		appMidleware.RateLimit("passwordReset", config.PasswordResetMaxPerHourIP, time.Hour)).Name = "users.ForgotPassword"
+	userGroup.GET("/password/reset", resetPasswordPageHandler).Name = "users.ResetPasswordPage"
+	userGroup.POST("/password/reset", resetPasswordHandler, rateLimit).Name = "users.ResetPassword"
+	userGroup.GET("/invitation/accept", acceptInvitationPageHandler).Name = "users.AcceptInvitationPage"
+	userGroup.POST("/invitation/accept", acceptInvitationHandler, rateLimit).Name = "users.AcceptInvitation"
+	userGroup.GET("/email/confirm", confirmEmailHandler, rateLimit).Name = "users.ConfirmEmail"
+	userGroup.GET("/me", getMeHandler).Name = "users.Me"
+	userGroup.PATCH("/me", updateMeHandler).Name = "users.UpdateMe"
+	userGroup.POST("/me/password", changePasswordHandler).Name = "users.ChangePassword"
+	userGroup.POST("/me/email", changeEmailHandler).Name = "users.ChangeEmail"
+	userGroup.POST("/me/totp", enrollTOTPHandler).Name = "users.EnrollTOTP"
+	userGroup.POST("/me/totp/confirm", confirmTOTPHandler).Name = "users.ConfirmTOTP"
+	userGroup.DELETE("/me/totp", disableTOTPHandler).Name = "users.DisableTOTP"
+	userGroup.GET("/me/api-keys", listAPIKeysHandler).Name = "users.ListAPIKeys"
+	userGroup.POST("/me/api-keys", newAPIKeyHandler).Name = "users.NewAPIKey"
+	userGroup.DELETE("/me/api-keys/:id", revokeAPIKeyHandler).Name = "users.RevokeAPIKey"
 }
 
 func handleGeneralFormError(c echo.Context, invalidFormError types.InvalidFormError) error {
@@ -28,9 +53,19 @@ func handleGeneralFormError(c echo.Context, invalidFormError types.InvalidFormEr
 }
 
 func logoutHandler(c echo.Context) error {
+	user, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf("user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	if err = services.RevokeSession(ctx, user.RegisteredClaims.ID, user.Group); err != nil {
+		c.Logger().Error("could not revoke session: ", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "could not logout")
+	}
 	return c.JSON(http.StatusOK, &types.Message{
-		Type:    types.WARNING,
-		Message: "please delete your token. it will be removed automatically once it expires'",
+		Type:    types.SUCCESS,
+		Message: "logged out",
 	})
 }
 
@@ -45,37 +80,98 @@ func loginHandler(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
 	defer cancel()
 
+	ip := c.RealIP()
 	user, error := services.FindByUsernameOrEmail(ctx, username, group)
+	var knownUser *types.User
+	if error == nil {
+		knownUser = &user
+	}
+	if err := services.CheckLogin(ctx, ip, knownUser); err != nil {
+		return loginThrottled(c, err)
+	}
 
-	if error != nil || !user.Enabled {
+	// users provisioned by single sign-on have no password
+	if error != nil || !user.CanSignIn() || user.Password == nil {
+		services.LoginFailed(ctx, ip, knownUser)
 		return handleGeneralFormError(c, invalidFormError)
 	}
 	passwordMatches := services.CheckPasswordHash(password, *user.Password)
 	if !passwordMatches {
 		fmt.Println("passwords don't match")
+		services.LoginFailed(ctx, ip, knownUser)
 		return handleGeneralFormError(c, invalidFormError)
 	}
-	userClaims := &types.UserClaims{
-		ID:       user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-		Profile:  user.Profile,
-		Settings: user.Settings,
-		Roles:    user.Roles,
-		Group:    *user.Group,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.JWTExpiresAFterMinutes)),
-			Issuer:    config.JWTIssuer,
-		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, userClaims)
-	ss, err := token.SignedString(config.JWTSecretKey)
+	if err := services.CheckOrganizationActive(ctx, group); err != nil {
+		if err != services.ErrOrganizationInactive {
+			c.Logger().Error("could not check organization", err)
+		}
+		return handleGeneralFormError(c, types.InvalidFormError{Messages: types.InvalidMessage{"general": "home.signin.organizationInactive"}})
+	}
+	// the throttle of the user is reset once the second factor was checked too
+	if user.TOTP != nil && user.TOTP.Enabled {
+		mfaToken, err := services.StartMFAChallenge(ctx, &user)
+		if err != nil {
+			c.Logger().Error("could not start mfa challenge", err)
+			return handleGeneralFormError(c, invalidFormError)
+		}
+		return c.JSON(http.StatusOK, map[string]any{"mfaRequired": true, "mfaToken": mfaToken})
+	}
+	tokens, err := services.CreateSession(ctx, &user, c.Request().UserAgent(), c.RealIP())
 	if err != nil {
 		c.Logger().Error("error writing jwt", err)
 		return handleGeneralFormError(c, invalidFormError)
 	}
-	jwt := map[string]string{"jwt": ss}
-	return c.JSON(http.StatusOK, jwt)
+	services.LoginSucceeded(ctx, &user)
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// loginThrottled answers 429 with the delay before the next attempt.
+func loginThrottled(c echo.Context, err error) error {
+	message := "home.signin.tooManyAttempts"
+	var throttled *services.LoginThrottledError
+	if errors.As(err, &throttled) {
+		c.Response().Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		if throttled.Locked {
+			message = "home.signin.locked"
+		}
+	}
+	return c.JSON(http.StatusTooManyRequests, types.Message{
+		Type:    types.ERROR,
+		Message: utils.Translate(c.Request().Context(), message),
+	})
+}
+
+func unlockHandler(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	unlocked, err := services.UnlockWithToken(ctx, c.QueryParam("token"), types.Group(c.QueryParam("group")))
+	if err != nil {
+		c.Logger().Error("could not unlock user: ", err)
+	}
+	message := types.Message{Type: types.SUCCESS, Message: "home.signin.unlocked"}
+	if !unlocked {
+		message = types.Message{Type: types.ERROR, Message: "home.signin.unlockFailed"}
+	}
+	message.Message = utils.Translate(c.Request().Context(), message.Message)
+	return c.JSON(http.StatusOK, message)
+}
+
+func refreshTokenHandler(c echo.Context) error {
+	refreshToken := strings.TrimSpace(c.FormValue("refreshToken"))
+	group := types.Group(strings.TrimSpace(c.FormValue("group")))
+	if len(refreshToken) == 0 || len(group) == 0 {
+		return echo.NewHTTPError(http.StatusUnauthorized, services.ErrInvalidRefreshToken.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	tokens, err := services.RefreshSession(ctx, refreshToken, group, c.Request().UserAgent(), c.RealIP())
+	if err != nil {
+		if err != services.ErrInvalidRefreshToken {
+			c.Logger().Error("could not refresh token: ", err)
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, services.ErrInvalidRefreshToken.Error())
+	}
+	return c.JSON(http.StatusOK, tokens)
 }
 
 func activateUserHandler(c echo.Context) error {
@@ -100,3 +196,89 @@ func activateUserHandler(c echo.Context) error {
 	message.Message = utils.Translate(c.Request().Context(), message.Message)
 	return c.JSON(http.StatusOK, message)
 }
+
+func forgotPasswordHandler(c echo.Context) error {
+	username := strings.TrimSpace(c.FormValue("username"))
+	group := types.Group(strings.TrimSpace(c.FormValue("group")))
+	if len(username) == 0 || len(group) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "username and group are required")
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	if err := services.ForgotPassword(ctx, username, group); err != nil {
+		c.Logger().Error("could not send password reset link: ", err)
+	}
+	// same answer whether the user exists or not
+	return c.JSON(http.StatusOK, types.Message{
+		Type:    types.INFO,
+		Message: utils.Translate(c.Request().Context(), "home.password.forgot.sent"),
+	})
+}
+
+// resetPasswordPageHandler is the page of the link emailed by forgotPasswordHandler.
+func resetPasswordPageHandler(c echo.Context) error {
+	return renderTokenForm(c, "home.password.reset.title", c.Echo().Reverse("users.ResetPassword"),
+		tokenFormField{Name: "password", Label: "common.password", Type: "password"},
+		tokenFormField{Name: "confirmPassword", Label: "home.signup.confirmPassword", Type: "password"},
+	)
+}
+
+func resetPasswordHandler(c echo.Context) error {
+	form := types.ResetPasswordForm{}
+	if err := c.Bind(&form); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	if err := services.ResetPassword(ctx, &form); err != nil {
+		if err, ok := err.(types.InvalidFormError); ok {
+			form.Password, form.ConfirmPassword = "", ""
+			err.Form = form
+			if _, ok := err.Messages["general"]; ok {
+				return handleGeneralFormError(c, err)
+			}
+			return c.JSON(http.StatusBadRequest, err)
+		}
+		c.Logger().Error("could not reset password: ", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "unexpected error while resetting password")
+	}
+	return c.JSON(http.StatusOK, types.Message{
+		Type:    types.SUCCESS,
+		Message: utils.Translate(c.Request().Context(), "home.password.reset.done"),
+	})
+}
+
+// acceptInvitationPageHandler is the page of the link emailed with an invitation.
+func acceptInvitationPageHandler(c echo.Context) error {
+	return renderTokenForm(c, "home.invitation.title", c.Echo().Reverse("users.AcceptInvitation"),
+		tokenFormField{Name: "username", Label: "common.username", Type: "text"},
+		tokenFormField{Name: "password", Label: "common.password", Type: "password"},
+		tokenFormField{Name: "confirmPassword", Label: "home.signup.confirmPassword", Type: "password"},
+		tokenFormField{Name: "acceptTerms", Label: "home.invitation.acceptTerms", Type: "checkbox"},
+	)
+}
+
+func acceptInvitationHandler(c echo.Context) error {
+	form := types.AcceptInvitationForm{}
+	if err := c.Bind(&form); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	if _, err := services.AcceptInvitation(ctx, &form); err != nil {
+		if err, ok := err.(types.InvalidFormError); ok {
+			form.Password, form.ConfirmPassword = "", ""
+			err.Form = form
+			if _, ok := err.Messages["general"]; ok {
+				return handleGeneralFormError(c, err)
+			}
+			return c.JSON(http.StatusBadRequest, err)
+		}
+		c.Logger().Error("could not accept invitation: ", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "unexpected error while accepting invitation")
+	}
+	return c.JSON(http.StatusOK, types.Message{
+		Type:    types.SUCCESS,
+		Message: utils.Translate(c.Request().Context(), "home.invitation.accepted"),
+	})
+}
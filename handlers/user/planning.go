@@ -2,6 +2,7 @@ package user
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -9,11 +10,18 @@ import (
 	"github.com/nbittich/wtm/config"
 	"github.com/nbittich/wtm/services"
 	projectService "github.com/nbittich/wtm/services/project"
+	"github.com/nbittich/wtm/services/utils"
+	"github.com/nbittich/wtm/types"
 )
 
 func UserPlanningRoute(e *echo.Echo) {
 	planningGroup := e.Group("/planning")
 	planningGroup.GET("/assignments", getPlanningAssignments).Name = "user.planning.GetAssignments"
+	planningGroup.GET("/overtime", getOvertime).Name = "user.planning.GetOvertime"
+	planningGroup.GET("/time-in-lieu", getTimeInLieu).Name = "user.planning.GetTimeInLieu"
+	planningGroup.GET("/punches", getClockPunches).Name = "user.planning.GetClockPunches"
+	planningGroup.POST("/clock-in", clockPunchHandler(projectService.ClockIn)).Name = "user.planning.ClockIn"
+	planningGroup.POST("/clock-out", clockPunchHandler(projectService.ClockOut)).Name = "user.planning.ClockOut"
 }
 
 func getPlanningAssignments(c echo.Context) error {
@@ -29,3 +37,71 @@ func getPlanningAssignments(c echo.Context) error {
 	}
 	return c.JSON(http.StatusOK, assignments)
 }
+
+func getOvertime(c echo.Context) error {
+	user, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf(" user not found in context"))
+	}
+	from, to, err := utils.ParsePeriod(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	overtime, err := projectService.GetOvertime(ctx, user.ID, from, to, user.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, overtime)
+}
+
+func getTimeInLieu(c echo.Context) error {
+	user, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf(" user not found in context"))
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	balance, err := projectService.GetTimeInLieuBalance(ctx, user.ID, user.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, balance)
+}
+
+func getClockPunches(c echo.Context) error {
+	user, err := services.GetUser(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf(" user not found in context"))
+	}
+	from, to, err := utils.ParsePeriod(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+	defer cancel()
+	punches, err := projectService.GetClockPunches(ctx, user.ID, from, to, user.Group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, punches)
+}
+
+func clockPunchHandler(punch func(context.Context, string, types.Group) (*types.ClockPunch, error)) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user, err := services.GetUser(c)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Errorf(" user not found in context"))
+		}
+		ctx, cancel := context.WithTimeout(c.Request().Context(), config.MongoCtxTimeout)
+		defer cancel()
+		clockPunch, err := punch(ctx, user.ID, user.Group)
+		if errors.Is(err, projectService.ErrClockedIn) || errors.Is(err, projectService.ErrNotClockedIn) {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		} else if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return c.JSON(http.StatusOK, clockPunch)
+	}
+}
@@ -9,13 +9,12 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 	"github.com/nbittich/wtm/services"
-	"github.com/nbittich/wtm/services/db"
 	"github.com/nbittich/wtm/services/utils"
 	"github.com/nbittich/wtm/types"
 	"github.com/nbittich/wtm/views"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
 type AuthConfig struct {
@@ -36,7 +35,22 @@ func init() {
 	}
 }
 
+// apiKeyFromRequest returns the api key sent either as bearer or in the X-API-Key header.
+func apiKeyFromRequest(c echo.Context) string {
+	if key := c.Request().Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if tok, found := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer "); found && services.IsAPIKey(tok) {
+		return tok
+	}
+	return ""
+}
+
 func JWTTokenExtractor(c echo.Context) ([]string, error) {
+	if apiKeyFromRequest(c) != "" {
+		// not a jwt, it is checked by ValidateAuth
+		return nil, fmt.Errorf("api key")
+	}
 	tok := c.Request().Header.Get("Authorization")
 	if strings.Contains(tok, "Bearer ") {
 		split := strings.Split(tok, "Bearer ")
@@ -49,6 +63,9 @@ func JWTTokenExtractor(c echo.Context) ([]string, error) {
 }
 
 func JWTErrorHandler(c echo.Context, err error) error {
+	if apiKeyFromRequest(c) != "" {
+		return nil
+	}
 	for _, ac := range authConfigs {
 		if m, _ := regexp.MatchString(ac.Pattern, c.Path()); m {
 			if ac.Authenticated {
@@ -86,6 +103,15 @@ func ValidateAuth(next echo.HandlerFunc) echo.HandlerFunc {
 			return forbidden(c)
 		}
 
+		if key := apiKeyFromRequest(c); key != "" {
+			claims, err := services.AuthenticateAPIKey(c.Request().Context(), key)
+			if err != nil {
+				c.Logger().Warnf("api key error %s", err.Error())
+				return forbidden(c)
+			}
+			c.Set("user", &jwt.Token{Claims: claims, Valid: true})
+		}
+
 		user, _ := services.GetUser(c)
 
 		for _, ac := range authConfigs {
@@ -97,20 +123,16 @@ func ValidateAuth(next echo.HandlerFunc) echo.HandlerFunc {
 					return forbidden(c)
 				}
 				if ac.Authenticated {
-					// check user token wasn't forged
-					// fixme maybe add a special hash with a combination of what we have above in db
-					filter := bson.M{
-						"$and": []bson.M{
-							{"username": user.Username},
-							{"group": user.Group},
-							{"_id": user.ID},
-						},
-					}
-					collection, err := db.GetCollection(services.UserCollection, user.Group)
-					if err != nil {
-						return forbidden(c)
+					// the session must not be revoked and the user still enabled,
+					// so that tokens stop working at once instead of at expiry.
+					// api keys were already checked above.
+					if user.APIKeyID == "" {
+						if active, err := services.IsSessionActive(c.Request().Context(), user); !active || err != nil {
+							return forbidden(c)
+						}
 					}
-					if exist, err := db.Exist(c.Request().Context(), filter, collection); !exist || err != nil {
+					// members of a suspended or deleted organization are logged out at once
+					if err := services.CheckOrganizationActive(c.Request().Context(), user.Group); err != nil {
 						return forbidden(c)
 					}
 
@@ -3,23 +3,12 @@ package middleware
 import (
 	"context"
 
-	"github.com/BurntSushi/toml"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
+	"github.com/nbittich/wtm/services/utils"
 	"github.com/nbittich/wtm/types"
-	"github.com/nicksnyder/go-i18n/v2/i18n"
-	"golang.org/x/text/language"
 )
 
-var bundle *i18n.Bundle
-
-func init() {
-	bundle = i18n.NewBundle(language.French)
-	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
-	bundle.LoadMessageFile("i18n/fr.toml")
-	bundle.LoadMessageFile("i18n/en.toml")
-}
-
 func I18n(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		r := c.Request()
@@ -40,7 +29,7 @@ func I18n(next echo.HandlerFunc) echo.HandlerFunc {
 			ctx = context.WithValue(ctx, types.LangKey, accept)
 		}
 
-		localizer := i18n.NewLocalizer(bundle, lang, accept)
+		localizer := utils.NewLocalizer(lang, accept)
 		c.SetRequest(r.WithContext(context.WithValue(ctx, types.I18nKey, localizer)))
 		return next(c)
 	}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// IPExtractor tells how to get the ip address of the client, on which the throttles, the rate
+// limits and the sessions rely. The headers set by the client are never trusted: without
+// trusted proxies the address of the connection is used, otherwise X-Forwarded-For is read up
+// to the first address not in trustedProxies, a comma separated list of cidr.
+func IPExtractor(trustedProxies string) (echo.IPExtractor, error) {
+	var options []echo.TrustOption
+	for _, cidr := range strings.Split(trustedProxies, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, ipRange, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+	if len(options) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+	options = append(options, echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false))
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+// RateLimitKey is the counter of the client for the rate limit named name.
+func RateLimitKey(c echo.Context, name string) string {
+	return fmt.Sprintf("%s:%s", name, c.RealIP())
+}
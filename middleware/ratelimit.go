@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/types"
+)
+
+// RateLimit allows at most limit requests per window and ip address on the routes it wraps.
+// The counters are in mongo, so that they are shared by every instance.
+func RateLimit(name string, limit int, window time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			allowed, retryAfter, err := services.HitRateLimit(c.Request().Context(), RateLimitKey(c, name), limit, window)
+			if err != nil {
+				// better let the request through than block every login when the counter is unavailable
+				c.Logger().Error("rate limit unavailable: ", err)
+				return next(c)
+			}
+			if !allowed {
+				c.Response().Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(retryAfter.Seconds()))))
+				return c.JSON(http.StatusTooManyRequests, types.Message{Type: types.ERROR, Message: "too many requests"})
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/utils"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	APIKeyCollection = "apiKey"
+	// APIKeyPrefix starts every api key, followed by the group of its owner and the secret part:
+	// wtm_<group>_<secret>. The group tells in which collection the key is.
+	APIKeyPrefix = "wtm_"
+	// the last used date is written at most once per interval, not on every request
+	apiKeyLastUsedInterval = time.Minute
+)
+
+var ErrInvalidAPIKey = fmt.Errorf("invalid api key")
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// ParseAPIKey returns the group of the owner of a well formed key.
+func ParseAPIKey(key string) (types.Group, bool) {
+	group, secret, found := strings.Cut(strings.TrimPrefix(key, APIKeyPrefix), "_")
+	if !IsAPIKey(key) || !found || group == "" || secret == "" {
+		return "", false
+	}
+	return types.Group(group), true
+}
+
+// CreateAPIKey returns the new key in clear, it is the only time it can be read.
+// The scopes must be roles the user currently holds.
+func CreateAPIKey(ctx context.Context, user *types.UserClaims, form *types.NewAPIKeyForm) (*types.NewAPIKey, error) {
+	if err := utils.ValidateStruct(form); err != nil {
+		return nil, err
+	}
+	for _, scope := range form.Scopes {
+		if !slices.Contains(user.Roles, scope) {
+			return nil, types.InvalidFormError{Form: form, Messages: types.InvalidMessage{"scopes": fmt.Sprintf("role %s not granted", scope)}}
+		}
+	}
+	collection, err := dbClient.Collection(APIKeyCollection, user.Group)
+	if err != nil {
+		return nil, err
+	}
+	secret, _, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s%s_%s", APIKeyPrefix, user.Group, secret)
+	now := time.Now()
+	apiKey := types.APIKey{
+		UserID:    user.ID,
+		Name:      form.Name,
+		Prefix:    key[:len(APIKeyPrefix)+len(user.Group)+5],
+		Hash:      hashToken(key),
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(form.Scopes))),
+		CreatedAt: now,
+		ExpiresAt: now.AddDate(0, 0, form.ExpiresInDays),
+	}
+	if _, err = db.InsertOrUpdate(ctx, &apiKey, collection); err != nil {
+		return nil, err
+	}
+	return &types.NewAPIKey{APIKey: apiKey, Key: key}, nil
+}
+
+func FindAPIKeys(ctx context.Context, userID string, group types.Group) ([]types.APIKey, error) {
+	collection, err := dbClient.Collection(APIKeyCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	return db.Find[types.APIKey](ctx, bson.M{"userId": userID}, collection, nil)
+}
+
+func RevokeAPIKey(ctx context.Context, keyID string, userID string, group types.Group) error {
+	collection, err := dbClient.Collection(APIKeyCollection, group)
+	if err != nil {
+		return err
+	}
+	res, err := collection.UpdateOne(ctx, bson.M{"_id": keyID, "userId": userID, "revokedAt": nil}, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("api key not found")
+	}
+	return nil
+}
+
+// AuthenticateAPIKey returns the claims of the owner of a valid key, restricted to the scopes of the key.
+// The ADMIN scope is withheld while the organization requires a second factor for the admins.
+func AuthenticateAPIKey(ctx context.Context, key string) (*types.UserClaims, error) {
+	group, ok := ParseAPIKey(key)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+	collection, err := dbClient.Collection(APIKeyCollection, group)
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	apiKey, err := db.FindOneBy[types.APIKey](ctx, bson.M{"hash": hashToken(key)}, collection)
+	if err != nil || !apiKey.IsValid(now) {
+		return nil, ErrInvalidAPIKey
+	}
+	user, err := FindUserByID(ctx, apiKey.UserID, group)
+	if err != nil || !user.CanSignIn() {
+		return nil, ErrInvalidAPIKey
+	}
+	if err = CheckOrganizationActive(ctx, group); err != nil {
+		return nil, err
+	}
+	if _, err = collection.UpdateOne(ctx, bson.M{
+		"_id": apiKey.ID,
+		"$or": []bson.M{
+			{"lastUsedAt": nil},
+			{"lastUsedAt": bson.M{"$lt": now.Add(-apiKeyLastUsedInterval)}},
+		},
+	}, bson.M{"$set": bson.M{"lastUsedAt": now}}); err != nil {
+		return nil, err
+	}
+	claims := NewUserClaims(&user, "", now)
+	claims.Roles = apiKey.ScopedRoles(user.Roles)
+	// a key proves no second factor, it cannot act as admin where the organization requires one
+	if slices.Contains(claims.Roles, types.ADMIN) && orgRequiresMFA(ctx, &user) {
+		claims.Roles = withoutAdmin(claims.Roles)
+	}
+	claims.APIKeyID = apiKey.ID
+	claims.ExpiresAt = nil
+	return claims, nil
+}
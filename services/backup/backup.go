@@ -0,0 +1,200 @@
+// Package backup reads and writes the archive of an organization: a zip holding its
+// organization document and every collection of its group database, as concatenated bson
+// documents like mongodump does, plus a manifest.
+package backup
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	FormatVersion    = 1
+	manifestFile     = "manifest.json"
+	organizationFile = "organization.bson"
+	collectionDir    = "collections/"
+)
+
+type CollectionEntry struct {
+	Name  string `json:"name"`
+	File  string `json:"file"`
+	Count int64  `json:"count"`
+}
+
+type Manifest struct {
+	Version     int               `json:"version"`
+	Group       string            `json:"group"`
+	ExportedAt  time.Time         `json:"exportedAt"`
+	Collections []CollectionEntry `json:"collections"`
+}
+
+// Writer streams an archive. Collections are written one after the other, the manifest is
+// written on Close.
+type Writer struct {
+	zw       *zip.Writer
+	manifest Manifest
+	current  *CollectionWriter
+}
+
+type CollectionWriter struct {
+	w     io.Writer
+	entry *CollectionEntry
+}
+
+func NewWriter(w io.Writer, group string, exportedAt time.Time) *Writer {
+	return &Writer{
+		zw:       zip.NewWriter(w),
+		manifest: Manifest{Version: FormatVersion, Group: group, ExportedAt: exportedAt.UTC()},
+	}
+}
+
+func (w *Writer) WriteOrganization(doc bson.Raw) error {
+	f, err := w.zw.Create(organizationFile)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(doc)
+	return err
+}
+
+// Collection starts a new collection, the previous collection writer must not be used anymore.
+func (w *Writer) Collection(name string) (*CollectionWriter, error) {
+	if err := ValidateCollectionName(name); err != nil {
+		return nil, err
+	}
+	file := collectionDir + name + ".bson"
+	f, err := w.zw.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	w.manifest.Collections = append(w.manifest.Collections, CollectionEntry{Name: name, File: file})
+	return &CollectionWriter{w: f, entry: &w.manifest.Collections[len(w.manifest.Collections)-1]}, nil
+}
+
+func (cw *CollectionWriter) Write(doc bson.Raw) error {
+	if _, err := cw.w.Write(doc); err != nil {
+		return err
+	}
+	cw.entry.Count++
+	return nil
+}
+
+// Close writes the manifest and finishes the archive, it doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	f, err := w.zw.Create(manifestFile)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(w.manifest); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+type Reader struct {
+	zr       *zip.Reader
+	Manifest Manifest
+}
+
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	reader := &Reader{zr: zr}
+	f, err := zr.Open(manifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("missing manifest: %w", err)
+	}
+	defer f.Close()
+	if err = json.NewDecoder(f).Decode(&reader.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if reader.Manifest.Version != FormatVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", reader.Manifest.Version)
+	}
+	for _, entry := range reader.Manifest.Collections {
+		if err = ValidateCollectionName(entry.Name); err != nil {
+			return nil, err
+		}
+	}
+	return reader, nil
+}
+
+func (r *Reader) Organization() (bson.Raw, error) {
+	f, err := r.zr.Open(organizationFile)
+	if err != nil {
+		return nil, fmt.Errorf("missing organization: %w", err)
+	}
+	defer f.Close()
+	return bson.NewFromIOReader(f)
+}
+
+// ReadCollection calls fn for every document of the collection, in the order they were written.
+func (r *Reader) ReadCollection(entry CollectionEntry, fn func(bson.Raw) error) error {
+	f, err := r.zr.Open(entry.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var count int64
+	for {
+		doc, err := bson.NewFromIOReader(f)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("collection %s: %w", entry.Name, err)
+		}
+		if err = fn(doc); err != nil {
+			return err
+		}
+		count++
+	}
+	if count != entry.Count {
+		return fmt.Errorf("collection %s: expected %d documents, found %d", entry.Name, entry.Count, count)
+	}
+	return nil
+}
+
+// ValidateCollectionName refuses names mongo would reject or that could escape the archive directory.
+func ValidateCollectionName(name string) error {
+	if name == "" || strings.ContainsAny(name, "$/\\\x00") || strings.HasPrefix(name, "system.") {
+		return fmt.Errorf("invalid collection name %q", name)
+	}
+	return nil
+}
+
+// RewriteGroup replaces the top level group field of the document when it is from, so that the
+// data can be imported under another group.
+func RewriteGroup(doc bson.Raw, from string, to string) (bson.Raw, error) {
+	if from == to {
+		return doc, nil
+	}
+	value, err := doc.LookupErr("group")
+	if err != nil {
+		return doc, nil
+	}
+	if group, ok := value.StringValueOK(); !ok || group != from {
+		return doc, nil
+	}
+	var d bson.D
+	if err := bson.Unmarshal(doc, &d); err != nil {
+		return nil, err
+	}
+	for i := range d {
+		if d[i].Key == "group" {
+			d[i].Value = to
+		}
+	}
+	return bson.Marshal(d)
+}
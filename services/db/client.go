@@ -2,9 +2,8 @@ package db
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log"
-	"slices"
 
 	"github.com/google/uuid"
 	"github.com/nbittich/wtm/config"
@@ -16,12 +15,6 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var (
-	mongoClient    *mongo.Client
-	adminDB        *mongo.Database
-	groupDatabases map[types.Group]*mongo.Database
-)
-
 type PageOptions struct {
 	PageNumber int64                `json:"pageNumber" form:"pageNumber" query:"pageNumber" validate:"required,min=1"`
 	PageSize   int64                `json:"pageSize"   form:"pageSize"   query:"pageSize"   validate:"required,min=1"`
@@ -37,71 +30,6 @@ const (
 	ASC  SortDirection = 1
 )
 
-var mongoSpecificDB = [3]string{"admin", "config", "local"}
-
-func init() {
-	log.Println("connecting to mongo db...")
-	mongoURI := fmt.Sprintf("mongodb://%s:%s@%s:%s", config.MongoUser, config.MongoPassword, config.MongoHost, config.MongoPort)
-	ctx, cancel := context.WithTimeout(context.Background(), config.MongoCtxTimeout)
-	defer cancel()
-	client, err := mongo.Connect(ctx, options.Client().SetMaxPoolSize(uint64(config.MongoMaxConnectionPool)).ApplyURI(mongoURI))
-	if err != nil {
-		panic(fmt.Errorf("could not create mongo client:\n %s", err.Error()))
-	}
-	if err = client.Ping(ctx, nil); err != nil {
-		panic(fmt.Sprintf("could not ping mongo:\n %s", err.Error()))
-	}
-	log.Printf("connected!")
-	mongoClient = client
-	adminDB = mongoClient.Database(config.MongoAdminDBName, &options.DatabaseOptions{})
-	databases, err := mongoClient.ListDatabaseNames(ctx, &bson.M{}, &options.ListDatabasesOptions{})
-	if err != nil {
-		panic(fmt.Errorf("could not list all databases:\n %s", err.Error()))
-	}
-	// cache for the groups
-	groupDatabases = make(map[types.Group]*mongo.Database, len(databases)+len(databases)/2)
-	for _, dbName := range databases {
-		if slices.Contains(mongoSpecificDB[:], dbName) {
-			continue
-		}
-		log.Printf("adding group %s", dbName)
-		group := types.Group(dbName)
-		groupDatabases[group] = mongoClient.Database(dbName, &options.DatabaseOptions{})
-	}
-}
-
-func Disconnect() {
-	ctx, cancel := context.WithTimeout(context.Background(), config.MongoCtxTimeout)
-	defer cancel()
-	if err := mongoClient.Disconnect(ctx); err != nil {
-		panic(err)
-	}
-}
-
-func GetAdminCollection(collectionName string) *mongo.Collection {
-	return adminDB.Collection(collectionName, &options.CollectionOptions{})
-}
-
-func NewGroup(ctx context.Context, group types.Group) error {
-	if _, ok := groupDatabases[group]; ok {
-		return fmt.Errorf("group %s already exist", group)
-	}
-	db := mongoClient.Database(string(group), &options.DatabaseOptions{})
-	// adding the migration collection so that the db is explicitly created
-	if err := db.CreateCollection(ctx, config.MongoMigrationCollection, options.CreateCollection()); err != nil {
-		return err
-	}
-	groupDatabases[group] = db
-	return nil
-}
-
-func GetCollection(collectionName string, group types.Group) (*mongo.Collection, error) {
-	if db, ok := groupDatabases[group]; ok {
-		return db.Collection(collectionName, &options.CollectionOptions{}), nil
-	}
-	return nil, fmt.Errorf("group %s doesn't exist", group)
-}
-
 func FilterByID(id string) primitive.M {
 	return bson.M{"_id": id}
 }
@@ -200,6 +128,18 @@ func Aggregate[T types.HasID](ctx context.Context, col *mongo.Collection, pipeli
 	return CursorToSlice[T](ctx, cursor, resultSize)
 }
 
+// Mongo equivalent of types.BelgianDateTimeFormat
+const mongoBelgianDateTimeFormat = "%d/%m/%Y %H:%M"
+
+// ParseBelgianDateTime parses a date field of an entry in an aggregation.
+func ParseBelgianDateTime(field string) bson.M {
+	return bson.M{"$dateFromString": bson.M{
+		"dateString": field,
+		"format":     mongoBelgianDateTimeFormat,
+		"timezone":   config.TZ,
+	}}
+}
+
 func InsertOrUpdateMany(ctx context.Context, entities []types.Identifiable, collection *mongo.Collection) error {
 	models := make([]mongo.WriteModel, 0, len(entities))
 	for _, entity := range entities {
@@ -214,7 +154,16 @@ func InsertOrUpdateMany(ctx context.Context, entities []types.Identifiable, coll
 	return err
 }
 
+// ErrConflict is returned when a versioned document was modified since it was read.
+var ErrConflict = errors.New("the document was modified meanwhile")
+
+// InsertOrUpdate inserts the entity without id, and replaces, or inserts, the other ones.
+// A types.Versioned entity is only replaced if its version is the stored one, otherwise
+// ErrConflict is returned. Its version is bumped on success.
 func InsertOrUpdate(ctx context.Context, entity types.Identifiable, collection *mongo.Collection) (string, error) {
+	if versioned, ok := entity.(types.Versioned); ok {
+		return insertOrUpdateVersioned(ctx, versioned, collection)
+	}
 	var err error
 	id := entity.GetID()
 	if id == "" {
@@ -230,3 +179,33 @@ func InsertOrUpdate(ctx context.Context, entity types.Identifiable, collection *
 	}
 	return id, err
 }
+
+func insertOrUpdateVersioned(ctx context.Context, entity types.Versioned, collection *mongo.Collection) (id string, err error) {
+	version := entity.GetVersion()
+	entity.SetVersion(version + 1)
+	defer func() {
+		if err != nil {
+			entity.SetVersion(version)
+		}
+	}()
+	if entity.GetID() == "" {
+		entity.SetID(uuid.New().String())
+		_, err = collection.InsertOne(ctx, entity, &options.InsertOneOptions{})
+		return entity.GetID(), err
+	}
+	id = entity.GetID()
+	filter := bson.M{"_id": id, "version": version}
+	if version == 0 {
+		// saved before the version existed
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	res, err := collection.ReplaceOne(ctx, filter, entity, &options.ReplaceOptions{})
+	if err != nil || res.MatchedCount == 1 {
+		return id, err
+	}
+	// either someone else saved it meanwhile, or it doesn't exist yet
+	if _, err = collection.InsertOne(ctx, entity, &options.InsertOneOptions{}); mongo.IsDuplicateKeyError(err) {
+		return id, ErrConflict
+	}
+	return id, err
+}
@@ -0,0 +1,311 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var mongoSpecificDB = [3]string{"admin", "config", "local"}
+
+// Config tells how to reach mongo.
+type Config struct {
+	URI             string
+	AdminDBName     string
+	MaxPoolSize     uint64
+	ConnectTimeout  time.Duration // of each attempt
+	ConnectAttempts int
+	MaxBackoff      time.Duration
+	GroupRefresh    time.Duration // minimum time between two listings of the databases on a cache miss
+}
+
+// ConfigFromEnv returns the configuration from the environment, see package config.
+func ConfigFromEnv() Config {
+	return Config{
+		URI:             fmt.Sprintf("mongodb://%s:%s@%s:%s", config.MongoUser, config.MongoPassword, config.MongoHost, config.MongoPort),
+		AdminDBName:     config.MongoAdminDBName,
+		MaxPoolSize:     uint64(config.MongoMaxConnectionPool),
+		ConnectTimeout:  config.MongoConnectTimeout,
+		ConnectAttempts: config.MongoConnectAttempts,
+		MaxBackoff:      config.MongoConnectMaxBackoff,
+		GroupRefresh:    config.MongoGroupRefresh,
+	}
+}
+
+// Client is a connection to mongo with a cache of the group databases. It is safe for
+// concurrent use. A group unknown to the cache is looked up in mongo, so that the groups
+// created by another instance are picked up.
+type Client struct {
+	mongo        *mongo.Client
+	admin        *mongo.Database
+	groupRefresh time.Duration
+
+	mu          sync.RWMutex
+	groups      map[types.Group]*mongo.Database
+	refreshedAt time.Time
+	refreshing  sync.Mutex // one listing of the databases at a time
+
+	txMu         sync.Mutex
+	transactions *bool // asked once
+}
+
+// Backoff returns the wait before the next attempt: one second after the first one, doubled
+// after each other one, up to max.
+func Backoff(attempt int, max time.Duration) time.Duration {
+	wait := time.Second
+	for i := 1; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+	return min(wait, max)
+}
+
+// Connect connects to mongo and loads the groups. A failed attempt is retried with back-off,
+// up to cfg.ConnectAttempts times or until ctx is done.
+func Connect(ctx context.Context, cfg Config) (*Client, error) {
+	attempts := max(cfg.ConnectAttempts, 1)
+	var err error
+	for attempt := 1; ; attempt++ {
+		var client *Client
+		if client, err = connect(ctx, cfg); err == nil {
+			return client, nil
+		}
+		if attempt == attempts {
+			break
+		}
+		wait := Backoff(attempt, cfg.MaxBackoff)
+		log.Printf("could not connect to mongo (attempt %d/%d), retrying in %s: %s", attempt, attempts, wait, err)
+		select {
+		case <-ctx.Done():
+			return nil, errors.Join(err, ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+	return nil, fmt.Errorf("could not connect to mongo after %d attempts: %w", attempts, err)
+}
+
+func connect(ctx context.Context, cfg Config) (*Client, error) {
+	log.Println("connecting to mongo db...")
+	ctx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().SetMaxPoolSize(cfg.MaxPoolSize).ApplyURI(cfg.URI))
+	if err != nil {
+		return nil, fmt.Errorf("could not create mongo client: %w", err)
+	}
+	c := &Client{
+		mongo:        client,
+		admin:        client.Database(cfg.AdminDBName, &options.DatabaseOptions{}),
+		groupRefresh: cfg.GroupRefresh,
+		groups:       map[types.Group]*mongo.Database{},
+	}
+	if err = client.Ping(ctx, nil); err != nil {
+		err = fmt.Errorf("could not ping mongo: %w", err)
+	} else {
+		err = c.RefreshGroups(ctx)
+	}
+	if err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, err
+	}
+	log.Printf("connected!")
+	return c, nil
+}
+
+func (c *Client) Disconnect(ctx context.Context) error {
+	return c.mongo.Disconnect(ctx)
+}
+
+// Mongo returns the driver client, e.g. to start a session.
+func (c *Client) Mongo() *mongo.Client {
+	return c.mongo
+}
+
+// SupportsTransactions tells whether the deployment is a replica set or a sharded cluster, a
+// standalone server cannot run transactions. The answer is kept once the server replied.
+func (c *Client) SupportsTransactions(ctx context.Context) bool {
+	c.txMu.Lock()
+	defer c.txMu.Unlock()
+	if c.transactions != nil {
+		return *c.transactions
+	}
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := c.admin.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		log.Println("could not tell whether mongo supports transactions", err)
+		return false
+	}
+	supported := hello.SetName != "" || hello.Msg == "isdbgrid"
+	c.transactions = &supported
+	return supported
+}
+
+func (c *Client) AdminDatabase() *mongo.Database {
+	return c.admin
+}
+
+func (c *Client) AdminCollection(collectionName string) *mongo.Collection {
+	return c.admin.Collection(collectionName, &options.CollectionOptions{})
+}
+
+// RefreshGroups lists the databases to add the groups created, and remove the groups dropped,
+// by the other instances. A group added meanwhile by this instance is kept.
+func (c *Client) RefreshGroups(ctx context.Context) error {
+	c.mu.RLock()
+	known := slices.Collect(maps.Keys(c.groups))
+	c.mu.RUnlock()
+
+	names, err := c.mongo.ListDatabaseNames(ctx, &bson.M{}, &options.ListDatabasesOptions{})
+	if err != nil {
+		return fmt.Errorf("could not list all databases: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, group := range known {
+		if !slices.Contains(names, string(group)) {
+			log.Printf("removing group %s", group)
+			delete(c.groups, group)
+		}
+	}
+	for _, dbName := range names {
+		group := types.Group(dbName)
+		if _, ok := c.groups[group]; ok || c.reserved(dbName) {
+			continue
+		}
+		log.Printf("adding group %s", dbName)
+		c.groups[group] = c.mongo.Database(dbName, &options.DatabaseOptions{})
+	}
+	c.refreshedAt = time.Now()
+	return nil
+}
+
+// reserved tells whether the database belongs to mongo or to the application rather than to a group.
+func (c *Client) reserved(dbName string) bool {
+	return dbName == c.admin.Name() || slices.Contains(mongoSpecificDB[:], dbName)
+}
+
+// groupDatabase returns the database of the group. On a cache miss, the databases are listed
+// again unless they were less than groupRefresh ago.
+func (c *Client) groupDatabase(group types.Group) (*mongo.Database, bool) {
+	if db, ok := c.cachedGroup(group); ok {
+		return db, true
+	}
+	c.refreshing.Lock()
+	defer c.refreshing.Unlock()
+	c.mu.RLock()
+	fresh := time.Since(c.refreshedAt) < c.groupRefresh
+	c.mu.RUnlock()
+	if !fresh {
+		ctx, cancel := context.WithTimeout(context.Background(), config.MongoCtxTimeout)
+		defer cancel()
+		if err := c.RefreshGroups(ctx); err != nil {
+			log.Println("could not refresh the groups", err)
+		}
+	}
+	return c.cachedGroup(group)
+}
+
+func (c *Client) cachedGroup(group types.Group) (*mongo.Database, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	db, ok := c.groups[group]
+	return db, ok
+}
+
+// NewGroup creates the database of the group. When two calls race, in this instance or
+// another one, mongo lets only one of them create it.
+func (c *Client) NewGroup(ctx context.Context, group types.Group) error {
+	if c.reserved(string(group)) {
+		return fmt.Errorf("group %s is a reserved name", group)
+	}
+	if _, ok := c.groupDatabase(group); ok {
+		return fmt.Errorf("group %s already exist", group)
+	}
+	db := c.mongo.Database(string(group), &options.DatabaseOptions{})
+	// adding the migration collection so that the db is explicitly created
+	if err := db.CreateCollection(ctx, config.MongoMigrationCollection, options.CreateCollection()); err != nil {
+		if IsNamespaceExists(err) {
+			return fmt.Errorf("group %s already exist", group)
+		}
+		return err
+	}
+	c.mu.Lock()
+	c.groups[group] = db
+	c.mu.Unlock()
+	if _, err := c.EnsureGroupIndexes(ctx, group); err != nil {
+		return err
+	}
+	return nil
+}
+
+// DropGroup drops the database of the group. There is no way back.
+func (c *Client) DropGroup(ctx context.Context, group types.Group) error {
+	db, ok := c.groupDatabase(group)
+	if !ok {
+		return fmt.Errorf("group %s doesn't exist", group)
+	}
+	if err := db.Drop(ctx); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	delete(c.groups, group)
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Client) GroupDatabase(group types.Group) (*mongo.Database, error) {
+	db, ok := c.groupDatabase(group)
+	if !ok {
+		return nil, fmt.Errorf("group %s doesn't exist", group)
+	}
+	return db, nil
+}
+
+// ListGroups returns the known groups, sorted.
+func (c *Client) ListGroups() []types.Group {
+	c.mu.RLock()
+	groups := slices.Collect(maps.Keys(c.groups))
+	c.mu.RUnlock()
+	slices.Sort(groups)
+	return groups
+}
+
+func (c *Client) GroupExists(group types.Group) bool {
+	_, ok := c.groupDatabase(group)
+	return ok
+}
+
+// ListCollectionNames returns the collections of the group database.
+func (c *Client) ListCollectionNames(ctx context.Context, group types.Group) ([]string, error) {
+	db, err := c.GroupDatabase(group)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListCollectionNames(ctx, bson.M{})
+}
+
+func (c *Client) Collection(collectionName string, group types.Group) (*mongo.Collection, error) {
+	db, err := c.GroupDatabase(group)
+	if err != nil {
+		return nil, err
+	}
+	return db.Collection(collectionName, &options.CollectionOptions{}), nil
+}
+
+// IsNamespaceExists tells whether err is mongo refusing to create an existing collection.
+func IsNamespaceExists(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Name == "NamespaceExists"
+}
@@ -0,0 +1,170 @@
+// Package index compares the indexes a collection declares in code with the ones it has, and
+// creates the missing ones. Indexes that differ are only reported: rebuilding an index on a
+// large collection is left to a migration.
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Spec declares an index. Its name is generated like mongo does, e.g. email_1.
+type Spec struct {
+	Keys        bson.D
+	Unique      bool
+	Sparse      bool
+	ExpireAfter *time.Duration // ttl index, on a single date field
+	// PartialFilter restricts the index to the documents matching it, e.g. a unique index on the
+	// documents in a given state only
+	PartialFilter bson.D
+}
+
+// Ascending returns the keys of an ascending index on the fields, in order.
+func Ascending(fields ...string) bson.D {
+	keys := make(bson.D, 0, len(fields))
+	for _, field := range fields {
+		keys = append(keys, bson.E{Key: field, Value: 1})
+	}
+	return keys
+}
+
+// Name returns the name mongo generates for the keys.
+func (s Spec) Name() string {
+	parts := make([]string, 0, len(s.Keys)*2)
+	for _, key := range s.Keys {
+		parts = append(parts, key.Key, fmt.Sprint(key.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+// Existing is what matters of an index found in the database.
+type Existing struct {
+	Name          string `bson:"name"`
+	Keys          bson.D `bson:"key"`
+	Unique        bool   `bson:"unique"`
+	Sparse        bool   `bson:"sparse"`
+	ExpireAfter   *int32 `bson:"expireAfterSeconds"` // seconds
+	PartialFilter bson.D `bson:"partialFilterExpression"`
+}
+
+// Diff returns the declared indexes missing from the existing ones, and a description of every
+// index that differs from its declaration or is not declared at all.
+func Diff(declared []Spec, existing []Existing) ([]Spec, []string) {
+	byName := make(map[string]Existing, len(existing))
+	for _, e := range existing {
+		byName[e.Name] = e
+	}
+	var missing []Spec
+	var drift []string
+	declaredNames := make([]string, 0, len(declared))
+	for _, spec := range declared {
+		name := spec.Name()
+		declaredNames = append(declaredNames, name)
+		e, ok := byName[name]
+		if !ok {
+			missing = append(missing, spec)
+			continue
+		}
+		if !sameDocument(spec.Keys, e.Keys) {
+			drift = append(drift, fmt.Sprintf("index %s: keys %v instead of %v", name, e.Keys, spec.Keys))
+		}
+		if spec.Unique != e.Unique {
+			drift = append(drift, fmt.Sprintf("index %s: unique is %t instead of %t", name, e.Unique, spec.Unique))
+		}
+		if spec.Sparse != e.Sparse {
+			drift = append(drift, fmt.Sprintf("index %s: sparse is %t instead of %t", name, e.Sparse, spec.Sparse))
+		}
+		if !sameExpiry(spec.ExpireAfter, e.ExpireAfter) {
+			drift = append(drift, fmt.Sprintf("index %s: ttl differs from the declared one", name))
+		}
+		if !sameDocument(spec.PartialFilter, e.PartialFilter) {
+			drift = append(drift, fmt.Sprintf("index %s: partial filter %v instead of %v", name, e.PartialFilter, spec.PartialFilter))
+		}
+	}
+	for _, e := range existing {
+		if e.Name != "_id_" && !slices.Contains(declaredNames, e.Name) {
+			drift = append(drift, fmt.Sprintf("index %s is not declared", e.Name))
+		}
+	}
+	return missing, drift
+}
+
+func sameDocument(a bson.D, b bson.D) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		// the numbers come back as int32 or float64 from mongo
+		if a[i].Key != b[i].Key || fmt.Sprint(a[i].Value) != fmt.Sprint(b[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameExpiry(declared *time.Duration, seconds *int32) bool {
+	if declared == nil || seconds == nil {
+		return declared == nil && seconds == nil
+	}
+	return int32(declared.Seconds()) == *seconds
+}
+
+func model(spec Spec) mongo.IndexModel {
+	opts := options.Index().SetName(spec.Name())
+	if spec.Unique {
+		opts.SetUnique(true)
+	}
+	if spec.Sparse {
+		opts.SetSparse(true)
+	}
+	if spec.ExpireAfter != nil {
+		opts.SetExpireAfterSeconds(int32(spec.ExpireAfter.Seconds()))
+	}
+	if spec.PartialFilter != nil {
+		opts.SetPartialFilterExpression(spec.PartialFilter)
+	}
+	return mongo.IndexModel{Keys: spec.Keys, Options: opts}
+}
+
+func list(ctx context.Context, collection *mongo.Collection) ([]Existing, error) {
+	// read as raw documents, the specifications of the driver lack the partial filter
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		// the collection doesn't exist yet, creating its indexes creates it
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && cmdErr.Name == "NamespaceNotFound" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var existing []Existing
+	if err = cursor.All(ctx, &existing); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// Ensure creates the missing indexes of the collection and returns the drift found.
+func Ensure(ctx context.Context, collection *mongo.Collection, declared []Spec) ([]string, error) {
+	existing, err := list(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	missing, drift := Diff(declared, existing)
+	// one by one, so that an index failing, e.g. unique on duplicated values, doesn't prevent the others
+	var errs []error
+	for _, spec := range missing {
+		if _, err = collection.Indexes().CreateOne(ctx, model(spec)); err != nil {
+			errs = append(errs, fmt.Errorf("could not create index %s of %s: %w", spec.Name(), collection.Name(), err))
+		}
+	}
+	return drift, errors.Join(errs...)
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/nbittich/wtm/services/db/index"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// the indexes declared by the services, per collection name
+var (
+	groupIndexes = map[string][]index.Spec{}
+	adminIndexes = map[string][]index.Spec{}
+)
+
+// RegisterGroupIndexes declares the indexes of a collection of every group database.
+// It is meant to be called from the init function of the package owning the collection.
+func RegisterGroupIndexes(collectionName string, specs ...index.Spec) {
+	groupIndexes[collectionName] = append(groupIndexes[collectionName], specs...)
+}
+
+// RegisterAdminIndexes declares the indexes of a collection of the admin database.
+func RegisterAdminIndexes(collectionName string, specs ...index.Spec) {
+	adminIndexes[collectionName] = append(adminIndexes[collectionName], specs...)
+}
+
+func ensureIndexes(ctx context.Context, database *mongo.Database, declared map[string][]index.Spec) ([]string, error) {
+	names := make([]string, 0, len(declared))
+	for name := range declared {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var drift []string
+	var errs []error
+	for _, name := range names {
+		collectionDrift, err := index.Ensure(ctx, database.Collection(name), declared[name])
+		for _, d := range collectionDrift {
+			drift = append(drift, fmt.Sprintf("%s.%s: %s", database.Name(), name, d))
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", database.Name(), err))
+		}
+	}
+	return drift, errors.Join(errs...)
+}
+
+// EnsureGroupIndexes creates the missing indexes of a group database and returns the drift.
+func (c *Client) EnsureGroupIndexes(ctx context.Context, group types.Group) ([]string, error) {
+	database, err := c.GroupDatabase(group)
+	if err != nil {
+		return nil, err
+	}
+	return ensureIndexes(ctx, database, groupIndexes)
+}
+
+// EnsureAllIndexes creates the missing indexes of the admin database and of every group database.
+// The admin database is never listed as a group, so it only gets the admin indexes. A failure, like a unique index on duplicated values, doesn't stop the other collections.
+func (c *Client) EnsureAllIndexes(ctx context.Context) ([]string, error) {
+	drift, err := ensureIndexes(ctx, c.admin, adminIndexes)
+	errs := []error{err}
+	for _, group := range c.ListGroups() {
+		groupDrift, err := c.EnsureGroupIndexes(ctx, group)
+		drift = append(drift, groupDrift...)
+		errs = append(errs, err)
+	}
+	return drift, errors.Join(errs...)
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"slices"
+
+	"github.com/nbittich/wtm/services/db/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// FindPage returns a page of the documents selected by the filter stages, with their total count.
+// The stages may also add the computed fields used by the sort.
+func FindPage[T any](ctx context.Context, collection *mongo.Collection, stages mongo.Pipeline, page query.Page) (query.Result[T], error) {
+	result := query.Result[T]{Items: []T{}}
+
+	countCursor, err := collection.Aggregate(ctx, append(slices.Clone(stages), bson.D{{Key: "$count", Value: "total"}}))
+	if err != nil {
+		return result, err
+	}
+	var counts []struct {
+		Total int64 `bson:"total"`
+	}
+	if err = countCursor.All(ctx, &counts); err != nil {
+		return result, err
+	}
+	if len(counts) == 0 {
+		return result, nil
+	}
+	result.Total = counts[0].Total
+
+	cursor, err := collection.Aggregate(ctx, append(slices.Clone(stages), page.Stages()...))
+	if err != nil {
+		return result, err
+	}
+	var docs []bson.Raw
+	if err = cursor.All(ctx, &docs); err != nil {
+		return result, err
+	}
+	if docs, result.NextCursor, err = page.Next(docs); err != nil {
+		return result, err
+	}
+	result.Items = make([]T, 0, len(docs))
+	for _, doc := range docs {
+		var item T
+		if err = bson.Unmarshal(doc, &item); err != nil {
+			return result, err
+		}
+		result.Items = append(result.Items, item)
+	}
+	return result, nil
+}
@@ -0,0 +1,161 @@
+// Package query pages through the documents with opaque cursors. A page is the documents after
+// the cursor in the order of a whitelisted sort, the _id breaking the ties. Unlike skip/limit,
+// a page doesn't shift when documents are added before it.
+//
+// The sort fields must be set on every document, a missing one cannot be compared to a cursor.
+package query
+
+import (
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+const (
+	DefaultLimit int64 = 50
+	MaxLimit     int64 = 200
+)
+
+// Spec declares how a list can be sorted.
+type Spec struct {
+	// Sorts maps the names accepted in the sort param to the fields of the documents.
+	Sorts map[string]string
+	// DefaultSort is used without sort param, prefixed with "-" for descending.
+	DefaultSort string
+}
+
+// Page is a parsed request for a page.
+type Page struct {
+	Sort  string // as requested, e.g. "-createdAt"
+	Field string
+	Desc  bool
+	Limit int64
+	After *Cursor
+}
+
+// Cursor is the position after the last document of a page.
+type Cursor struct {
+	Sort  string        `bson:"s"`
+	Value bson.RawValue `bson:"v"`
+	ID    string        `bson:"i"`
+}
+
+// Result is the envelope of a page.
+type Result[T any] struct {
+	Items []T `json:"items"`
+	// Total is the count of all the documents selected by the filters
+	Total int64 `json:"total"`
+	// NextCursor is empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+func (c Cursor) Encode() (string, error) {
+	raw, err := bson.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor")
+	}
+	if err = bson.Unmarshal(raw, &c); err != nil || c.ID == "" || !sortable(c.Value) {
+		return c, fmt.Errorf("invalid cursor")
+	}
+	return c, nil
+}
+
+// sortable tells whether the value can be the one of a sort field. The cursor comes from the
+// client and its value ends up in a $match: a document or an array could smuggle operators in.
+func sortable(value bson.RawValue) bool {
+	switch value.Type {
+	case bsontype.String, bsontype.Int32, bsontype.Int64, bsontype.Double, bsontype.Decimal128,
+		bsontype.DateTime, bsontype.Boolean, bsontype.ObjectID:
+		return value.Validate() == nil
+	default:
+		return false
+	}
+}
+
+// Parse reads the sort, limit and cursor params. Empty ones take their default. The cursor must
+// come from a page with the same sort.
+func (s Spec) Parse(sort string, limit string, cursor string) (Page, error) {
+	page := Page{Sort: sort, Limit: DefaultLimit}
+	if page.Sort == "" {
+		page.Sort = s.DefaultSort
+	}
+	name, desc := strings.CutPrefix(page.Sort, "-")
+	field, ok := s.Sorts[name]
+	if !ok {
+		return page, fmt.Errorf("cannot sort by %s, expected one of %s", name, strings.Join(slices.Sorted(maps.Keys(s.Sorts)), ", "))
+	}
+	page.Field, page.Desc = field, desc
+	if limit != "" {
+		l, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || l < 1 || l > MaxLimit {
+			return page, fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+		}
+		page.Limit = l
+	}
+	if cursor != "" {
+		after, err := DecodeCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+		if after.Sort != page.Sort {
+			return page, fmt.Errorf("the cursor was made for the sort %s", after.Sort)
+		}
+		page.After = &after
+	}
+	return page, nil
+}
+
+// Stages returns the stages selecting the page, to append to the ones filtering the documents.
+// One more document than the limit is fetched, to tell whether there is a next page.
+func (p Page) Stages() []bson.D {
+	op, direction := "$gt", 1
+	if p.Desc {
+		op, direction = "$lt", -1
+	}
+	stages := make([]bson.D, 0, 3)
+	if p.After != nil {
+		stages = append(stages, bson.D{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{p.Field: bson.M{op: p.After.Value}},
+			bson.M{p.Field: p.After.Value, "_id": bson.M{op: p.After.ID}},
+		}}}})
+	}
+	return append(stages,
+		bson.D{{Key: "$sort", Value: bson.D{{Key: p.Field, Value: direction}, {Key: "_id", Value: direction}}}},
+		bson.D{{Key: "$limit", Value: p.Limit + 1}},
+	)
+}
+
+// Next drops the extra document fetched by Stages, and returns the cursor of the next page,
+// empty when this one is the last.
+func (p Page) Next(docs []bson.Raw) ([]bson.Raw, string, error) {
+	if int64(len(docs)) <= p.Limit {
+		return docs, "", nil
+	}
+	docs = docs[:p.Limit]
+	last := docs[len(docs)-1]
+	value, err := last.LookupErr(strings.Split(p.Field, ".")...)
+	if err != nil {
+		return nil, "", fmt.Errorf("sort field %s missing: %w", p.Field, err)
+	}
+	id, ok := last.Lookup("_id").StringValueOK()
+	if !ok {
+		return nil, "", fmt.Errorf("the documents must have a string _id")
+	}
+	next, err := Cursor{Sort: p.Sort, Value: value, ID: id}.Encode()
+	return docs, next, err
+}
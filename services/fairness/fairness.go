@@ -0,0 +1,149 @@
+package fairness
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nbittich/wtm/services/payroll"
+	"github.com/nbittich/wtm/types"
+)
+
+// minNightHours is how much of a shift must fall within the night window to make it a night shift.
+const minNightHours = 1
+
+// AssignedShift is a slot assigned to an employee, Unpopular comes from the planning entry.
+type AssignedShift struct {
+	EmployeeID string
+	Start      time.Time
+	End        time.Time
+	Unpopular  bool
+}
+
+// Classify returns the kinds of an assigned shift, using the night window and public holidays of the payroll rules.
+func Classify(rules types.PayrollRules, start time.Time, end time.Time, unpopular bool) []types.ShiftKind {
+	kinds := make([]types.ShiftKind, 0, len(types.ShiftKinds))
+	if weekDay := start.Weekday(); weekDay == time.Saturday || weekDay == time.Sunday {
+		kinds = append(kinds, types.WeekendShift)
+	}
+	if payroll.NightHours(rules, start, end) >= minNightHours {
+		kinds = append(kinds, types.NightShift)
+	}
+	if slices.Contains(rules.PublicHolidays, start.Format(types.BelgianDateFormat)) {
+		kinds = append(kinds, types.HolidayShift)
+	}
+	if unpopular {
+		kinds = append(kinds, types.UnpopularShift)
+	}
+	return kinds
+}
+
+// Tracker keeps the running counts of every user, so that shifts can be handed out to whoever
+// has the lowest score.
+type Tracker struct {
+	rules   types.PayrollRules
+	weights types.FairnessWeights
+	lines   map[string]*types.FairnessLine
+}
+
+func NewTracker(rules types.PayrollRules, weights types.FairnessWeights) *Tracker {
+	return &Tracker{rules: rules, weights: weights, lines: make(map[string]*types.FairnessLine)}
+}
+
+func (tracker *Tracker) line(userID string) *types.FairnessLine {
+	line, ok := tracker.lines[userID]
+	if !ok {
+		line = &types.FairnessLine{UserID: userID, Counts: make(map[types.ShiftKind]int, len(types.ShiftKinds))}
+		for _, kind := range types.ShiftKinds {
+			line.Counts[kind] = 0
+		}
+		tracker.lines[userID] = line
+	}
+	return line
+}
+
+func (tracker *Tracker) penalty(kinds []types.ShiftKind) float64 {
+	var penalty float64
+	for _, kind := range kinds {
+		penalty += tracker.weights[kind]
+	}
+	return penalty
+}
+
+// Add records a shift for a user.
+func (tracker *Tracker) Add(shift AssignedShift) {
+	kinds := Classify(tracker.rules, shift.Start, shift.End, shift.Unpopular)
+	line := tracker.line(shift.EmployeeID)
+	line.Shifts++
+	for _, kind := range kinds {
+		line.Counts[kind]++
+	}
+	line.Score += tracker.penalty(kinds)
+}
+
+func (tracker *Tracker) Score(userID string) float64 {
+	return tracker.line(userID).Score
+}
+
+// Pick chooses n candidates for the shift: the lowest scores first when the shift has a penalty,
+// the fewest shifts first otherwise. Ties keep the candidates order. The shift is recorded for them.
+func (tracker *Tracker) Pick(candidates []string, n int, start time.Time, end time.Time, unpopular bool) []string {
+	kinds := Classify(tracker.rules, start, end, unpopular)
+	penalized := tracker.penalty(kinds) > 0
+	sorted := slices.Clone(candidates)
+	slices.SortStableFunc(sorted, func(a, b string) int {
+		la, lb := tracker.line(a), tracker.line(b)
+		if penalized {
+			return cmp.Or(cmp.Compare(la.Score, lb.Score), cmp.Compare(la.Shifts, lb.Shifts))
+		}
+		return cmp.Or(cmp.Compare(la.Shifts, lb.Shifts), cmp.Compare(la.Score, lb.Score))
+	})
+	picked := sorted[:min(n, len(sorted))]
+	for _, userID := range picked {
+		tracker.Add(AssignedShift{EmployeeID: userID, Start: start, End: end, Unpopular: unpopular})
+	}
+	return picked
+}
+
+// Report returns one line per user seen by the tracker, sorted by descending score, and the
+// fairness index of every kind of shift.
+func (tracker *Tracker) Report(from time.Time, to time.Time, users []types.User) types.FairnessReport {
+	report := types.FairnessReport{
+		From:  from.Format(types.BelgianDateFormat),
+		To:    to.AddDate(0, 0, -1).Format(types.BelgianDateFormat),
+		Lines: make([]types.FairnessLine, 0, len(tracker.lines)),
+		Index: make(map[types.ShiftKind]float64, len(types.ShiftKinds)),
+	}
+	for _, user := range users {
+		tracker.line(user.ID).Label = user.Username
+	}
+	for _, line := range tracker.lines {
+		report.Lines = append(report.Lines, *line)
+	}
+	slices.SortFunc(report.Lines, func(a, b types.FairnessLine) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), strings.Compare(a.Label, b.Label))
+	})
+	for _, kind := range types.ShiftKinds {
+		counts := make([]float64, 0, len(report.Lines))
+		for _, line := range report.Lines {
+			counts = append(counts, float64(line.Counts[kind]))
+		}
+		report.Index[kind] = JainIndex(counts)
+	}
+	return report
+}
+
+// JainIndex is (Σx)² / (n·Σx²). It is 1 when nobody got any.
+func JainIndex(values []float64) float64 {
+	var sum, sumSquares float64
+	for _, v := range values {
+		sum += v
+		sumSquares += v * v
+	}
+	if sumSquares == 0 {
+		return 1
+	}
+	return math.Round(sum*sum/(float64(len(values))*sumSquares)*10000) / 10000
+}
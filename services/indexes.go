@@ -0,0 +1,64 @@
+package services
+
+import (
+	"time"
+
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/db/index"
+)
+
+// expired documents are deleted by mongo once expiresAt is past
+var expireAtDate = time.Duration(0)
+
+func init() {
+	db.RegisterGroupIndexes(UserCollection,
+		index.Spec{Keys: index.Ascending("email"), Unique: true},
+		index.Spec{Keys: index.Ascending("username"), Unique: true},
+		index.Spec{Keys: index.Ascending("oidcSubject"), Unique: true, Sparse: true},
+	)
+	db.RegisterGroupIndexes(UserActivationURLCollection,
+		index.Spec{Keys: index.Ascending("hash")},
+		index.Spec{Keys: index.Ascending("userId")},
+	)
+	db.RegisterGroupIndexes(EmailChangeTokenCollection,
+		index.Spec{Keys: index.Ascending("hash")},
+		index.Spec{Keys: index.Ascending("userId")},
+		index.Spec{Keys: index.Ascending("expiresAt"), ExpireAfter: &expireAtDate},
+	)
+	db.RegisterGroupIndexes(SessionCollection,
+		index.Spec{Keys: index.Ascending("userId")},
+		index.Spec{Keys: index.Ascending("refreshHash")},
+		index.Spec{Keys: index.Ascending("previousRefreshHash"), Sparse: true},
+	)
+	db.RegisterGroupIndexes(PasswordResetTokenCollection,
+		index.Spec{Keys: index.Ascending("hash")},
+		index.Spec{Keys: index.Ascending("userId")},
+	)
+	db.RegisterGroupIndexes(APIKeyCollection,
+		index.Spec{Keys: index.Ascending("hash"), Unique: true},
+		index.Spec{Keys: index.Ascending("userId")},
+	)
+	db.RegisterGroupIndexes(InvitationCollection,
+		index.Spec{Keys: index.Ascending("hash")},
+		index.Spec{Keys: index.Ascending("email")},
+	)
+	db.RegisterGroupIndexes(MFAChallengeCollection,
+		index.Spec{Keys: index.Ascending("hash")},
+		index.Spec{Keys: index.Ascending("expiresAt"), ExpireAfter: &expireAtDate},
+	)
+	db.RegisterGroupIndexes(OIDCStateCollection,
+		index.Spec{Keys: index.Ascending("hash")},
+		index.Spec{Keys: index.Ascending("expiresAt"), ExpireAfter: &expireAtDate},
+	)
+
+	db.RegisterAdminIndexes(OrganizationCollection,
+		index.Spec{Keys: index.Ascending("group"), Unique: true},
+	)
+	db.RegisterAdminIndexes(LoginThrottleCollection,
+		index.Spec{Keys: index.Ascending("unlockHash"), Sparse: true},
+		index.Spec{Keys: index.Ascending("group"), Sparse: true},
+	)
+	db.RegisterAdminIndexes(RateLimitCollection,
+		index.Spec{Keys: index.Ascending("expiresAt"), ExpireAfter: &expireAtDate},
+	)
+}
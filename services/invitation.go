@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/email"
+	"github.com/nbittich/wtm/services/utils"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const InvitationCollection = "invitation"
+
+// InviteUser emails an invitation link to join the organization. A pending invitation to the same
+// address is replaced.
+func InviteUser(ctx context.Context, form *types.InvitationForm, group types.Group, invitedBy string) (*types.Invitation, error) {
+	if err := utils.ValidateStruct(form); err != nil {
+		return nil, err
+	}
+	userCollection, err := dbClient.Collection(UserCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	collection, err := dbClient.Collection(InvitationCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	if exist, err := db.Exist(ctx, bson.M{"email": form.Email}, userCollection); err != nil || exist {
+		if err != nil {
+			return nil, err
+		}
+		return nil, types.InvalidFormError{Form: form, Messages: types.InvalidMessage{"general": "home.signup.user.exist"}}
+	}
+	if _, err = collection.DeleteMany(ctx, bson.M{"email": form.Email, "acceptedAt": nil}); err != nil {
+		return nil, err
+	}
+	role := types.USER
+	if form.Role != nil {
+		role = *form.Role
+	}
+	invitation := types.Invitation{
+		Email:     form.Email,
+		FirstName: form.FirstName,
+		LastName:  form.LastName,
+		Role:      role,
+		Group:     group,
+		InvitedBy: invitedBy,
+	}
+	if err = sendInvitation(ctx, &invitation, collection); err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// sendInvitation renews the token and the expiry of the invitation, saves it and emails the link.
+func sendInvitation(ctx context.Context, invitation *types.Invitation, collection *mongo.Collection) error {
+	token, hash, err := generateToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	invitation.Hash = hash
+	invitation.CreatedAt = now
+	invitation.ExpiresAt = now.Add(config.InvitationExpiration)
+	if _, err = db.InsertOrUpdate(ctx, invitation, collection); err != nil {
+		return err
+	}
+	// the link opens the form of acceptInvitationPageHandler
+	acceptURL := fmt.Sprintf("%s/users/invitation/accept?token=%s&group=%s", config.BaseURL, url.QueryEscape(token), url.QueryEscape(string(invitation.Group)))
+	go email.SendAsync([]string{invitation.Email}, []string{}, utils.Translate(ctx, "email.invitation.subject"),
+		fmt.Sprintf(`<p>%s</p><a href="%s">%s</a>`, utils.Translate(ctx, "email.invitation.body"), acceptURL, utils.Translate(ctx, "email.invitation.action")))
+	return nil
+}
+
+// ResendInvitation sends a new link for an invitation not accepted yet, the previous link stops working.
+func ResendInvitation(ctx context.Context, invitationID string, group types.Group) (*types.Invitation, error) {
+	collection, err := dbClient.Collection(InvitationCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	invitation, err := db.FindOneByID[types.Invitation](ctx, collection, invitationID)
+	if err != nil {
+		return nil, err
+	}
+	if invitation.AcceptedAt != nil {
+		return nil, fmt.Errorf("invitation already accepted")
+	}
+	if err = sendInvitation(ctx, &invitation, collection); err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func FindPendingInvitations(ctx context.Context, group types.Group) ([]types.Invitation, error) {
+	collection, err := dbClient.Collection(InvitationCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	return db.Find[types.Invitation](ctx, bson.M{"acceptedAt": nil}, collection, nil)
+}
+
+func DeleteInvitation(ctx context.Context, invitationID string, group types.Group) error {
+	collection, err := dbClient.Collection(InvitationCollection, group)
+	if err != nil {
+		return err
+	}
+	_, err = collection.DeleteOne(ctx, bson.M{"_id": invitationID, "acceptedAt": nil})
+	return err
+}
+
+// AcceptInvitation creates the invited user, enabled at once since the email was proven by the link.
+func AcceptInvitation(ctx context.Context, form *types.AcceptInvitationForm) (*types.User, error) {
+	if err := utils.ValidateStruct(form); err != nil {
+		return nil, err
+	}
+	group := types.Group(form.Group)
+	invalid := types.InvalidFormError{Form: form, Messages: types.InvalidMessage{"general": "home.invitation.invalid"}}
+	collection, err := dbClient.Collection(InvitationCollection, group)
+	if err != nil {
+		return nil, invalid
+	}
+	userCollection, err := dbClient.Collection(UserCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	invitation, err := db.FindOneBy[types.Invitation](ctx, bson.M{"hash": hashToken(form.Token)}, collection)
+	if err != nil {
+		return nil, invalid
+	}
+	now := time.Now()
+	if invitation.AcceptedAt != nil || now.After(invitation.ExpiresAt) {
+		return nil, invalid
+	}
+	exist, err := db.Exist(ctx, bson.M{"$or": []bson.M{{"email": invitation.Email}, {"username": form.Username}}}, userCollection)
+	if err != nil {
+		return nil, err
+	}
+	if exist {
+		return nil, types.InvalidFormError{Form: form, Messages: types.InvalidMessage{"general": "home.signup.user.exist"}}
+	}
+	password, err := hashPassword(form.Password)
+	if err != nil {
+		return nil, err
+	}
+	roles := []types.Role{types.USER}
+	if invitation.Role != types.USER {
+		roles = append(roles, invitation.Role)
+	}
+	lang, _ := ctx.Value(types.LangKey).(string)
+	user := types.User{
+		Username: form.Username,
+		Password: &password,
+		Email:    invitation.Email,
+		Enabled:  true,
+		Settings: types.UserSetting{Lang: lang},
+		Profile:  types.UserProfile{FirstName: invitation.FirstName, LastName: invitation.LastName},
+		Roles:    roles,
+		Group:    &group,
+	}
+	// the user is inserted before the invitation is accepted, so that a failed insert leaves the
+	// invitation usable. A concurrent request with the same token fails on the unique email, or
+	// on the acceptance below, in which case its user is removed.
+	if _, err = db.InsertOrUpdate(ctx, &user, userCollection); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, types.InvalidFormError{Form: form, Messages: types.InvalidMessage{"general": "home.signup.user.exist"}}
+		}
+		return nil, err
+	}
+	res, err := collection.UpdateOne(ctx, bson.M{"_id": invitation.ID, "acceptedAt": nil}, bson.M{"$set": bson.M{"acceptedAt": now, "userId": user.ID}})
+	if err != nil || res.ModifiedCount == 0 {
+		if _, deleteErr := userCollection.DeleteOne(context.WithoutCancel(ctx), db.FilterByID(user.ID)); deleteErr != nil {
+			log.Println("could not remove the user of a failed invitation", user.ID, deleteErr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return nil, invalid
+	}
+	return &user, nil
+}
@@ -0,0 +1,224 @@
+package jwks
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"maps"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// Key is a signing key identified by its kid.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+}
+
+// KeySet signs with its active key and verifies with any of its keys, so that tokens signed
+// before a rotation stay valid until they expire.
+type KeySet struct {
+	keys   map[string]*Key
+	active *Key
+}
+
+// JSONWebKey is the public part of a key, as published in the jwks.
+type JSONWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+func methodOf(signer crypto.Signer) (jwt.SigningMethod, error) {
+	switch signer.(type) {
+	case *rsa.PrivateKey:
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PrivateKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", signer)
+	}
+}
+
+// NewKey wraps a private key, the signing method is deduced from its type.
+func NewKey(kid string, signer crypto.Signer) (*Key, error) {
+	method, err := methodOf(signer)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{ID: kid, Method: method, Private: signer}, nil
+}
+
+// NewKeySet returns a set signing with the key activeID. When empty, the last kid in lexical order is
+// used, which is the newest one for kids generated by NewKeyID.
+func NewKeySet(keys []*Key, activeID string) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing key")
+	}
+	ks := &KeySet{keys: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		if _, exist := ks.keys[key.ID]; exist {
+			return nil, fmt.Errorf("duplicate kid %s", key.ID)
+		}
+		ks.keys[key.ID] = key
+	}
+	if activeID == "" {
+		activeID = slices.Max(slices.Collect(maps.Keys(ks.keys)))
+	}
+	active, ok := ks.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active key %s not found", activeID)
+	}
+	ks.active = active
+	return ks, nil
+}
+
+// LoadDirectory reads every <kid>.pem file of dir, PKCS8 private keys.
+func LoadDirectory(dir string, activeID string) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*Key, 0, len(files))
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := DecodePEM(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		key, err := NewKey(strings.TrimSuffix(filepath.Base(file), ".pem"), signer)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		keys = append(keys, key)
+	}
+	return NewKeySet(keys, activeID)
+}
+
+// GenerateKey creates a new private key for the algorithm, RS256 or EdDSA.
+func GenerateKey(alg string) (crypto.Signer, error) {
+	switch alg {
+	case RS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case EdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, err
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %s", alg)
+	}
+}
+
+// NewKeyID returns a kid starting with the date, so that newer keys sort last.
+func NewKeyID(now time.Time) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%x", now.UTC().Format("20060102T150405"), b), nil
+}
+
+func EncodePEM(signer crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func DecodePEM(content []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("no pem block found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return signer, nil
+}
+
+// Sign signs the claims with the active key, its kid goes in the header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.Private)
+}
+
+// Keyfunc returns the public key matching the kid of the token, after checking its algorithm.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %s", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for kid %s", token.Method.Alg(), kid)
+	}
+	return key.Private.Public(), nil
+}
+
+// JWKS returns the public keys, the active one first.
+func (ks *KeySet) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{ks.active.jwk()}}
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		if kid != ks.active.ID {
+			kids = append(kids, kid)
+		}
+	}
+	slices.Sort(kids)
+	for _, kid := range slices.Backward(kids) {
+		set.Keys = append(set.Keys, ks.keys[kid].jwk())
+	}
+	return set
+}
+
+func (key *Key) jwk() JSONWebKey {
+	jwk := JSONWebKey{Kid: key.ID, Alg: key.Method.Alg(), Use: "sig"}
+	switch public := key.Private.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
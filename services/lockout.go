@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/email"
+	"github.com/nbittich/wtm/services/throttle"
+	"github.com/nbittich/wtm/services/utils"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// the counters are in the admin database: an ip address may try several organizations
+const (
+	LoginThrottleCollection = "loginThrottle"
+	RateLimitCollection     = "rateLimit"
+)
+
+// LoginThrottledError is returned when a login is refused before checking the password.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("account locked, retry after %s", e.RetryAfter)
+	}
+	return fmt.Sprintf("too many attempts, retry after %s", e.RetryAfter)
+}
+
+var (
+	userLoginPolicy = throttle.Policy{
+		FreeAttempts: config.LoginFreeAttempts,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		LockAfter:    config.LoginLockAfter,
+		LockDuration: config.LoginLockDuration,
+		ResetAfter:   config.LoginLockDuration,
+	}
+	ipLoginPolicy = throttle.Policy{
+		FreeAttempts: config.LoginIPMaxFailures / 5,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		LockAfter:    config.LoginIPMaxFailures,
+		LockDuration: config.LoginLockDuration,
+		ResetAfter:   time.Hour,
+	}
+)
+
+func userThrottleKey(userID string, group types.Group) string {
+	return fmt.Sprintf("user:%s:%s", group, userID)
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+func throttleState(t types.LoginThrottle) throttle.State {
+	return throttle.State{Failures: t.Failures, LastFailureAt: t.LastFailureAt, LockedUntil: t.LockedUntil}
+}
+
+func checkThrottle(ctx context.Context, key string, policy throttle.Policy, now time.Time) error {
+	t, err := db.FindOneByID[types.LoginThrottle](ctx, dbClient.AdminCollection(LoginThrottleCollection), key)
+	if err != nil {
+		return nil
+	}
+	if wait, locked := policy.Check(throttleState(t), now); wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait, Locked: locked}
+	}
+	return nil
+}
+
+// CheckLogin refuses the attempt when the ip address or the user must still wait. user is nil when unknown.
+func CheckLogin(ctx context.Context, ip string, user *types.User) error {
+	now := time.Now()
+	if err := checkThrottle(ctx, ipThrottleKey(ip), ipLoginPolicy, now); err != nil {
+		return err
+	}
+	if user != nil {
+		return checkThrottle(ctx, userThrottleKey(user.ID, *user.Group), userLoginPolicy, now)
+	}
+	return nil
+}
+
+// recordFailure increments the counter of the key and locks it once the threshold is reached.
+// It returns true when this failure locked the key.
+func recordFailure(ctx context.Context, key string, policy throttle.Policy, user *types.User, now time.Time) (bool, error) {
+	collection := dbClient.AdminCollection(LoginThrottleCollection)
+	// forget old failures first
+	if _, err := collection.UpdateOne(ctx, bson.M{
+		"_id":           key,
+		"lastFailureAt": bson.M{"$lt": now.Add(-policy.ResetAfter)},
+		"$or":           []bson.M{{"lockedUntil": nil}, {"lockedUntil": bson.M{"$lte": now}}},
+	}, bson.M{"$set": bson.M{"failures": 0}, "$unset": bson.M{"lockedUntil": "", "unlockHash": ""}}); err != nil {
+		return false, err
+	}
+	setOnInsert := bson.M{}
+	if user != nil {
+		setOnInsert = bson.M{"userId": user.ID, "group": *user.Group}
+	}
+	var t types.LoginThrottle
+	if err := collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, bson.M{
+		"$inc":         bson.M{"failures": 1},
+		"$set":         bson.M{"lastFailureAt": now},
+		"$setOnInsert": setOnInsert,
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&t); err != nil {
+		return false, err
+	}
+	if !policy.ShouldLock(t.Failures) || (t.LockedUntil != nil && now.Before(*t.LockedUntil)) {
+		return false, nil
+	}
+	set := bson.M{"lockedUntil": now.Add(policy.LockDuration)}
+	var unlockToken string
+	if user != nil {
+		token, hash, err := generateToken()
+		if err != nil {
+			return false, err
+		}
+		unlockToken = token
+		set["unlockHash"] = hash
+	}
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": set}); err != nil {
+		return false, err
+	}
+	if user != nil {
+		sendUnlockEmail(ctx, user, unlockToken)
+	}
+	return true, nil
+}
+
+func sendUnlockEmail(ctx context.Context, user *types.User, token string) {
+	unlockURL := fmt.Sprintf("%s/users/unlock?token=%s&group=%s", config.BaseURL, url.QueryEscape(token), url.QueryEscape(string(*user.Group)))
+	go email.SendAsync([]string{user.Email}, []string{}, utils.Translate(ctx, "email.accountLocked.subject"),
+		fmt.Sprintf(`<p>%s</p><a href="%s">%s</a>`, utils.Translate(ctx, "email.accountLocked.body"), unlockURL, utils.Translate(ctx, "email.accountLocked.action")))
+}
+
+// LoginFailed counts a failed attempt for the ip address and, when known, the user.
+func LoginFailed(ctx context.Context, ip string, user *types.User) {
+	now := time.Now()
+	if locked, err := recordFailure(ctx, ipThrottleKey(ip), ipLoginPolicy, nil, now); err != nil {
+		log.Println("could not record login failure for ip", ip, err)
+	} else if locked {
+		log.Println("ip address locked after too many login failures", ip)
+	}
+	if user == nil {
+		return
+	}
+	if locked, err := recordFailure(ctx, userThrottleKey(user.ID, *user.Group), userLoginPolicy, user, now); err != nil {
+		log.Println("could not record login failure for user", user.ID, err)
+	} else if locked {
+		log.Println("user locked after too many login failures", user.ID)
+	}
+}
+
+// LoginSucceeded resets the counter of the user. The one of the ip address decays by itself.
+func LoginSucceeded(ctx context.Context, user *types.User) {
+	UnlockUser(ctx, user.ID, *user.Group)
+}
+
+// UnlockUser removes the failures and the lock of a user.
+func UnlockUser(ctx context.Context, userID string, group types.Group) error {
+	_, err := dbClient.AdminCollection(LoginThrottleCollection).DeleteOne(ctx, db.FilterByID(userThrottleKey(userID, group)))
+	if err != nil {
+		log.Println("could not unlock user", userID, err)
+	}
+	return err
+}
+
+// UnlockWithToken unlocks the user who received the token by email.
+func UnlockWithToken(ctx context.Context, token string, group types.Group) (bool, error) {
+	res, err := dbClient.AdminCollection(LoginThrottleCollection).DeleteOne(ctx, bson.M{"unlockHash": hashToken(token), "group": group})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount == 1, nil
+}
+
+// HitRateLimit counts a request of key in the current fixed window and tells whether it is allowed.
+// When refused, it returns how long to wait for the next window.
+func HitRateLimit(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	now := time.Now()
+	windowStart := now.Truncate(window)
+	var counter struct {
+		Count int `bson:"count"`
+	}
+	if err := dbClient.AdminCollection(RateLimitCollection).FindOneAndUpdate(ctx,
+		bson.M{"_id": fmt.Sprintf("%s:%d", key, windowStart.Unix())},
+		bson.M{"$inc": bson.M{"count": 1}, "$setOnInsert": bson.M{"expiresAt": windowStart.Add(window)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&counter); err != nil {
+		return false, 0, err
+	}
+	if counter.Count > limit {
+		return false, windowStart.Add(window).Sub(now), nil
+	}
+	return true, 0, nil
+}
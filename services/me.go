@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/email"
+	"github.com/nbittich/wtm/services/utils"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const EmailChangeTokenCollection = "emailChangeToken"
+
+// UpdateMe applies a partial update of the profile and settings of the user.
+func UpdateMe(ctx context.Context, userID string, group types.Group, form *types.UpdateMeForm) (*types.User, error) {
+	if err := utils.ValidateStruct(form); err != nil {
+		return nil, err
+	}
+	user, err := FindUserByID(ctx, userID, group)
+	if err != nil {
+		return nil, err
+	}
+	if set := MeUpdate(form); len(set) > 0 {
+		if _, err = updateUser(ctx, group, db.FilterByID(user.ID), bson.M{"$set": set}); err != nil {
+			return nil, err
+		}
+	}
+	user.ApplyMeForm(form)
+	return &user, nil
+}
+
+// MeUpdate returns the fields set by the partial update of the profile and settings, like
+// types.User.ApplyMeForm does on the user.
+func MeUpdate(form *types.UpdateMeForm) bson.M {
+	set := bson.M{}
+	if form.FirstName != nil {
+		set["profile.firstname"] = *form.FirstName
+	}
+	if form.LastName != nil {
+		set["profile.lastname"] = *form.LastName
+	}
+	if form.Availability != nil {
+		set["profile.availability"] = form.Availability
+	}
+	if form.Lang != nil {
+		set["settings.lang"] = *form.Lang
+	}
+	return set
+}
+
+// ChangePassword sets a new password after checking the current one. The other sessions of the
+// user are revoked, the current one is kept.
+func ChangePassword(ctx context.Context, claims *types.UserClaims, form *types.ChangePasswordForm) error {
+	if err := utils.ValidateStruct(form); err != nil {
+		return err
+	}
+	user, err := FindUserByID(ctx, claims.ID, claims.Group)
+	if err != nil {
+		return err
+	}
+	if user.Password == nil || !CheckPasswordHash(form.CurrentPassword, *user.Password) {
+		return types.InvalidFormError{Form: form, Messages: types.InvalidMessage{"general": "home.me.invalidPassword"}}
+	}
+	password, err := hashPassword(form.Password)
+	if err != nil {
+		return err
+	}
+	if _, err = updateUser(ctx, claims.Group, db.FilterByID(user.ID), bson.M{"$set": bson.M{"password": password}}); err != nil {
+		return err
+	}
+	_, err = RevokeOtherSessions(ctx, user.ID, claims.RegisteredClaims.ID, claims.Group)
+	return err
+}
+
+// RequestEmailChange sends a confirmation link to the new address. The current address stays in
+// use until the link is followed.
+func RequestEmailChange(ctx context.Context, userID string, group types.Group, form *types.ChangeEmailForm) error {
+	if err := utils.ValidateStruct(form); err != nil {
+		return err
+	}
+	user, err := FindUserByID(ctx, userID, group)
+	if err != nil {
+		return err
+	}
+	if user.Password == nil || !CheckPasswordHash(form.Password, *user.Password) {
+		return types.InvalidFormError{Form: form, Messages: types.InvalidMessage{"general": "home.me.invalidPassword"}}
+	}
+	userCollection, err := dbClient.Collection(UserCollection, group)
+	if err != nil {
+		return err
+	}
+	tokenCollection, err := dbClient.Collection(EmailChangeTokenCollection, group)
+	if err != nil {
+		return err
+	}
+	if exist, err := db.Exist(ctx, bson.M{"email": form.Email}, userCollection); err != nil || exist {
+		if err != nil {
+			return err
+		}
+		return types.InvalidFormError{Form: form, Messages: types.InvalidMessage{"general": "home.signup.user.exist"}}
+	}
+	// only the last requested address can be confirmed
+	if _, err = tokenCollection.DeleteMany(ctx, bson.M{"userId": user.ID}); err != nil {
+		return err
+	}
+	token, hash, err := generateToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	changeToken := types.EmailChangeToken{
+		UserID:    user.ID,
+		Email:     form.Email,
+		Hash:      hash,
+		Group:     group,
+		CreatedAt: now,
+		ExpiresAt: now.Add(config.ActivationExpiration),
+	}
+	if _, err = db.InsertOrUpdate(ctx, &changeToken, tokenCollection); err != nil {
+		return err
+	}
+	if _, err = updateUser(ctx, group, db.FilterByID(user.ID), bson.M{"$set": bson.M{"pendingEmail": form.Email}}); err != nil {
+		return err
+	}
+	confirmURL := fmt.Sprintf("%s/users/email/confirm?hash=%s&group=%s", config.BaseURL, url.QueryEscape(token), url.QueryEscape(string(group)))
+	go email.SendAsync([]string{form.Email}, []string{}, utils.Translate(ctx, "email.emailChange.subject"),
+		fmt.Sprintf(`<p>%s</p><a href="%s">%s</a>`, utils.Translate(ctx, "email.emailChange.body"), confirmURL, utils.Translate(ctx, "email.emailChange.action")))
+	return nil
+}
+
+// ConfirmEmailChange replaces the email of the user by the address the link was sent to.
+func ConfirmEmailChange(ctx context.Context, token string, group types.Group) (bool, error) {
+	userCollection, err := dbClient.Collection(UserCollection, group)
+	if err != nil {
+		return false, err
+	}
+	tokenCollection, err := dbClient.Collection(EmailChangeTokenCollection, group)
+	if err != nil {
+		return false, err
+	}
+	changeToken, err := db.FindOneBy[types.EmailChangeToken](ctx, bson.M{"hash": hashToken(token)}, tokenCollection)
+	if err != nil {
+		return false, nil
+	}
+	// burn the token first, so that a concurrent request with the same token fails
+	res, err := tokenCollection.DeleteOne(ctx, db.FilterByID(changeToken.ID))
+	if err != nil || res.DeletedCount == 0 {
+		return false, err
+	}
+	user, err := db.FindOneByID[types.User](ctx, userCollection, changeToken.UserID)
+	if err != nil || !changeToken.Confirms(user, time.Now()) {
+		log.Println("email change link no longer valid")
+		return false, nil
+	}
+	if exist, err := db.Exist(ctx, bson.M{"email": changeToken.Email, "_id": bson.M{"$ne": user.ID}}, userCollection); err != nil || exist {
+		return false, err
+	}
+	// the pending address may have been replaced meanwhile
+	return updateUser(ctx, group, bson.M{"_id": user.ID, "pendingEmail": changeToken.Email},
+		bson.M{"$set": bson.M{"email": changeToken.Email}, "$unset": bson.M{"pendingEmail": ""}})
+}
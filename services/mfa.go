@@ -0,0 +1,265 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/totp"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	MFAChallengeCollection = "mfaChallenge"
+	mfaChallengeExpiration = 5 * time.Minute
+	mfaMaxAttempts         = 5
+	recoveryCodesCount     = 10
+)
+
+var ErrInvalidSecondFactor = fmt.Errorf("invalid second factor")
+
+// orgRequiresMFA tells whether the user holds a role for which the organization requires a second factor.
+func orgRequiresMFA(ctx context.Context, user *types.User) bool {
+	if !slices.Contains(user.Roles, types.ADMIN) {
+		return false
+	}
+	org, err := db.FindOneBy[types.Organization](ctx, bson.M{"group": *user.Group}, dbClient.AdminCollection(OrganizationCollection))
+	if err != nil {
+		log.Println("could not fetch organization of group", *user.Group, err)
+		return false
+	}
+	return org.RequireMFAForAdmins
+}
+
+// applyMFAPolicy withholds the ADMIN role when the organization requires a second factor the session didn't provide.
+func applyMFAPolicy(ctx context.Context, claims *types.UserClaims, user *types.User, session *types.Session) {
+	if session.MFAVerified || !orgRequiresMFA(ctx, user) {
+		return
+	}
+	claims.Roles = withoutAdmin(claims.Roles)
+	claims.MFAEnrollmentRequired = true
+}
+
+func withoutAdmin(roles []types.Role) []types.Role {
+	return slices.DeleteFunc(slices.Clone(roles), func(r types.Role) bool { return r == types.ADMIN })
+}
+
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// SecondFactorUse checks code, either a totp code or an unused recovery code, against the second
+// factor of the user. It returns the filter and the update recording its use: the filter only
+// matches while the code is unused, so that concurrent requests cannot both accept it.
+func SecondFactorUse(user *types.User, code string, now time.Time) (bson.M, bson.M, bool) {
+	if user.TOTP == nil || !user.TOTP.Enabled {
+		return nil, nil, false
+	}
+	filter := bson.M{"_id": user.ID, "totp.enabled": true}
+	if step, ok := totp.Validate(user.TOTP.Secret, strings.TrimSpace(code), now, user.TOTP.LastStep); ok {
+		filter["totp.lastStep"] = bson.M{"$lt": step}
+		return filter, bson.M{"$set": bson.M{"totp.lastStep": step}}, true
+	}
+	hash := hashToken(normalizeRecoveryCode(code))
+	if slices.Contains(user.TOTP.RecoveryCodes, hash) {
+		filter["totp.recoveryCodes"] = hash
+		return filter, bson.M{"$pull": bson.M{"totp.recoveryCodes": hash}}, true
+	}
+	return nil, nil, false
+}
+
+// useSecondFactor accepts the code if it is valid and was not used meanwhile, and records its use.
+func useSecondFactor(ctx context.Context, user *types.User, code string, now time.Time) (bool, error) {
+	filter, update, ok := SecondFactorUse(user, code, now)
+	if !ok {
+		return false, nil
+	}
+	return updateUser(ctx, *user.Group, filter, update)
+}
+
+// updateUser applies the update to the user matching the filter, and tells whether there was one.
+// Only the changed fields are written, so that a concurrent change of the others is kept.
+func updateUser(ctx context.Context, group types.Group, filter bson.M, update bson.M) (bool, error) {
+	collection, err := dbClient.Collection(UserCollection, group)
+	if err != nil {
+		return false, err
+	}
+	res, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// StartMFAChallenge is called once the password was checked, the returned token must be sent back with the second factor.
+func StartMFAChallenge(ctx context.Context, user *types.User) (string, error) {
+	collection, err := dbClient.Collection(MFAChallengeCollection, *user.Group)
+	if err != nil {
+		return "", err
+	}
+	token, hash, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	challenge := types.MFAChallenge{
+		UserID:    user.ID,
+		Hash:      hash,
+		ExpiresAt: time.Now().Add(mfaChallengeExpiration),
+	}
+	if _, err = db.InsertOrUpdate(ctx, &challenge, collection); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// CompleteMFAChallenge checks the second factor and opens the session. A wrong code counts as a
+// failed login of the user, like a wrong password: the throttle of the user is only reset once
+// both factors were checked, so that knowing the password doesn't give unlimited challenges.
+// A *LoginThrottledError is returned while the user or the ip address must wait.
+func CompleteMFAChallenge(ctx context.Context, token string, group types.Group, code string, userAgent string, ip string) (*types.TokenPair, error) {
+	collection, err := dbClient.Collection(MFAChallengeCollection, group)
+	if err != nil {
+		return nil, ErrInvalidSecondFactor
+	}
+	now := time.Now()
+	var challenge types.MFAChallenge
+	// count the attempt before checking the code, so that concurrent guesses are limited too
+	res := collection.FindOneAndUpdate(ctx,
+		bson.M{"hash": hashToken(token), "expiresAt": bson.M{"$gt": now}, "attempts": bson.M{"$lt": mfaMaxAttempts}},
+		bson.M{"$inc": bson.M{"attempts": 1}})
+	if err = res.Decode(&challenge); err != nil {
+		LoginFailed(ctx, ip, nil)
+		return nil, ErrInvalidSecondFactor
+	}
+	user, err := FindUserByID(ctx, challenge.UserID, group)
+	if err != nil || !user.CanSignIn() {
+		return nil, ErrInvalidSecondFactor
+	}
+	if err = CheckLogin(ctx, ip, &user); err != nil {
+		return nil, err
+	}
+	ok, err := useSecondFactor(ctx, &user, code, now)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		LoginFailed(ctx, ip, &user)
+		return nil, ErrInvalidSecondFactor
+	}
+	if _, err = collection.DeleteOne(ctx, db.FilterByID(challenge.ID)); err != nil {
+		return nil, err
+	}
+	tokens, err := createSession(ctx, &user, userAgent, ip, true)
+	if err != nil {
+		return nil, err
+	}
+	LoginSucceeded(ctx, &user)
+	return tokens, nil
+}
+
+// EnrollTOTP generates a new secret for the user. It is enforced only after ConfirmTOTP.
+func EnrollTOTP(ctx context.Context, userID string, group types.Group) (string, string, error) {
+	user, err := FindUserByID(ctx, userID, group)
+	if err != nil {
+		return "", "", err
+	}
+	if user.TOTP != nil && user.TOTP.Enabled {
+		return "", "", fmt.Errorf("two factor authentication already enabled")
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	user.TOTP = &types.UserTOTP{Secret: secret, UpdatedAt: time.Now()}
+	// a concurrent confirmation of the previous secret must not be overwritten
+	enrolled, err := updateUser(ctx, group, bson.M{"_id": user.ID, "totp.enabled": bson.M{"$ne": true}}, bson.M{"$set": bson.M{"totp": user.TOTP}})
+	if err != nil {
+		return "", "", err
+	}
+	if !enrolled {
+		return "", "", fmt.Errorf("two factor authentication already enabled")
+	}
+	return secret, totp.ProvisioningURI(secret, config.JWTIssuer, user.Email), nil
+}
+
+// ConfirmTOTP enables the second factor if the code matches the enrolled secret, and returns the
+// recovery codes. They are only stored hashed and cannot be shown again.
+func ConfirmTOTP(ctx context.Context, userID string, group types.Group, code string) ([]string, error) {
+	user, err := FindUserByID(ctx, userID, group)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTP == nil || user.TOTP.Enabled {
+		return nil, fmt.Errorf("no pending two factor enrollment")
+	}
+	step, ok := totp.Validate(user.TOTP.Secret, strings.TrimSpace(code), time.Now(), 0)
+	if !ok {
+		return nil, ErrInvalidSecondFactor
+	}
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([]string, 0, recoveryCodesCount)
+	for range recoveryCodesCount {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+	// only the secret the code was checked against can be enabled
+	confirmed, err := updateUser(ctx, group,
+		bson.M{"_id": user.ID, "totp.secret": user.TOTP.Secret, "totp.enabled": false},
+		bson.M{"$set": bson.M{"totp.enabled": true, "totp.lastStep": step, "totp.recoveryCodes": hashes, "totp.updatedAt": time.Now()}})
+	if err != nil {
+		return nil, err
+	}
+	if !confirmed {
+		return nil, fmt.Errorf("no pending two factor enrollment")
+	}
+	return codes, nil
+}
+
+// DisableTOTP removes the second factor of the user, after checking a last code.
+func DisableTOTP(ctx context.Context, userID string, group types.Group, code string) error {
+	user, err := FindUserByID(ctx, userID, group)
+	if err != nil {
+		return err
+	}
+	if user.TOTP != nil && user.TOTP.Enabled {
+		ok, err := useSecondFactor(ctx, &user, code, time.Now())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidSecondFactor
+		}
+	}
+	return ResetTOTP(ctx, userID, group)
+}
+
+// ResetTOTP removes the second factor without checking it, e.g. by an admin when a device was lost.
+func ResetTOTP(ctx context.Context, userID string, group types.Group) error {
+	collection, err := dbClient.Collection(UserCollection, group)
+	if err != nil {
+		return err
+	}
+	_, err = collection.UpdateOne(ctx, db.FilterByID(userID), bson.M{"$unset": bson.M{"totp": ""}})
+	return err
+}
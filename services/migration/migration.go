@@ -0,0 +1,254 @@
+// Package migration runs versioned schema migrations written in Go against a mongo database.
+// The applied migrations are recorded in a collection of the database itself, so that every
+// group database knows its own version.
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Scope string
+
+const (
+	Admin Scope = "admin" // the admin database, once
+	Group Scope = "group" // every group database
+)
+
+var ErrLocked = errors.New("migrations locked by another instance")
+
+type Migration struct {
+	Version int
+	Name    string
+	Scope   Scope
+	// Revision stands for the content of Up, which cannot be hashed. Change it, e.g. to the date
+	// of the change, whenever Up changes: the databases that applied the previous revision then
+	// refuse to migrate, instead of silently diverging from the new ones.
+	Revision string
+	Up       func(ctx context.Context, database *mongo.Database) error
+	// DryRun describes what Up would change, without changing anything. Optional.
+	DryRun func(ctx context.Context, database *mongo.Database) (string, error)
+}
+
+// Checksum identifies a migration and its revision. Renaming, renumbering, moving a migration to
+// another scope or revising it once applied is refused, as it would most likely mean running it
+// twice, never, or differently across databases.
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s:%s:%s", m.Version, m.Scope, m.Name, m.Revision)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Record is the trace of an applied migration.
+type Record struct {
+	ID        string    `bson:"_id" json:"_id"`
+	Version   int       `bson:"version" json:"version"`
+	Name      string    `bson:"name" json:"name"`
+	Scope     Scope     `bson:"scope" json:"scope"`
+	Checksum  string    `bson:"checksum" json:"checksum"`
+	AppliedAt time.Time `bson:"appliedAt" json:"appliedAt"`
+	Duration  int64     `bson:"durationMs" json:"durationMs"`
+}
+
+// Report tells what was, or would be with a dry run, applied to a database.
+type Report struct {
+	Database string
+	Version  int
+	Name     string
+	Message  string
+}
+
+func recordID(version int) string {
+	return fmt.Sprintf("%06d", version)
+}
+
+// ForScope returns the migrations of the scope, in the same order.
+func ForScope(migrations []Migration, scope Scope) []Migration {
+	filtered := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		if m.Scope == scope {
+			filtered = append(filtered, m)
+		}
+	}
+	return filtered
+}
+
+// Validate checks the versions are positive and strictly increasing, and every migration has a revision.
+func Validate(migrations []Migration) error {
+	last := 0
+	for _, m := range migrations {
+		if m.Version <= last {
+			return fmt.Errorf("migration %d %s: versions must be positive and strictly increasing", m.Version, m.Name)
+		}
+		if m.Up == nil {
+			return fmt.Errorf("migration %d %s: missing Up", m.Version, m.Name)
+		}
+		if m.Revision == "" {
+			return fmt.Errorf("migration %d %s: missing Revision", m.Version, m.Name)
+		}
+		if m.Scope != Admin && m.Scope != Group {
+			return fmt.Errorf("migration %d %s: unknown scope %q", m.Version, m.Name, m.Scope)
+		}
+		last = m.Version
+	}
+	return nil
+}
+
+// Plan returns the migrations of the scope still to apply. Applied migrations of the scope must
+// all be known with the same checksum, and a pending migration cannot be older than the last
+// applied one. The records of the other scope, when both share a database, are ignored.
+func Plan(scope Scope, migrations []Migration, applied []Record) ([]Migration, error) {
+	if err := Validate(migrations); err != nil {
+		return nil, err
+	}
+	migrations = ForScope(migrations, scope)
+	byVersion := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+	done := make(map[int]bool, len(applied))
+	lastApplied := 0
+	for _, record := range applied {
+		if record.Scope != scope {
+			continue
+		}
+		m, ok := byVersion[record.Version]
+		if !ok {
+			return nil, fmt.Errorf("applied migration %d %s is unknown", record.Version, record.Name)
+		}
+		if m.Checksum() != record.Checksum {
+			return nil, fmt.Errorf("migration %d %s changed since it was applied as %s", m.Version, m.Name, record.Name)
+		}
+		done[record.Version] = true
+		lastApplied = max(lastApplied, record.Version)
+	}
+	pending := make([]Migration, 0, len(migrations)-len(done))
+	for _, m := range migrations {
+		if done[m.Version] {
+			continue
+		}
+		if m.Version < lastApplied {
+			return nil, fmt.Errorf("migration %d %s is older than the last applied migration %d", m.Version, m.Name, lastApplied)
+		}
+		pending = append(pending, m)
+	}
+	return pending, nil
+}
+
+// Applied returns the records of the database, ordered by version.
+func Applied(ctx context.Context, collection *mongo.Collection) ([]Record, error) {
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"version": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	if err = cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Migrate applies the pending migrations of the scope to the database and records them in the
+// collection named collectionName. With dryRun, nothing is changed and the reports tell what would be.
+// It stops at the first failure, the migrations applied before it stay recorded.
+func Migrate(ctx context.Context, database *mongo.Database, collectionName string, scope Scope, migrations []Migration, dryRun bool) ([]Report, error) {
+	collection := database.Collection(collectionName)
+	applied, err := Applied(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := Plan(scope, migrations, applied)
+	if err != nil {
+		return nil, fmt.Errorf("database %s: %w", database.Name(), err)
+	}
+	reports := make([]Report, 0, len(pending))
+	for _, m := range pending {
+		report := Report{Database: database.Name(), Version: m.Version, Name: m.Name}
+		if dryRun {
+			report.Message = "pending"
+			if m.DryRun != nil {
+				if report.Message, err = m.DryRun(ctx, database); err != nil {
+					return reports, fmt.Errorf("database %s, migration %d %s: %w", database.Name(), m.Version, m.Name, err)
+				}
+			}
+			reports = append(reports, report)
+			continue
+		}
+		start := time.Now()
+		if err = m.Up(ctx, database); err != nil {
+			return reports, fmt.Errorf("database %s, migration %d %s: %w", database.Name(), m.Version, m.Name, err)
+		}
+		if err = record(ctx, collection, m, start, time.Since(start)); err != nil {
+			return reports, err
+		}
+		report.Message = "applied"
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func record(ctx context.Context, collection *mongo.Collection, m Migration, appliedAt time.Time, duration time.Duration) error {
+	_, err := collection.ReplaceOne(ctx, bson.M{"_id": recordID(m.Version)}, Record{
+		ID:        recordID(m.Version),
+		Version:   m.Version,
+		Name:      m.Name,
+		Scope:     m.Scope,
+		Checksum:  m.Checksum(),
+		AppliedAt: appliedAt,
+		Duration:  duration.Milliseconds(),
+	}, options.Replace().SetUpsert(true))
+	return err
+}
+
+// Baseline records the migrations of the scope as applied without running them, for a database
+// created by code that already has the latest schema.
+func Baseline(ctx context.Context, database *mongo.Database, collectionName string, scope Scope, migrations []Migration) error {
+	if err := Validate(migrations); err != nil {
+		return err
+	}
+	collection := database.Collection(collectionName)
+	now := time.Now()
+	for _, m := range ForScope(migrations, scope) {
+		if err := record(ctx, collection, m, now, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const lockID = "lock"
+
+// Lock takes the lock document of the collection for owner, waiting for the current owner to
+// release it or for its lock to expire. A lock expires after ttl so that a crashed instance
+// doesn't block the others forever.
+func Lock(ctx context.Context, collection *mongo.Collection, owner string, ttl time.Duration) (func(context.Context) error, error) {
+	for {
+		now := time.Now()
+		_, err := collection.UpdateOne(ctx,
+			bson.M{"_id": lockID, "expiresAt": bson.M{"$lte": now}},
+			bson.M{"$set": bson.M{"owner": owner, "lockedAt": now, "expiresAt": now.Add(ttl)}},
+			options.Update().SetUpsert(true))
+		if err == nil {
+			return func(ctx context.Context) error {
+				_, err := collection.DeleteOne(ctx, bson.M{"_id": lockID, "owner": owner})
+				return err
+			}, nil
+		}
+		// the upsert conflicts with the lock of another owner
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %w", ErrLocked, ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Package migrations holds the schema migrations of the application and runs them on the admin
+// database and on every group database.
+//
+// To evolve a schema, append a migration with the next version and a first Revision to registered.
+// Never edit, renumber or remove a migration once released: the databases remember its checksum,
+// and a fix to its Up must change its Revision so that it is noticed. Migrations may be
+// interrupted, so they must be safe to run again.
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/migration"
+	"github.com/nbittich/wtm/types"
+)
+
+// the lock is global: a single instance migrates every database
+const lockCollection = "_migrationLock"
+
+var (
+	registered = []migration.Migration{}
+	dbClient   *db.Client
+)
+
+// Init sets the database client the migrations run on.
+func Init(client *db.Client) {
+	dbClient = client
+}
+
+func lock(ctx context.Context) (func(context.Context) error, error) {
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s:%d:%s", host, os.Getpid(), uuid.New().String())
+	return migration.Lock(ctx, dbClient.AdminCollection(lockCollection), owner, config.MigrationLockTTL)
+}
+
+// Run applies the pending migrations to the admin database, then to every group database.
+// With dryRun, it only reports them.
+func Run(ctx context.Context, dryRun bool) ([]migration.Report, error) {
+	unlock, err := lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock(context.Background())
+
+	reports, err := migration.Migrate(ctx, dbClient.AdminDatabase(), config.MongoMigrationCollection, migration.Admin, registered, dryRun)
+	if err != nil {
+		return reports, err
+	}
+	for _, group := range dbClient.ListGroups() {
+		groupReports, err := migrateGroup(ctx, group, dryRun)
+		reports = append(reports, groupReports...)
+		if err != nil {
+			return reports, err
+		}
+	}
+	return reports, nil
+}
+
+func migrateGroup(ctx context.Context, group types.Group, dryRun bool) ([]migration.Report, error) {
+	database, err := dbClient.GroupDatabase(group)
+	if err != nil {
+		return nil, err
+	}
+	return migration.Migrate(ctx, database, config.MongoMigrationCollection, migration.Group, registered, dryRun)
+}
+
+// MigrateGroup brings a single group database up to date, e.g. after importing an older archive.
+func MigrateGroup(ctx context.Context, group types.Group) ([]migration.Report, error) {
+	unlock, err := lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock(context.Background())
+	return migrateGroup(ctx, group, false)
+}
+
+// Baseline marks every group migration as applied on a group database the current code just
+// created, which has the latest schema already.
+func Baseline(ctx context.Context, group types.Group) error {
+	database, err := dbClient.GroupDatabase(group)
+	if err != nil {
+		return err
+	}
+	return migration.Baseline(ctx, database, config.MongoMigrationCollection, migration.Group, registered)
+}
@@ -0,0 +1,243 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Provider is an OpenID Connect identity provider, used with the authorization code flow.
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	ClientID     string `json:"-"`
+	ClientSecret string `json:"-"`
+	RedirectURL  string `json:"-"`
+
+	client *http.Client
+}
+
+// IDToken holds the verified claims of the id token we care about.
+type IDToken struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	// AMR lists the authentication methods the provider used, see RFC 8176
+	AMR []string
+}
+
+// MultiFactor tells whether the provider says the user signed in with more than one factor.
+func (t *IDToken) MultiFactor() bool {
+	return slices.Contains(t.AMR, "mfa")
+}
+
+type idTokenClaims struct {
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+	AMR           []string `json:"amr"`
+	jwt.RegisteredClaims
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func getJSON(ctx context.Context, client *http.Client, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, u)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Discover reads the provider metadata from the issuer's well-known configuration.
+func Discover(ctx context.Context, client *http.Client, issuer string, clientID string, clientSecret string, redirectURL string) (*Provider, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	issuer = strings.TrimSuffix(issuer, "/")
+	p := &Provider{}
+	if err := getJSON(ctx, client, issuer+"/.well-known/openid-configuration", p); err != nil {
+		return nil, err
+	}
+	if p.Issuer != issuer {
+		return nil, fmt.Errorf("issuer mismatch: expected %s, got %s", issuer, p.Issuer)
+	}
+	p.ClientID = clientID
+	p.ClientSecret = clientSecret
+	p.RedirectURL = redirectURL
+	p.client = client
+	return p, nil
+}
+
+// Cache keeps the discovered metadata of the providers, so that it isn't fetched on every login.
+type Cache struct {
+	ttl       time.Duration
+	client    *http.Client
+	mu        sync.Mutex
+	providers map[string]cachedProvider
+}
+
+type cachedProvider struct {
+	provider     Provider
+	discoveredAt time.Time
+}
+
+// NewCache returns a cache keeping the metadata for ttl. client may be nil, see Discover.
+func NewCache(ttl time.Duration, client *http.Client) *Cache {
+	return &Cache{ttl: ttl, client: client, providers: map[string]cachedProvider{}}
+}
+
+// Discover is like the package function, but reuses the metadata of the issuer discovered less
+// than ttl ago. Only the metadata is shared, the credentials are the given ones.
+func (c *Cache) Discover(ctx context.Context, issuer string, clientID string, clientSecret string, redirectURL string) (*Provider, error) {
+	key := strings.TrimSuffix(issuer, "/")
+	c.mu.Lock()
+	cached, ok := c.providers[key]
+	c.mu.Unlock()
+	if !ok || time.Since(cached.discoveredAt) > c.ttl {
+		p, err := Discover(ctx, c.client, issuer, "", "", "")
+		if err != nil {
+			return nil, err
+		}
+		cached = cachedProvider{provider: *p, discoveredAt: time.Now()}
+		c.mu.Lock()
+		c.providers[key] = cached
+		c.mu.Unlock()
+	}
+	p := cached.provider
+	p.ClientID = clientID
+	p.ClientSecret = clientSecret
+	p.RedirectURL = redirectURL
+	return &p, nil
+}
+
+// AuthCodeURL is where the user is redirected to sign in.
+func (p *Provider) AuthCodeURL(state string, nonce string) string {
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", p.RedirectURL)
+	params.Set("scope", "openid email profile")
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.AuthorizationEndpoint + sep + params.Encode()
+}
+
+// Exchange trades the authorization code for an id token and verifies it.
+func (p *Provider) Exchange(ctx context.Context, code string, nonce string) (*IDToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint answered %d", resp.StatusCode)
+	}
+	var tokenResponse struct {
+		IDToken string `json:"id_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return nil, err
+	}
+	if tokenResponse.IDToken == "" {
+		return nil, fmt.Errorf("no id token in response")
+	}
+	return p.Verify(ctx, tokenResponse.IDToken, nonce)
+}
+
+// Verify checks the signature of the id token against the provider keys, its issuer, audience,
+// expiration and nonce.
+func (p *Provider) Verify(ctx context.Context, rawIDToken string, nonce string) (*IDToken, error) {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, p.client, p.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+	claims := idTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		for _, key := range jwks.Keys {
+			if key.Kty == "RSA" && (kid == "" || key.Kid == kid) {
+				return key.publicKey()
+			}
+		}
+		return nil, fmt.Errorf("no key found for kid %s", kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("missing subject")
+	}
+	return &IDToken{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+		AMR:           claims.AMR,
+	}, nil
+}
+
+func (key jsonWebKey) publicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil {
+		return nil, err
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
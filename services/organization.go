@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrOrganizationInactive = fmt.Errorf("organization suspended or deleted")
+
+// CheckOrganizationActive returns ErrOrganizationInactive when the organization of the group is
+// suspended or scheduled for deletion. Groups without organization, like the one of the super
+// admins, are always active.
+// The answer is cached for config.OrgStatusCacheTTL, as it is asked on every request.
+func CheckOrganizationActive(ctx context.Context, group types.Group) error {
+	active, ok := orgStatuses.get(group)
+	if !ok {
+		org, err := db.FindOneBy[types.Organization](ctx, bson.M{"group": group}, dbClient.AdminCollection(OrganizationCollection))
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		active = err == mongo.ErrNoDocuments || org.IsActive()
+		orgStatuses.set(group, active)
+	}
+	if !active {
+		return ErrOrganizationInactive
+	}
+	return nil
+}
+
+// ForgetOrganizationStatus drops the cached status of the organization, so that a change made by
+// this instance applies at once. The other instances see it once their cache expired.
+func ForgetOrganizationStatus(group types.Group) {
+	orgStatuses.mu.Lock()
+	delete(orgStatuses.statuses, group)
+	orgStatuses.mu.Unlock()
+}
+
+var orgStatuses = orgStatusCache{statuses: map[types.Group]cachedOrgStatus{}}
+
+type orgStatusCache struct {
+	mu       sync.Mutex
+	statuses map[types.Group]cachedOrgStatus
+}
+
+type cachedOrgStatus struct {
+	active    bool
+	checkedAt time.Time
+}
+
+func (c *orgStatusCache) get(group types.Group) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.statuses[group]
+	if !ok || time.Since(cached.checkedAt) > config.OrgStatusCacheTTL {
+		return false, false
+	}
+	return cached.active, true
+}
+
+func (c *orgStatusCache) set(group types.Group, active bool) {
+	c.mu.Lock()
+	c.statuses[group] = cachedOrgStatus{active: active, checkedAt: time.Now()}
+	c.mu.Unlock()
+}
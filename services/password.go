@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/email"
+	"github.com/nbittich/wtm/services/utils"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const PasswordResetTokenCollection = "passwordResetToken"
+
+// ForgotPassword emails a single use reset link to the user. It never tells whether the user exists:
+// unknown or disabled users and users or usernames for which too many links were asked are
+// silently ignored. The email is in the language of the user.
+func ForgotPassword(ctx context.Context, username string, group types.Group) error {
+	// counted before looking the user up, so that an unknown one costs the same
+	allowed, _, err := HitRateLimit(ctx, fmt.Sprintf("passwordReset:%s:%s", group, strings.ToLower(username)), config.PasswordResetMaxPerHour, time.Hour)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		log.Println("too many password reset requested for", username)
+		return nil
+	}
+	user, err := FindByUsernameOrEmail(ctx, username, group)
+	if err != nil || !user.CanSignIn() {
+		log.Println("password reset requested for unknown or disabled user", username)
+		return nil
+	}
+	collection, err := dbClient.Collection(PasswordResetTokenCollection, group)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	recent, err := db.Count(ctx, bson.M{
+		"userId":    user.ID,
+		"createdAt": bson.M{"$gte": now.Add(-time.Hour)},
+	}, collection)
+	if err != nil {
+		return err
+	}
+	if recent >= int64(config.PasswordResetMaxPerHour) {
+		log.Println("too many password reset requested for user", user.ID)
+		return nil
+	}
+
+	token, hash, err := generateToken()
+	if err != nil {
+		return err
+	}
+	resetToken := types.PasswordResetToken{
+		UserID:    user.ID,
+		Hash:      hash,
+		Group:     group,
+		CreatedAt: now,
+		ExpiresAt: now.Add(config.PasswordResetExpiration),
+	}
+	if _, err = db.InsertOrUpdate(ctx, &resetToken, collection); err != nil {
+		return err
+	}
+	// the link opens the form of resetPasswordPageHandler
+	resetURL := fmt.Sprintf("%s/users/password/reset?token=%s&group=%s", config.BaseURL, url.QueryEscape(token), url.QueryEscape(string(group)))
+	mailCtx := utils.WithLang(ctx, user.Settings.Lang)
+	go email.SendAsync([]string{user.Email}, []string{}, utils.Translate(mailCtx, "email.passwordReset.subject"),
+		fmt.Sprintf(`<p>%s</p><a href="%s">%s</a>`, utils.Translate(mailCtx, "email.passwordReset.body"), resetURL, utils.Translate(mailCtx, "email.passwordReset.action")))
+	return nil
+}
+
+// ResetPassword sets the new password if the token is known, unused and not expired.
+// Every other pending token of the user is burnt as well.
+func ResetPassword(ctx context.Context, form *types.ResetPasswordForm) error {
+	var (
+		userCollection  *mongo.Collection
+		tokenCollection *mongo.Collection
+		err             error
+	)
+	if err = utils.ValidateStruct(form); err != nil {
+		return err
+	}
+	group := types.Group(form.Group)
+	invalid := types.InvalidFormError{Form: form, Messages: types.InvalidMessage{"general": "home.password.reset.invalidToken"}}
+	if userCollection, err = dbClient.Collection(UserCollection, group); err != nil {
+		return invalid
+	}
+	if tokenCollection, err = dbClient.Collection(PasswordResetTokenCollection, group); err != nil {
+		return err
+	}
+	resetToken, err := db.FindOneBy[types.PasswordResetToken](ctx, bson.M{"hash": hashToken(form.Token)}, tokenCollection)
+	if err != nil {
+		return invalid
+	}
+	now := time.Now()
+	if resetToken.UsedAt != nil || now.After(resetToken.ExpiresAt) {
+		return invalid
+	}
+	user, err := db.FindOneByID[types.User](ctx, userCollection, resetToken.UserID)
+	if err != nil || !user.CanSignIn() {
+		return invalid
+	}
+	password, err := hashPassword(form.Password)
+	if err != nil {
+		return err
+	}
+	// burn the tokens first, so that a concurrent request with the same token fails
+	res, err := tokenCollection.UpdateOne(ctx, bson.M{"_id": resetToken.ID, "usedAt": nil}, bson.M{"$set": bson.M{"usedAt": now}})
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount == 0 {
+		return invalid
+	}
+	if _, err = tokenCollection.UpdateMany(ctx, bson.M{"userId": user.ID, "usedAt": nil}, bson.M{"$set": bson.M{"usedAt": now}}); err != nil {
+		return err
+	}
+	user.Password = &password
+	if _, err = db.InsertOrUpdate(ctx, &user, userCollection); err != nil {
+		return err
+	}
+	_, err = RevokeUserSessions(ctx, user.ID, group)
+	return err
+}
@@ -0,0 +1,77 @@
+package payroll
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nbittich/wtm/types"
+)
+
+// Formatter writes a payroll report in the layout expected by a payroll vendor.
+type Formatter interface {
+	ContentType() string
+	FileExtension() string
+	Format(w io.Writer, report *types.PayrollReport) error
+}
+
+var (
+	formattersMu sync.RWMutex
+	formatters   = map[string]Formatter{
+		"csv": CSVFormatter{},
+	}
+)
+
+// RegisterFormatter makes a formatter available to the export under the given name.
+func RegisterFormatter(name string, formatter Formatter) {
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+	formatters[strings.ToLower(name)] = formatter
+}
+
+func GetFormatter(name string) (Formatter, error) {
+	formattersMu.RLock()
+	defer formattersMu.RUnlock()
+	if formatter, ok := formatters[strings.ToLower(name)]; ok {
+		return formatter, nil
+	}
+	return nil, fmt.Errorf("unknown payroll format %s", name)
+}
+
+// CSVFormatter is the generic layout: one line per employee, one column per hour category.
+type CSVFormatter struct{}
+
+func (CSVFormatter) ContentType() string {
+	return "text/csv"
+}
+
+func (CSVFormatter) FileExtension() string {
+	return "csv"
+}
+
+func (CSVFormatter) Format(w io.Writer, report *types.PayrollReport) error {
+	writer := csv.NewWriter(w)
+	header := []string{"employeeId", "username", "firstName", "lastName", "from", "to"}
+	for _, c := range types.HourCategories {
+		header = append(header, strings.ToLower(string(c)))
+	}
+	header = append(header, "total")
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, line := range report.Lines {
+		record := []string{line.EmployeeID, line.Username, line.FirstName, line.LastName, report.From, report.To}
+		for _, c := range types.HourCategories {
+			record = append(record, strconv.FormatFloat(line.Hours[c], 'f', 2, 64))
+		}
+		record = append(record, strconv.FormatFloat(line.Total, 'f', 2, 64))
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,88 @@
+package payroll
+
+import (
+	"math"
+	"time"
+
+	"github.com/nbittich/wtm/types"
+)
+
+func round(hours float64) float64 {
+	return math.Round(hours*100) / 100
+}
+
+// StartOfWeek returns monday 00:00 of the week containing t.
+func StartOfWeek(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// ComputeOvertime compares the hours worked each week overlapping [from, to) with the contractual hours.
+// Weeks are attributed to the month they start in. A contract of 0 hours never yields overtime.
+func ComputeOvertime(contractualHours float64, from time.Time, to time.Time, shifts []WorkedShift) ([]types.OvertimePeriod, []types.OvertimePeriod) {
+	weeks := make([]types.OvertimePeriod, 0, 5)
+	months := make([]types.OvertimePeriod, 0, 1)
+	for weekStart := StartOfWeek(from); weekStart.Before(to); weekStart = weekStart.AddDate(0, 0, 7) {
+		weekEnd := weekStart.AddDate(0, 0, 7)
+		week := types.OvertimePeriod{
+			Start:       weekStart.Format(types.BelgianDateFormat),
+			End:         weekEnd.AddDate(0, 0, -1).Format(types.BelgianDateFormat),
+			Contractual: contractualHours,
+		}
+		for _, shift := range shifts {
+			if !shift.Start.Before(weekStart) && shift.Start.Before(weekEnd) {
+				week.Worked += shift.End.Sub(shift.Start).Hours()
+			}
+		}
+		if contractualHours > 0 {
+			week.Overtime = round(math.Max(0, week.Worked-contractualHours))
+		}
+		week.Worked = round(week.Worked)
+		weeks = append(weeks, week)
+
+		monthStart := time.Date(weekStart.Year(), weekStart.Month(), 1, 0, 0, 0, 0, weekStart.Location())
+		monthLabel := monthStart.Format(types.BelgianDateFormat)
+		if len(months) == 0 || months[len(months)-1].Start != monthLabel {
+			months = append(months, types.OvertimePeriod{
+				Start: monthLabel,
+				End:   monthStart.AddDate(0, 1, -1).Format(types.BelgianDateFormat),
+			})
+		}
+		month := &months[len(months)-1]
+		month.Worked = round(month.Worked + week.Worked)
+		month.Contractual = round(month.Contractual + week.Contractual)
+		month.Overtime = round(month.Overtime + week.Overtime)
+	}
+	return weeks, months
+}
+
+// ComputeTimeInLieu returns the balance of a user: overtime of the completed weeks, minus the
+// compensating absences taken, plus the manual adjustments.
+func ComputeTimeInLieu(contractualHours float64, worked []WorkedShift, taken []WorkedShift, adjustments []types.TimeInLieuAdjustment, now time.Time) types.TimeInLieuBalance {
+	balance := types.TimeInLieuBalance{}
+	if len(worked) > 0 {
+		first := worked[0].Start
+		for _, shift := range worked {
+			if shift.Start.Before(first) {
+				first = shift.Start
+			}
+		}
+		weeks, _ := ComputeOvertime(contractualHours, first, StartOfWeek(now), worked)
+		for _, week := range weeks {
+			balance.Earned += week.Overtime
+		}
+	}
+	for _, shift := range taken {
+		if shift.Start.Before(now) {
+			balance.Taken += shift.End.Sub(shift.Start).Hours()
+		}
+	}
+	for _, adjustment := range adjustments {
+		balance.Adjusted += adjustment.Hours
+	}
+	balance.Earned = round(balance.Earned)
+	balance.Taken = round(balance.Taken)
+	balance.Adjusted = round(balance.Adjusted)
+	balance.Balance = round(balance.Earned - balance.Taken + balance.Adjusted)
+	return balance
+}
@@ -0,0 +1,201 @@
+package payroll
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nbittich/wtm/types"
+)
+
+// WorkedShift is a slot actually assigned to an employee, or punched by them.
+type WorkedShift struct {
+	EmployeeID string
+	Start      time.Time
+	End        time.Time
+}
+
+// PreferPunches replaces the assigned shifts of the days an employee punched by the punched ones.
+// The other days keep the assigned shifts. A shift belongs to the day it starts in.
+func PreferPunches(assigned []WorkedShift, punched []WorkedShift) []WorkedShift {
+	punchedDays := make(map[string]bool, len(punched))
+	for _, shift := range punched {
+		punchedDays[shiftDay(shift)] = true
+	}
+	shifts := make([]WorkedShift, 0, len(assigned)+len(punched))
+	for _, shift := range assigned {
+		if !punchedDays[shiftDay(shift)] {
+			shifts = append(shifts, shift)
+		}
+	}
+	shifts = append(shifts, punched...)
+	slices.SortStableFunc(shifts, func(a, b WorkedShift) int { return a.Start.Compare(b.Start) })
+	return shifts
+}
+
+func shiftDay(shift WorkedShift) string {
+	return shift.EmployeeID + "/" + shift.Start.Format(time.DateOnly)
+}
+
+// ComputeHours splits the worked shifts of each employee into hour categories. A shift belongs
+// entirely to the period [from, to) it starts in. Public holidays win over sundays, sundays over
+// nights. Normal hours worked beyond the daily or weekly threshold become overtime; the weekly
+// counter starts with the period.
+func ComputeHours(rules types.PayrollRules, from time.Time, to time.Time, shifts []WorkedShift) map[string]map[types.HourCategory]float64 {
+	holidays := make(map[string]bool, len(rules.PublicHolidays))
+	for _, h := range rules.PublicHolidays {
+		holidays[h] = true
+	}
+
+	byEmployee := make(map[string][]WorkedShift)
+	for _, shift := range shifts {
+		if shift.Start.Before(from) || !shift.Start.Before(to) {
+			continue
+		}
+		byEmployee[shift.EmployeeID] = append(byEmployee[shift.EmployeeID], shift)
+	}
+
+	result := make(map[string]map[types.HourCategory]float64, len(byEmployee))
+	for employeeID, employeeShifts := range byEmployee {
+		slices.SortFunc(employeeShifts, func(a, b WorkedShift) int { return a.Start.Compare(b.Start) })
+		hours := make(map[types.HourCategory]float64, len(types.HourCategories))
+		for _, c := range types.HourCategories {
+			hours[c] = 0
+		}
+		workedPerDay := make(map[string]float64)
+		workedPerWeek := make(map[int]float64)
+
+		for _, shift := range employeeShifts {
+			for t := shift.Start; t.Before(shift.End); {
+				next := nextBoundary(rules, t)
+				if next.After(shift.End) {
+					next = shift.End
+				}
+				duration := next.Sub(t).Hours()
+				category := categoryAt(rules, holidays, t)
+				dayKey := t.Format(types.BelgianDateFormat)
+				year, week := t.ISOWeek()
+				weekKey := year*100 + week
+
+				if category == types.NormalHours {
+					// hours already paid as daily overtime don't count towards the weekly threshold
+					dailyOvertime := exceeding(workedPerDay[dayKey], duration, rules.DailyOvertimeAfter)
+					weeklyOvertime := exceeding(workedPerWeek[weekKey], duration-dailyOvertime, rules.WeeklyOvertimeAfter)
+					hours[types.OvertimeHours] += dailyOvertime + weeklyOvertime
+					hours[types.NormalHours] += duration - dailyOvertime - weeklyOvertime
+					workedPerWeek[weekKey] += duration - dailyOvertime
+				} else {
+					hours[category] += duration
+					workedPerWeek[weekKey] += duration
+				}
+				workedPerDay[dayKey] += duration
+				t = next
+			}
+		}
+		for c, h := range hours {
+			hours[c] = round(h)
+		}
+		result[employeeID] = hours
+	}
+	return result
+}
+
+// exceeding returns the part of duration worked above threshold, given what was already worked.
+// A threshold of 0 disables the rule.
+func exceeding(worked float64, duration float64, threshold float64) float64 {
+	if threshold <= 0 {
+		return 0
+	}
+	return math.Max(0, worked+duration-threshold) - math.Max(0, worked-threshold)
+}
+
+func nightEnabled(rules types.PayrollRules) bool {
+	return rules.NightStartHour != rules.NightEndHour
+}
+
+func isNight(rules types.PayrollRules, t time.Time) bool {
+	if !nightEnabled(rules) {
+		return false
+	}
+	h := t.Hour()
+	if rules.NightStartHour > rules.NightEndHour {
+		return h >= rules.NightStartHour || h < rules.NightEndHour
+	}
+	return h >= rules.NightStartHour && h < rules.NightEndHour
+}
+
+// NightHours returns how many hours of [start, end) fall within the night window.
+func NightHours(rules types.PayrollRules, start time.Time, end time.Time) float64 {
+	var hours float64
+	for t := start; t.Before(end); {
+		next := nextBoundary(rules, t)
+		if next.After(end) {
+			next = end
+		}
+		if isNight(rules, t) {
+			hours += next.Sub(t).Hours()
+		}
+		t = next
+	}
+	return hours
+}
+
+func categoryAt(rules types.PayrollRules, holidays map[string]bool, t time.Time) types.HourCategory {
+	switch {
+	case holidays[t.Format(types.BelgianDateFormat)]:
+		return types.PublicHolidayHours
+	case t.Weekday() == time.Sunday:
+		return types.SundayHours
+	case isNight(rules, t):
+		return types.NightHours
+	default:
+		return types.NormalHours
+	}
+}
+
+// nextBoundary returns the next instant after t where the category may change: midnight or a night edge.
+func nextBoundary(rules types.PayrollRules, t time.Time) time.Time {
+	next := time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+	if nightEnabled(rules) {
+		for _, hour := range []int{rules.NightStartHour, rules.NightEndHour} {
+			edge := time.Date(t.Year(), t.Month(), t.Day(), hour, 0, 0, 0, t.Location())
+			if edge.After(t) && edge.Before(next) {
+				next = edge
+			}
+		}
+	}
+	return next
+}
+
+// NewReport turns computed hours into report lines, one per employee, sorted by name.
+func NewReport(from time.Time, to time.Time, hours map[string]map[types.HourCategory]float64, users []types.User) *types.PayrollReport {
+	report := &types.PayrollReport{
+		From:  from.Format(types.BelgianDateFormat),
+		To:    to.AddDate(0, 0, -1).Format(types.BelgianDateFormat),
+		Lines: make([]types.PayrollLine, 0, len(hours)),
+	}
+	for _, user := range users {
+		h, ok := hours[user.ID]
+		if !ok {
+			continue
+		}
+		line := types.PayrollLine{
+			EmployeeID: user.ID,
+			Username:   user.Username,
+			FirstName:  user.Profile.FirstName,
+			LastName:   user.Profile.LastName,
+			Hours:      h,
+		}
+		for _, v := range h {
+			line.Total += v
+		}
+		line.Total = round(line.Total)
+		report.Lines = append(report.Lines, line)
+	}
+	slices.SortFunc(report.Lines, func(a, b types.PayrollLine) int {
+		return cmp.Or(strings.Compare(a.LastName, b.LastName), strings.Compare(a.Username, b.Username))
+	})
+	return report
+}
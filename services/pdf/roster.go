@@ -0,0 +1,321 @@
+package pdf
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/nbittich/wtm/types"
+)
+
+type RosterPeriod string
+
+const (
+	Weekly  RosterPeriod = "WEEK"
+	Monthly RosterPeriod = "MONTH"
+)
+
+// RosterGrouping tells what a page of the roster is about. wtm has no team or location entity,
+// the work of a site or a crew is planned in its own project, which stands in for them.
+type RosterGrouping string
+
+const (
+	ByProject  RosterGrouping = "PROJECT"
+	ByEmployee RosterGrouping = "EMPLOYEE"
+)
+
+type RosterLabels struct {
+	Days       [7]string // indexed by time.Weekday
+	Months     [12]string
+	Week       string
+	Unassigned string
+	Empty      string
+}
+
+type RosterOptions struct {
+	OrganizationName string
+	Period           RosterPeriod
+	Grouping         RosterGrouping
+	Date             time.Time
+	Labels           RosterLabels
+}
+
+type (
+	Roster struct {
+		OrganizationName string
+		Title            string
+		EmptyMessage     string
+		Pages            []RosterPage
+	}
+	RosterPage struct {
+		Title      string
+		Subtitle   string
+		Days       []time.Time
+		DayHeaders []string
+		Rows       []RosterRow
+	}
+	RosterRow struct {
+		Label string
+		Cells [][]string // one slice of lines per day
+	}
+)
+
+const (
+	pageMargin   = 10.0
+	labelWidth   = 45.0
+	headerHeight = 10.0
+	lineHeight   = 4.5
+)
+
+// PeriodBounds returns the half-open interval [from, to) covered by the period containing date.
+// Weeks start on monday.
+func PeriodBounds(period RosterPeriod, date time.Time) (time.Time, time.Time, error) {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	switch period {
+	case Weekly:
+		from := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return from, from.AddDate(0, 0, 7), nil
+	case Monthly:
+		from := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+		return from, from.AddDate(0, 1, 0), nil
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("unknown roster period %s", period)
+	}
+}
+
+// BuildRoster lays out the entries as a grid of days, one page per week and per project
+// (rows are employees) or per employee (rows are projects).
+func BuildRoster(opts RosterOptions, projects []types.Project, entries []types.PlanningEntry, users []types.User) (*Roster, error) {
+	from, to, err := PeriodBounds(opts.Period, opts.Date)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Grouping == "" {
+		opts.Grouping = ByProject
+	}
+	if opts.Grouping != ByProject && opts.Grouping != ByEmployee {
+		return nil, fmt.Errorf("unknown roster grouping %s", opts.Grouping)
+	}
+
+	projectsByID := make(map[string]types.Project, len(projects))
+	for _, p := range projects {
+		projectsByID[p.ID] = p
+	}
+	usersByID := make(map[string]types.User, len(users))
+	for _, u := range users {
+		usersByID[u.ID] = u
+	}
+
+	type slot struct {
+		entry types.PlanningEntry
+		start time.Time
+		end   time.Time
+	}
+	slots := make([]slot, 0, len(entries))
+	for _, entry := range entries {
+		if _, ok := projectsByID[entry.ProjectID]; !ok {
+			continue
+		}
+		start, err := time.ParseInLocation(types.BelgianDateTimeFormat, entry.Start, opts.Date.Location())
+		if err != nil {
+			return nil, err
+		}
+		end, err := time.ParseInLocation(types.BelgianDateTimeFormat, entry.End, opts.Date.Location())
+		if err != nil {
+			return nil, err
+		}
+		if start.Before(from) || !start.Before(to) {
+			continue
+		}
+		slots = append(slots, slot{entry: entry, start: start, end: end})
+	}
+	slices.SortFunc(slots, func(a, b slot) int { return a.start.Compare(b.start) })
+
+	weeks := make([][]time.Time, 0, 6)
+	for d := from; d.Before(to); d = d.AddDate(0, 0, 1) {
+		if len(weeks) == 0 || d.Weekday() == time.Monday {
+			weeks = append(weeks, make([]time.Time, 0, 7))
+		}
+		weeks[len(weeks)-1] = append(weeks[len(weeks)-1], d)
+	}
+
+	// page key -> row key -> lines per day
+	type pageKey struct {
+		id    string
+		label string
+	}
+	pageKeys := make([]pageKey, 0, 10)
+	cells := make(map[string]map[string]map[string][]string)
+	addLine := func(page pageKey, row string, day time.Time, line string) {
+		if _, ok := cells[page.id]; !ok {
+			cells[page.id] = make(map[string]map[string][]string)
+			pageKeys = append(pageKeys, page)
+		}
+		if _, ok := cells[page.id][row]; !ok {
+			cells[page.id][row] = make(map[string][]string)
+		}
+		dayKey := day.Format(types.BelgianDateFormat)
+		cells[page.id][row][dayKey] = append(cells[page.id][row][dayKey], line)
+	}
+
+	if opts.Grouping == ByProject {
+		for _, p := range projects {
+			if p.Archived {
+				continue
+			}
+			pageKeys = append(pageKeys, pageKey{id: p.ID, label: p.Name})
+			cells[p.ID] = make(map[string]map[string][]string)
+		}
+	}
+
+	for _, s := range slots {
+		hours := fmt.Sprintf("%s-%s", s.start.Format("15:04"), s.end.Format("15:04"))
+		project := projectsByID[s.entry.ProjectID]
+		switch opts.Grouping {
+		case ByProject:
+			page := pageKey{id: project.ID, label: project.Name}
+			if len(s.entry.EmployeeIDs) == 0 {
+				addLine(page, opts.Labels.Unassigned, s.start, hours)
+			}
+			for _, employeeID := range s.entry.EmployeeIDs {
+				addLine(page, userLabel(usersByID, employeeID), s.start, hours)
+			}
+		case ByEmployee:
+			for _, employeeID := range s.entry.EmployeeIDs {
+				page := pageKey{id: employeeID, label: userLabel(usersByID, employeeID)}
+				addLine(page, project.Name, s.start, hours)
+			}
+		}
+	}
+	if opts.Grouping == ByEmployee {
+		slices.SortFunc(pageKeys, func(a, b pageKey) int { return strings.Compare(a.label, b.label) })
+	}
+
+	roster := &Roster{
+		OrganizationName: opts.OrganizationName,
+		Title:            periodTitle(opts, from, to),
+		EmptyMessage:     opts.Labels.Empty,
+		Pages:            make([]RosterPage, 0, len(pageKeys)*len(weeks)),
+	}
+	for _, key := range pageKeys {
+		rowLabels := make([]string, 0, len(cells[key.id]))
+		for label := range cells[key.id] {
+			rowLabels = append(rowLabels, label)
+		}
+		slices.Sort(rowLabels)
+		for _, week := range weeks {
+			page := RosterPage{
+				Title:      key.label,
+				Subtitle:   fmt.Sprintf("%s %d", opts.Labels.Week, isoWeek(week[0])),
+				Days:       week,
+				DayHeaders: make([]string, 0, len(week)),
+				Rows:       make([]RosterRow, 0, len(rowLabels)),
+			}
+			for _, day := range week {
+				page.DayHeaders = append(page.DayHeaders, fmt.Sprintf("%s %s", opts.Labels.Days[day.Weekday()], day.Format("02/01")))
+			}
+			for _, label := range rowLabels {
+				row := RosterRow{Label: label, Cells: make([][]string, len(week))}
+				for i, day := range week {
+					row.Cells[i] = cells[key.id][label][day.Format(types.BelgianDateFormat)]
+				}
+				page.Rows = append(page.Rows, row)
+			}
+			roster.Pages = append(roster.Pages, page)
+		}
+	}
+	return roster, nil
+}
+
+func userLabel(usersByID map[string]types.User, id string) string {
+	user, ok := usersByID[id]
+	if !ok {
+		return id
+	}
+	if name := strings.TrimSpace(user.Profile.FirstName + " " + user.Profile.LastName); name != "" {
+		return name
+	}
+	return user.Username
+}
+
+func isoWeek(d time.Time) int {
+	_, week := d.ISOWeek()
+	return week
+}
+
+func periodTitle(opts RosterOptions, from time.Time, to time.Time) string {
+	if opts.Period == Monthly {
+		return fmt.Sprintf("%s %d", opts.Labels.Months[from.Month()-1], from.Year())
+	}
+	return fmt.Sprintf("%s - %s", from.Format(types.BelgianDateFormat), to.AddDate(0, 0, -1).Format(types.BelgianDateFormat))
+}
+
+// Render writes the roster as a landscape A4 pdf.
+func (roster *Roster) Render(w io.Writer) error {
+	doc := fpdf.New("L", "mm", "A4", "")
+	doc.SetMargins(pageMargin, pageMargin, pageMargin)
+	doc.SetAutoPageBreak(false, pageMargin)
+	tr := doc.UnicodeTranslatorFromDescriptor("") // cp1252, enough for en/fr
+	pageWidth, pageHeight := doc.GetPageSize()
+
+	header := func(title string, subtitle string) {
+		doc.AddPage()
+		doc.SetFont("Helvetica", "B", 14)
+		doc.CellFormat(0, 7, tr(roster.OrganizationName), "", 1, "L", false, 0, "")
+		doc.SetFont("Helvetica", "", 11)
+		doc.CellFormat(0, 6, tr(strings.TrimSpace(fmt.Sprintf("%s  %s  %s", title, subtitle, roster.Title))), "", 1, "L", false, 0, "")
+		doc.Ln(2)
+	}
+
+	if len(roster.Pages) == 0 {
+		header("", "")
+		doc.SetFont("Helvetica", "I", 10)
+		doc.CellFormat(0, 6, tr(roster.EmptyMessage), "", 1, "L", false, 0, "")
+	}
+
+	for _, page := range roster.Pages {
+		header(page.Title, page.Subtitle)
+		columnWidth := (pageWidth - 2*pageMargin - labelWidth) / float64(max(len(page.Days), 1))
+
+		drawHeader := func() {
+			doc.SetFont("Helvetica", "B", 9)
+			doc.SetFillColor(230, 230, 230)
+			doc.CellFormat(labelWidth, headerHeight, "", "1", 0, "C", true, 0, "")
+			for _, dayHeader := range page.DayHeaders {
+				doc.CellFormat(columnWidth, headerHeight, tr(dayHeader), "1", 0, "C", true, 0, "")
+			}
+			doc.Ln(-1)
+			doc.SetFont("Helvetica", "", 8)
+		}
+		drawHeader()
+
+		for _, row := range page.Rows {
+			lines := 1
+			for _, cell := range row.Cells {
+				lines = max(lines, len(cell))
+			}
+			rowHeight := float64(lines)*lineHeight + 2
+			if doc.GetY()+rowHeight > pageHeight-pageMargin {
+				header(page.Title, page.Subtitle)
+				drawHeader()
+			}
+			x, y := doc.GetXY()
+			doc.Rect(x, y, labelWidth, rowHeight, "D")
+			doc.SetXY(x+1, y+1)
+			doc.CellFormat(labelWidth-2, lineHeight, tr(row.Label), "", 0, "L", false, 0, "")
+			for i, cell := range row.Cells {
+				cellX := x + labelWidth + float64(i)*columnWidth
+				doc.Rect(cellX, y, columnWidth, rowHeight, "D")
+				for j, line := range cell {
+					doc.SetXY(cellX, y+1+float64(j)*lineHeight)
+					doc.CellFormat(columnWidth, lineHeight, tr(line), "", 0, "C", false, 0, "")
+				}
+			}
+			doc.SetXY(x, y+rowHeight)
+		}
+	}
+	return doc.Output(w)
+}
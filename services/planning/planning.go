@@ -0,0 +1,345 @@
+// Package planning checks the availability of the employees and assigns them to planning
+// entries. It only goes through the repositories, so that it can be tested without mongo.
+package planning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nbittich/wtm/services/repository"
+	"github.com/nbittich/wtm/types"
+)
+
+type Planner struct {
+	repos repository.Repositories
+}
+
+func New(repos repository.Repositories) *Planner {
+	return &Planner{repos: repos}
+}
+
+// AssignmentResult tells who was unassigned from, and who was newly assigned to, an entry.
+type AssignmentResult struct {
+	UsersToBeCancelled     []types.User
+	FilteredUsersNewAssign []types.User
+	Entry                  types.PlanningEntry
+	Project                types.Project
+}
+
+func (p *Planner) IsUserAvailable(ctx context.Context, user *types.User, entry *types.PlanningEntry, group types.Group) (bool, error) {
+	var (
+		err                                    error
+		assignedStart, assignedEnd, start, end time.Time
+		ok                                     bool
+	)
+
+	if user.Profile.Availability != nil {
+		if ok, err = user.Profile.Availability.IsAvailable(entry.Start, entry.End); err != nil || !ok {
+			return ok, err
+		}
+	}
+	details, err := p.repos.Assignments.FindDetails(ctx, group, repository.AssignmentFilter{EmployeeID: user.ID})
+	if err != nil {
+		return false, err
+	}
+	for _, detail := range details {
+		if detail.Entry.ID == entry.ID {
+			continue
+		}
+		if assignedStart, err = time.Parse(types.BelgianDateTimeFormat, detail.Entry.Start); err != nil {
+			return false, err
+		}
+		if assignedEnd, err = time.Parse(types.BelgianDateTimeFormat, detail.Entry.End); err != nil {
+			return false, err
+		}
+		if start, err = time.Parse(types.BelgianDateTimeFormat, entry.Start); err != nil {
+			return false, err
+		}
+		if end, err = time.Parse(types.BelgianDateTimeFormat, entry.End); err != nil {
+			return false, err
+		}
+		if !end.Before(assignedStart) && !start.After(assignedEnd) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (p *Planner) CheckEntriesValid(ctx context.Context, entries []types.PlanningEntry, group types.Group) (*types.PlanningValidity, error) {
+	valid := types.PlanningValidity{
+		Valid:    true,
+		Comments: make([]types.Comment, 0, 10),
+	}
+	usersCache := make(map[string]types.User, 2)
+	var (
+		user   types.User
+		exists bool
+		err    error
+	)
+	for _, entry := range entries {
+		for _, userID := range entry.EmployeeIDs {
+			if user, exists = usersCache[userID]; !exists {
+				if user, err = p.repos.Users.FindByID(ctx, group, userID); err != nil {
+					log.Println("could not fetch user with id '", userID, "'")
+					return nil, err
+				}
+				usersCache[userID] = user
+			}
+			ok, err := p.IsUserAvailable(ctx, &user, &entry, group)
+			if err != nil {
+				log.Println("could not check if user available")
+				return nil, err
+			}
+			if !ok {
+				valid.Comments = append(valid.Comments, types.Comment{
+					UserID:      user.ID,
+					Message:     fmt.Sprintf("Cannot assign %s for %s-> %s", user.Username, entry.Start, entry.End),
+					CommentType: types.WARNING,
+					CreatedAt:   time.Now(),
+					UpdatedAt:   nil,
+				})
+				valid.Valid = false
+			}
+		}
+	}
+	return &valid, nil
+}
+
+// AssignOrUnassign brings the assignments of the entry in line with its employees. Employees no
+// longer available are removed from the entry, with a comment.
+func (p *Planner) AssignOrUnassign(ctx context.Context, entry types.PlanningEntry, project types.Project, group types.Group) (*AssignmentResult, error) {
+	existingAssignements, err := p.repos.Assignments.Find(ctx, group, repository.AssignmentFilter{EntryID: entry.ID, ActiveOnly: true})
+	if err != nil {
+		log.Println("could not fetch existing assignments", err)
+		return nil, err
+	}
+	// delete employee ids that are not available
+	// add a comment if user was not available and therefore removed
+
+	valid, err := p.CheckEntriesValid(ctx, []types.PlanningEntry{entry}, group)
+	if err != nil {
+		log.Println("could not validate entry", entry.ID, "=>", entry.EmployeeIDs, "=>", len(entry.EmployeeIDs))
+		return nil, err
+	}
+	if !valid.Valid {
+		entry.Comments = append(entry.Comments, valid.Comments...)
+		entry.EmployeeIDs = slices.DeleteFunc(entry.EmployeeIDs, func(id string) bool {
+			return slices.ContainsFunc(valid.Comments, func(comment types.Comment) bool {
+				return comment.UserID == id
+			})
+		})
+		if err = p.repos.Planning.Save(ctx, group, &entry); err != nil {
+			return nil, err
+		}
+	}
+
+	assignmentsToUpdate := make([]*types.PlanningAssignment, 0, len(existingAssignements))
+	filteredUsersNewAssign := make([]types.User, 0, len(existingAssignements))
+	filteredUsersCancelledAssign := make([]string, 0, len(existingAssignements))
+	for _, assignment := range existingAssignements {
+		if !slices.Contains(entry.EmployeeIDs, assignment.EmployeeID) {
+			assignment.Cancelled = true
+			assignment.UpdatedAt = time.Now()
+			assignmentsToUpdate = append(assignmentsToUpdate, &assignment)
+			filteredUsersCancelledAssign = append(filteredUsersCancelledAssign, assignment.EmployeeID)
+		}
+	}
+	usersToBeCancelled, err := p.repos.Users.FindByIDs(ctx, group, filteredUsersCancelledAssign)
+	if err != nil {
+		log.Println("could not get users to unassign them", err)
+		return nil, err
+	}
+
+	users, err := p.repos.Users.FindByIDs(ctx, group, entry.EmployeeIDs)
+	if err != nil {
+		log.Println("could not get users to assign them", err)
+		return nil, err
+	}
+	for _, user := range users {
+		if !slices.ContainsFunc(existingAssignements, func(a types.PlanningAssignment) bool {
+			return a.EmployeeID == user.ID
+		}) {
+			filteredUsersNewAssign = append(filteredUsersNewAssign, user)
+			assignmentsToUpdate = append(assignmentsToUpdate, &types.PlanningAssignment{
+				EntryID:    entry.ID,
+				EmployeeID: user.ID,
+				CreatedAt:  time.Now(),
+				SendDate:   time.Now(),
+				Cancelled:  false,
+			})
+		}
+	}
+	if len(assignmentsToUpdate) > 0 {
+		if err = p.repos.Assignments.SaveMany(ctx, group, assignmentsToUpdate); err != nil {
+			log.Println("Could not update assignments", err)
+			return nil, err
+		}
+	}
+	return &AssignmentResult{
+		UsersToBeCancelled:     usersToBeCancelled,
+		FilteredUsersNewAssign: filteredUsersNewAssign,
+		Entry:                  entry,
+		Project:                project,
+	}, nil
+}
+
+// restoreTimeout bounds the compensation, which runs even if the caller's context is done.
+const restoreTimeout = 30 * time.Second
+
+// SaveAndAssign saves the entry and, when assign is set, brings its assignments in line with
+// its employees. Both are committed in one transaction when the storage supports it. Otherwise
+// the entry and its assignments are put back as they were when something fails midway. The
+// emails are up to the caller, once this returned without error.
+func (p *Planner) SaveAndAssign(ctx context.Context, entry types.PlanningEntry, project types.Project, group types.Group, assign bool) (*AssignmentResult, error) {
+	isNew := entry.ID == ""
+	if isNew {
+		// known beforehand, so that the compensation can remove the entry
+		entry.ID = uuid.New().String()
+	}
+	var result *AssignmentResult
+	work := func(ctx context.Context) error {
+		saved := entry // a retried transaction starts over from the entry given
+		if err := p.repos.Planning.Save(ctx, group, &saved); err != nil {
+			return err
+		}
+		if !assign {
+			result = &AssignmentResult{Entry: saved, Project: project}
+			return nil
+		}
+		var err error
+		result, err = p.AssignOrUnassign(ctx, saved, project, group)
+		return err
+	}
+	if err := p.atomically(ctx, group, entry.ID, isNew, work); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Delete soft-deletes the entry and cancels its assignments, atomically like SaveAndAssign. The
+// employees who were assigned are in UsersToBeCancelled.
+func (p *Planner) Delete(ctx context.Context, entry types.PlanningEntry, project types.Project, group types.Group, at time.Time) (*AssignmentResult, error) {
+	var result *AssignmentResult
+	work := func(ctx context.Context) error {
+		deleted := entry
+		deleted.DeletedAt = &at
+		if err := p.repos.Planning.Save(ctx, group, &deleted); err != nil {
+			return err
+		}
+		active, err := p.repos.Assignments.Find(ctx, group, repository.AssignmentFilter{EntryID: entry.ID, ActiveOnly: true})
+		if err != nil {
+			return err
+		}
+		cancelled := make([]*types.PlanningAssignment, 0, len(active))
+		employeeIDs := make([]string, 0, len(active))
+		for i := range active {
+			active[i].Cancelled = true
+			active[i].UpdatedAt = at
+			cancelled = append(cancelled, &active[i])
+			employeeIDs = append(employeeIDs, active[i].EmployeeID)
+		}
+		users, err := p.repos.Users.FindByIDs(ctx, group, employeeIDs)
+		if err != nil {
+			return err
+		}
+		if err = p.repos.Assignments.SaveMany(ctx, group, cancelled); err != nil {
+			return err
+		}
+		result = &AssignmentResult{UsersToBeCancelled: users, Entry: deleted, Project: project}
+		return nil
+	}
+	if err := p.atomically(ctx, group, entry.ID, false, work); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// atomically runs the work on the entry in a transaction, or with compensation when the storage
+// has no transactions.
+func (p *Planner) atomically(ctx context.Context, group types.Group, entryID string, isNew bool, work func(ctx context.Context) error) error {
+	err := p.repos.Transactions.WithTransaction(ctx, work)
+	if errors.Is(err, repository.ErrNoTransaction) {
+		err = p.withCompensation(ctx, group, entryID, isNew, work)
+	}
+	return err
+}
+
+// withCompensation runs the work without transaction. When it fails, the entry and its
+// assignments are put back as they were before.
+func (p *Planner) withCompensation(ctx context.Context, group types.Group, entryID string, isNew bool, work func(ctx context.Context) error) error {
+	var original *types.PlanningEntry
+	if !isNew {
+		entry, err := p.repos.Planning.FindByID(ctx, group, entryID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		if err == nil {
+			original = &entry
+		}
+	}
+	assignments, err := p.repos.Assignments.Find(ctx, group, repository.AssignmentFilter{EntryID: entryID})
+	if err != nil {
+		return err
+	}
+	if err = work(ctx); err == nil {
+		return nil
+	}
+	restoreCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), restoreTimeout)
+	defer cancel()
+	if restoreErr := p.restore(restoreCtx, group, entryID, original, assignments); restoreErr != nil {
+		log.Println("could not put back planning entry", entryID, restoreErr)
+		return errors.Join(err, restoreErr)
+	}
+	return err
+}
+
+// restore puts back the entry, or removes it when there was none, and its assignments. What the
+// work didn't touch is left alone.
+func (p *Planner) restore(ctx context.Context, group types.Group, entryID string, original *types.PlanningEntry, assignments []types.PlanningAssignment) error {
+	var err error
+	if original == nil {
+		err = p.repos.Planning.Delete(ctx, group, entryID)
+	} else {
+		current, findErr := p.repos.Planning.FindByID(ctx, group, entryID)
+		if findErr != nil && !errors.Is(findErr, repository.ErrNotFound) {
+			return findErr
+		}
+		if findErr != nil || current.Version != original.Version {
+			// the work saved the entry, the original takes its place
+			original.Version = current.Version
+			err = p.repos.Planning.Save(ctx, group, original)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	current, err := p.repos.Assignments.Find(ctx, group, repository.AssignmentFilter{EntryID: entryID})
+	if err != nil {
+		return err
+	}
+	inserted := make([]string, 0, len(current))
+	for _, assignment := range current {
+		if !slices.ContainsFunc(assignments, func(a types.PlanningAssignment) bool { return a.ID == assignment.ID }) {
+			inserted = append(inserted, assignment.ID)
+		}
+	}
+	if err = p.repos.Assignments.Delete(ctx, group, inserted); err != nil {
+		return err
+	}
+	changed := make([]*types.PlanningAssignment, 0, len(assignments))
+	for i := range assignments {
+		if !slices.Contains(current, assignments[i]) {
+			changed = append(changed, &assignments[i])
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	return p.repos.Assignments.SaveMany(ctx, group, changed)
+}
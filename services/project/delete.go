@@ -0,0 +1,293 @@
+package project
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services/planning"
+	"github.com/nbittich/wtm/services/repository"
+	"github.com/nbittich/wtm/types"
+)
+
+var (
+	ErrDeleted          = errors.New("already deleted")
+	ErrNotDeleted       = errors.New("not deleted")
+	ErrRetentionExpired = errors.New("deleted for longer than the retention period")
+)
+
+// deletionTime is truncated to the millisecond stored by mongo, so that the entries deleted with
+// their project can be told apart when it is restored.
+func deletionTime() time.Time {
+	return time.Now().Truncate(time.Millisecond)
+}
+
+func checkRestorable(deletedAt *time.Time) error {
+	if deletedAt == nil {
+		return ErrNotDeleted
+	}
+	if time.Since(*deletedAt) > config.DeletedRetention {
+		return ErrRetentionExpired
+	}
+	return nil
+}
+
+// checkNotDeleted returns ErrDeleted if the document was soft-deleted. A new or unknown one is not.
+func checkNotDeleted[T interface{ GetDeletedAt() *time.Time }](ctx context.Context, id string, find func(context.Context, types.Group, string) (T, error), group types.Group) error {
+	if id == "" {
+		return nil
+	}
+	doc, err := find(ctx, group, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if doc.GetDeletedAt() != nil {
+		return ErrDeleted
+	}
+	return nil
+}
+
+// findEntry returns the entry, deleted or not, and its project. An entry of another project is
+// not found.
+func findEntry(ctx context.Context, projectID string, entryID string, group types.Group) (types.PlanningEntry, types.Project, error) {
+	entry, err := repos.Planning.FindByID(ctx, group, entryID)
+	if err != nil {
+		return entry, types.Project{}, err
+	}
+	if entry.ProjectID != projectID {
+		return entry, types.Project{}, repository.ErrNotFound
+	}
+	project, err := repos.Projects.FindByID(ctx, group, projectID)
+	return entry, project, err
+}
+
+// GetDeletedPlanning returns the soft-deleted entries of the project, which can still be restored.
+func GetDeletedPlanning(ctx context.Context, projectID string, group types.Group) ([]types.PlanningEntry, error) {
+	return repos.Planning.FindDeleted(ctx, group, projectID)
+}
+
+// DeletePlanningEntry soft-deletes the entry, cancels its assignments and notifies the employees.
+func DeletePlanningEntry(ctx context.Context, projectID string, entryID string, group types.Group) (*types.PlanningEntry, error) {
+	entry, project, err := findEntry(ctx, projectID, entryID, group)
+	if err != nil {
+		return nil, err
+	}
+	if entry.DeletedAt != nil {
+		return nil, ErrDeleted
+	}
+	result, err := planner.Delete(ctx, entry, project, group, deletionTime())
+	if err != nil {
+		return nil, err
+	}
+	sendMailAssignOrUnassign([]planning.AssignmentResult{*result})
+	return &result.Entry, nil
+}
+
+// DeletePlanningRange soft-deletes the entries of the project starting within [from, to), like
+// DeletePlanningEntry. The employees get one email for all of them. On error, the entries
+// deleted so far are returned, and their employees notified.
+func DeletePlanningRange(ctx context.Context, projectID string, from time.Time, to time.Time, group types.Group) ([]types.PlanningEntry, error) {
+	project, err := repos.Projects.FindByID(ctx, group, projectID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := repos.Planning.FindByProject(ctx, group, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return deleteEntries(ctx, entries, project, group, deletionTime(), func(entry types.PlanningEntry) bool {
+		start, err := time.ParseInLocation(types.BelgianDateTimeFormat, entry.Start, time.Local)
+		if err != nil {
+			log.Println("could not parse start of entry", entry.ID, err)
+			return false
+		}
+		return !start.Before(from) && start.Before(to)
+	})
+}
+
+func deleteEntries(ctx context.Context, entries []types.PlanningEntry, project types.Project, group types.Group, at time.Time, keep func(entry types.PlanningEntry) bool) ([]types.PlanningEntry, error) {
+	deleted := make([]types.PlanningEntry, 0, len(entries))
+	results := make([]planning.AssignmentResult, 0, len(entries))
+	defer func() {
+		sendMailAssignOrUnassign(results)
+	}()
+	for _, entry := range entries {
+		if !keep(entry) {
+			continue
+		}
+		result, err := planner.Delete(ctx, entry, project, group, at)
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, result.Entry)
+		results = append(results, *result)
+	}
+	return deleted, nil
+}
+
+// RestorePlanningEntry restores a soft-deleted entry. Its employees are assigned again, but the
+// ones no longer available, and notified.
+func RestorePlanningEntry(ctx context.Context, projectID string, entryID string, group types.Group) (*types.PlanningEntry, error) {
+	entry, project, err := findEntry(ctx, projectID, entryID, group)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkRestorable(entry.DeletedAt); err != nil {
+		return nil, err
+	}
+	if project.DeletedAt != nil {
+		return nil, ErrDeleted
+	}
+	entry.DeletedAt = nil
+	result, err := planner.SaveAndAssign(ctx, entry, project, group, true)
+	if err != nil {
+		return nil, err
+	}
+	sendMailAssignOrUnassign([]planning.AssignmentResult{*result})
+	return &result.Entry, nil
+}
+
+// DeleteProject soft-deletes the project with all its entries, whose employees are notified.
+// The project is marked deleted first, so that it is hidden even when deleting an entry fails.
+// Deleting it again then deletes the remaining entries, at the time of the project so that they
+// are restored with it.
+func DeleteProject(ctx context.Context, projectID string, group types.Group) (*types.Project, error) {
+	project, err := repos.Projects.FindByID(ctx, group, projectID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := repos.Planning.FindByProject(ctx, group, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if project.DeletedAt == nil {
+		at := deletionTime()
+		project.DeletedAt = &at
+		if err = repos.Projects.Save(ctx, group, &project); err != nil {
+			return nil, err
+		}
+	} else if len(entries) == 0 {
+		return nil, ErrDeleted
+	}
+	if _, err = deleteEntries(ctx, entries, project, group, *project.DeletedAt, func(types.PlanningEntry) bool { return true }); err != nil {
+		return &project, err
+	}
+	return &project, nil
+}
+
+// RestoreProject restores a soft-deleted project and the entries deleted with it. The entries
+// deleted before the project stay deleted.
+func RestoreProject(ctx context.Context, projectID string, group types.Group) (*types.Project, error) {
+	project, err := repos.Projects.FindByID(ctx, group, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkRestorable(project.DeletedAt); err != nil {
+		return nil, err
+	}
+	deletedAt := *project.DeletedAt
+	project.DeletedAt = nil
+	if err = repos.Projects.Save(ctx, group, &project); err != nil {
+		return nil, err
+	}
+	entries, err := repos.Planning.FindDeleted(ctx, group, projectID)
+	if err != nil {
+		return &project, err
+	}
+	results := make([]planning.AssignmentResult, 0, len(entries))
+	defer func() {
+		sendMailAssignOrUnassign(results)
+	}()
+	for _, entry := range entries {
+		if !entry.DeletedAt.Equal(deletedAt) {
+			continue
+		}
+		entry.DeletedAt = nil
+		result, err := planner.SaveAndAssign(ctx, entry, project, group, true)
+		if err != nil {
+			return &project, err
+		}
+		results = append(results, *result)
+	}
+	return &project, nil
+}
+
+// purgeEntry removes for good the entry and its assignments.
+func purgeEntry(ctx context.Context, entryID string, group types.Group) error {
+	assignments, err := repos.Assignments.Find(ctx, group, repository.AssignmentFilter{EntryID: entryID})
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(assignments))
+	for _, assignment := range assignments {
+		ids = append(ids, assignment.ID)
+	}
+	if err = repos.Assignments.Delete(ctx, group, ids); err != nil {
+		return err
+	}
+	return repos.Planning.Delete(ctx, group, entryID)
+}
+
+// PurgeDeleted removes for good the entries, with their assignments, and the projects of the
+// group soft-deleted before the given time. The entries a failed DeleteProject left are purged
+// with their project. It returns how many documents were purged.
+func PurgeDeleted(ctx context.Context, before time.Time, group types.Group) (int, error) {
+	purged := 0
+	entries, err := repos.Planning.FindDeleted(ctx, group, "")
+	if err != nil {
+		return purged, err
+	}
+	for _, entry := range entries {
+		if !entry.DeletedAt.Before(before) {
+			continue
+		}
+		if err = purgeEntry(ctx, entry.ID, group); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	projects, err := repos.Projects.FindDeleted(ctx, group)
+	if err != nil {
+		return purged, err
+	}
+	for _, project := range projects {
+		if !project.DeletedAt.Before(before) {
+			continue
+		}
+		leftovers, err := repos.Planning.FindByProject(ctx, group, project.ID)
+		if err != nil {
+			return purged, err
+		}
+		for _, entry := range leftovers {
+			if err = purgeEntry(ctx, entry.ID, group); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+		if err = repos.Projects.Delete(ctx, group, project.ID); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// PurgeAllDeleted purges the documents deleted for longer than the retention period, in every
+// group. A failing group doesn't stop the others.
+func PurgeAllDeleted(ctx context.Context, now time.Time) (int, error) {
+	purged := 0
+	var errs []error
+	for _, group := range dbClient.ListGroups() {
+		n, err := PurgeDeleted(ctx, now.Add(-config.DeletedRetention), group)
+		purged += n
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return purged, errors.Join(errs...)
+}
@@ -0,0 +1,85 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/services/fairness"
+	"github.com/nbittich/wtm/services/repository"
+	"github.com/nbittich/wtm/types"
+)
+
+// loadFairnessTracker replays the non cancelled assignments on work projects starting within [from, to).
+func loadFairnessTracker(ctx context.Context, from time.Time, to time.Time, group types.Group) (*fairness.Tracker, error) {
+	rules, err := GetPayrollRules(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	details, err := repos.Assignments.FindDetails(ctx, group, repository.AssignmentFilter{ActiveOnly: true, StartFrom: from, StartTo: to})
+	if err != nil {
+		return nil, err
+	}
+	tracker := fairness.NewTracker(rules, types.DefaultFairnessWeights())
+	for _, detail := range details {
+		if detail.Project == nil || detail.Project.Type != types.Work {
+			continue
+		}
+		start, err := time.ParseInLocation(types.BelgianDateTimeFormat, detail.Entry.Start, from.Location())
+		if err != nil {
+			return nil, err
+		}
+		end, err := time.ParseInLocation(types.BelgianDateTimeFormat, detail.Entry.End, from.Location())
+		if err != nil {
+			return nil, err
+		}
+		tracker.Add(fairness.AssignedShift{EmployeeID: detail.EmployeeID, Start: start, End: end, Unpopular: detail.Entry.Unpopular})
+	}
+	return tracker, nil
+}
+
+// GetFairnessReport scores how weekend, night, holiday and unpopular shifts were spread over [from, to)
+// across the enabled users of the organization.
+func GetFairnessReport(ctx context.Context, from time.Time, to time.Time, group types.Group) (*types.FairnessReport, error) {
+	tracker, err := loadFairnessTracker(ctx, from, to, group)
+	if err != nil {
+		return nil, err
+	}
+	users, err := services.AllUsers(ctx, group, nil)
+	if err != nil {
+		return nil, err
+	}
+	users = slices.DeleteFunc(users, func(user types.User) bool {
+		return !user.CanSignIn() || !slices.Contains(user.Roles, types.USER)
+	})
+	report := tracker.Report(from, to, users)
+	return &report, nil
+}
+
+// balanceCycleEntries replaces the employees of each generated entry by the ones with the lowest
+// fairness score over the last config.FairnessLookbackWeeks weeks.
+func balanceCycleEntries(ctx context.Context, cycle *types.PlanningCycle, startDay time.Time, entries []types.PlanningEntry, group types.Group) error {
+	perShift := max(cycle.EmployeesPerShift, 1)
+	if perShift > 1 && !cycle.AllowMultipleAssignment {
+		return fmt.Errorf("multiple assignment is not allowed for this entry")
+	}
+	tracker, err := loadFairnessTracker(ctx, startDay.AddDate(0, 0, -7*config.FairnessLookbackWeeks), startDay, group)
+	if err != nil {
+		return err
+	}
+	for i, entry := range entries {
+		start, err := time.Parse(types.BelgianDateTimeFormat, entry.Start)
+		if err != nil {
+			return err
+		}
+		end, err := time.Parse(types.BelgianDateTimeFormat, entry.End)
+		if err != nil {
+			return err
+		}
+		entries[i].EmployeeIDs = tracker.Pick(cycle.EmployeeIDs, perShift, start, end, cycle.Unpopular)
+	}
+	return nil
+}
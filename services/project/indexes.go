@@ -0,0 +1,30 @@
+package project
+
+import (
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/db/index"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func init() {
+	db.RegisterGroupIndexes(PlanningCollection,
+		index.Spec{Keys: index.Ascending("projectId")},
+		// only the soft-deleted entries have it, for the purge
+		index.Spec{Keys: index.Ascending("deletedAt"), Sparse: true},
+	)
+	db.RegisterGroupIndexes(PlanningAssignmentCollection,
+		// also serves the queries on employeeId alone
+		index.Spec{Keys: index.Ascending("employeeId", "cancelled")},
+		index.Spec{Keys: index.Ascending("entryId")},
+		index.Spec{Keys: index.Ascending("cancelled")},
+	)
+	db.RegisterGroupIndexes(ClockPunchCollection,
+		index.Spec{Keys: index.Ascending("employeeId", "in")},
+		// a single open punch per employee, even when clocking in twice concurrently
+		index.Spec{Keys: index.Ascending("employeeId"), Unique: true, PartialFilter: bson.D{{Key: "out", Value: nil}}},
+		index.Spec{Keys: index.Ascending("in")},
+	)
+	db.RegisterGroupIndexes(TimeInLieuAdjustmentCollection,
+		index.Spec{Keys: index.Ascending("userId")},
+	)
+}
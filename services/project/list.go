@@ -0,0 +1,66 @@
+package project
+
+import (
+	"context"
+
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/db/query"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ProjectQuery = query.Spec{
+		Sorts:       map[string]string{"name": "projectName", "type": "projectType", "createdAt": "createdAt"},
+		DefaultSort: "name",
+	}
+	// the entries are sorted by their parsed start, the stored one is not sortable
+	PlanningQuery = query.Spec{
+		Sorts:       map[string]string{"start": "startDate", "title": "title", "createdAt": "createdAt"},
+		DefaultSort: "start",
+	}
+)
+
+// ListProjects returns a page of the projects which are not deleted.
+func ListProjects(ctx context.Context, filter types.ProjectFilter, page query.Page, group types.Group) (query.Result[types.Project], error) {
+	collection, err := dbClient.Collection(ProjectCollection, group)
+	if err != nil {
+		return query.Result[types.Project]{}, err
+	}
+	match := bson.M{"deletedAt": nil}
+	if filter.Type != "" {
+		match["projectType"] = filter.Type
+	}
+	if filter.Archived != nil {
+		match["archived"] = *filter.Archived
+	}
+	return db.FindPage[types.Project](ctx, collection, mongo.Pipeline{{{Key: "$match", Value: match}}}, page)
+}
+
+// ListPlanning returns a page of the entries of the project which are not deleted.
+func ListPlanning(ctx context.Context, projectID string, filter types.PlanningFilter, page query.Page, group types.Group) (query.Result[types.PlanningEntry], error) {
+	collection, err := dbClient.Collection(PlanningCollection, group)
+	if err != nil {
+		return query.Result[types.PlanningEntry]{}, err
+	}
+	match := bson.M{"projectId": projectID, "deletedAt": nil}
+	if filter.EmployeeID != "" {
+		match["employeeIds"] = filter.EmployeeID
+	}
+	stages := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$addFields", Value: bson.M{"startDate": db.ParseBelgianDateTime("$start")}}},
+	}
+	start := bson.M{}
+	if filter.From != nil {
+		start["$gte"] = *filter.From
+	}
+	if filter.To != nil {
+		start["$lt"] = *filter.To
+	}
+	if len(start) > 0 {
+		stages = append(stages, bson.D{{Key: "$match", Value: bson.M{"startDate": start}}})
+	}
+	return db.FindPage[types.PlanningEntry](ctx, collection, stages, page)
+}
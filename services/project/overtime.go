@@ -0,0 +1,88 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/payroll"
+	"github.com/nbittich/wtm/services/utils"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const TimeInLieuAdjustmentCollection = "timeInLieuAdjustment"
+
+// GetOvertime returns the weekly and monthly overtime of a user over [from, to).
+func GetOvertime(ctx context.Context, userID string, from time.Time, to time.Time, group types.Group) (*types.OvertimeSummary, error) {
+	user, err := services.FindUserByID(ctx, userID, group)
+	if err != nil {
+		return nil, err
+	}
+	// whole weeks, so that the first and last weeks are not truncated
+	shifts, err := GetWorkedShifts(ctx, userID, payroll.StartOfWeek(from), payroll.StartOfWeek(to).AddDate(0, 0, 7), group)
+	if err != nil {
+		return nil, err
+	}
+	weeks, months := payroll.ComputeOvertime(user.Profile.ContractualHours, from, to, shifts)
+	return &types.OvertimeSummary{
+		UserID:           user.ID,
+		ContractualHours: user.Profile.ContractualHours,
+		Weeks:            weeks,
+		Months:           months,
+	}, nil
+}
+
+func GetTimeInLieuBalance(ctx context.Context, userID string, group types.Group) (*types.TimeInLieuBalance, error) {
+	user, err := services.FindUserByID(ctx, userID, group)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var since time.Time
+	worked, err := GetWorkedShifts(ctx, userID, since, now, group)
+	if err != nil {
+		return nil, err
+	}
+	taken, err := getAssignedShifts(ctx, userID, since, now, []types.ProjectType{types.TimeInLieu}, group)
+	if err != nil {
+		return nil, err
+	}
+	adjustments, err := GetTimeInLieuAdjustments(ctx, userID, group)
+	if err != nil {
+		return nil, err
+	}
+	balance := payroll.ComputeTimeInLieu(user.Profile.ContractualHours, worked, taken, adjustments, now)
+	balance.UserID = user.ID
+	return &balance, nil
+}
+
+func GetTimeInLieuAdjustments(ctx context.Context, userID string, group types.Group) ([]types.TimeInLieuAdjustment, error) {
+	collection, err := dbClient.Collection(TimeInLieuAdjustmentCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	return db.Find[types.TimeInLieuAdjustment](ctx, bson.M{"userId": userID}, collection, nil)
+}
+
+func AddTimeInLieuAdjustment(ctx context.Context, adjustment types.TimeInLieuAdjustment, adminID string, group types.Group) (*types.TimeInLieuAdjustment, error) {
+	if err := utils.ValidateStruct(adjustment); err != nil {
+		return nil, err
+	}
+	if _, err := services.FindUserByID(ctx, adjustment.UserID, group); err != nil {
+		return nil, fmt.Errorf("user %s not found", adjustment.UserID)
+	}
+	collection, err := dbClient.Collection(TimeInLieuAdjustmentCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	adjustment.ID = ""
+	adjustment.CreatedBy = adminID
+	adjustment.CreatedAt = time.Now()
+	if _, err = db.InsertOrUpdate(ctx, &adjustment, collection); err != nil {
+		return nil, err
+	}
+	return &adjustment, nil
+}
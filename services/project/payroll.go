@@ -0,0 +1,114 @@
+package project
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/payroll"
+	"github.com/nbittich/wtm/services/repository"
+	"github.com/nbittich/wtm/services/utils"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const PayrollRulesCollection = "payrollRules"
+
+// GetPayrollRules returns the rules of the organization, or the default ones if none were configured.
+func GetPayrollRules(ctx context.Context, group types.Group) (types.PayrollRules, error) {
+	collection, err := dbClient.Collection(PayrollRulesCollection, group)
+	if err != nil {
+		return types.PayrollRules{}, err
+	}
+	count, err := db.CountAll(ctx, collection)
+	if err != nil {
+		return types.PayrollRules{}, err
+	}
+	if count == 0 {
+		return types.DefaultPayrollRules(), nil
+	}
+	return db.FindOneBy[types.PayrollRules](ctx, bson.M{}, collection)
+}
+
+func SavePayrollRules(ctx context.Context, rules types.PayrollRules, group types.Group) (*types.PayrollRules, error) {
+	if err := utils.ValidateStruct(rules); err != nil {
+		return nil, err
+	}
+	collection, err := dbClient.Collection(PayrollRulesCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	// only one set of rules per organization
+	existing, err := GetPayrollRules(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	rules.ID = existing.ID
+	rules.UpdatedAt = time.Now()
+	if _, err = db.InsertOrUpdate(ctx, &rules, collection); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// GetWorkedShifts returns the shifts worked within [from, to): the clock punches of the days an
+// employee punched, the non cancelled assignments on work projects of the other days.
+// An empty employeeID means every employee.
+func GetWorkedShifts(ctx context.Context, employeeID string, from time.Time, to time.Time, group types.Group) ([]payroll.WorkedShift, error) {
+	assigned, err := getAssignedShifts(ctx, employeeID, from, to, []types.ProjectType{types.Work}, group)
+	if err != nil {
+		return nil, err
+	}
+	punched, err := getPunchedShifts(ctx, employeeID, from, to, group)
+	if err != nil {
+		return nil, err
+	}
+	return payroll.PreferPunches(assigned, punched), nil
+}
+
+func getAssignedShifts(ctx context.Context, employeeID string, from time.Time, to time.Time, projectTypes []types.ProjectType, group types.Group) ([]payroll.WorkedShift, error) {
+	details, err := repos.Assignments.FindDetails(ctx, group, repository.AssignmentFilter{EmployeeID: employeeID, ActiveOnly: true, StartFrom: from, StartTo: to})
+	if err != nil {
+		return nil, err
+	}
+	shifts := make([]payroll.WorkedShift, 0, len(details))
+	for _, detail := range details {
+		if detail.Project == nil || !slices.Contains(projectTypes, detail.Project.Type) {
+			continue
+		}
+		start, err := time.ParseInLocation(types.BelgianDateTimeFormat, detail.Entry.Start, from.Location())
+		if err != nil {
+			return nil, err
+		}
+		end, err := time.ParseInLocation(types.BelgianDateTimeFormat, detail.Entry.End, from.Location())
+		if err != nil {
+			return nil, err
+		}
+		shifts = append(shifts, payroll.WorkedShift{EmployeeID: detail.EmployeeID, Start: start, End: end})
+	}
+	return shifts, nil
+}
+
+// GetPayrollReport computes the worked hours per category for every employee over [from, to).
+func GetPayrollReport(ctx context.Context, from time.Time, to time.Time, group types.Group) (*types.PayrollReport, error) {
+	rules, err := GetPayrollRules(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	shifts, err := GetWorkedShifts(ctx, "", from, to, group)
+	if err != nil {
+		return nil, err
+	}
+	hours := payroll.ComputeHours(rules, from, to, shifts)
+	employeeIDs := make([]string, 0, len(hours))
+	for id := range hours {
+		employeeIDs = append(employeeIDs, id)
+	}
+	users, err := services.FindAllUsersByIDs(ctx, employeeIDs, group)
+	if err != nil {
+		return nil, err
+	}
+	return payroll.NewReport(from, to, hours, users), nil
+}
@@ -10,150 +10,96 @@ import (
 	"time"
 
 	"github.com/nbittich/wtm/config"
-	"github.com/nbittich/wtm/services"
 	"github.com/nbittich/wtm/services/db"
 	"github.com/nbittich/wtm/services/email"
+	"github.com/nbittich/wtm/services/planning"
+	"github.com/nbittich/wtm/services/repository"
+	"github.com/nbittich/wtm/services/repository/mongorepo"
 	"github.com/nbittich/wtm/services/utils"
 	"github.com/nbittich/wtm/types"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 const (
-	PlanningCollection           = "planning"
-	ProjectCollection            = "project"
-	PlanningAssignmentCollection = "planningAssignment"
+	PlanningCollection           = mongorepo.PlanningCollection
+	ProjectCollection            = mongorepo.ProjectCollection
+	PlanningAssignmentCollection = mongorepo.PlanningAssignmentCollection
 )
 
-func IsUserAvailable(ctx context.Context, user *types.User, entry *types.PlanningEntry, group types.Group) (bool, error) {
-	var (
-		err                                    error
-		assignedStart, assignedEnd, start, end time.Time
-		ok                                     bool
-	)
+var (
+	dbClient *db.Client
+	repos    repository.Repositories
+	planner  *planning.Planner
+)
 
-	if user.Profile.Availability != nil {
-		if ok, err = user.Profile.Availability.IsAvailable(entry.Start, entry.End); err != nil || !ok {
-			return ok, err
-		}
-	}
-	details, err := GetPlanningAssignments(ctx, user.ID, group)
-	if err != nil {
-		return false, err
-	}
-	for _, detail := range details {
-		if detail.Entry.ID == entry.ID {
-			continue
-		}
-		if assignedStart, err = time.Parse(types.BelgianDateTimeFormat, detail.Entry.Start); err != nil {
-			return false, err
-		}
-		if assignedEnd, err = time.Parse(types.BelgianDateTimeFormat, detail.Entry.End); err != nil {
-			return false, err
-		}
-		if start, err = time.Parse(types.BelgianDateTimeFormat, entry.Start); err != nil {
-			return false, err
-		}
-		if end, err = time.Parse(types.BelgianDateTimeFormat, entry.End); err != nil {
-			return false, err
-		}
-		if !end.Before(assignedStart) && !start.After(assignedEnd) {
-			return false, nil
-		}
-	}
+// Init sets the database client of the projects and builds the repositories on top of it.
+func Init(client *db.Client) {
+	dbClient = client
+	repos = mongorepo.New(client)
+	planner = planning.New(repos)
+}
 
-	return true, nil
+func IsUserAvailable(ctx context.Context, user *types.User, entry *types.PlanningEntry, group types.Group) (bool, error) {
+	return planner.IsUserAvailable(ctx, user, entry, group)
 }
 
 func GetPlanningAssignments(ctx context.Context, employeeID string, group types.Group) ([]types.PlanningAssignmentDetail, error) {
-	collection, err := db.GetCollection(PlanningAssignmentCollection, group)
-	if err != nil {
-		return nil, err
-	}
-	pipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bson.M{"employeeId": employeeID}}},
-		{{Key: "$lookup", Value: bson.M{
-			"from":         PlanningCollection,
-			"localField":   "entryId",
-			"foreignField": "_id",
-			"as":           "entry",
-		}}},
-		{{Key: "$unwind", Value: bson.M{
-			"path":                       "$entry",
-			"preserveNullAndEmptyArrays": false,
-		}}},
-		{{Key: "$addFields", Value: bson.M{
-			"entry": "$entry",
-		}}},
-		{{Key: "$lookup", Value: bson.M{
-			"from":         ProjectCollection,
-			"localField":   "entry.projectId",
-			"foreignField": "_id",
-			"as":           "project",
-		}}},
-		{{Key: "$unwind", Value: bson.M{
-			"path":                       "$project",
-			"preserveNullAndEmptyArrays": true,
-		}}},
-		{{Key: "$addFields", Value: bson.M{
-			"project": "$project",
-		}}},
-	}
-	return db.Aggregate[types.PlanningAssignmentDetail](ctx, collection, pipeline)
+	return repos.Assignments.FindDetails(ctx, group, repository.AssignmentFilter{EmployeeID: employeeID})
 }
 
 func GetProjects(ctx context.Context, group types.Group) ([]types.Project, error) {
-	collection, err := db.GetCollection(ProjectCollection, group)
-	if err != nil {
-		return nil, err
-	}
-	return db.FindAll[types.Project](ctx, collection, nil)
+	return repos.Projects.FindAll(ctx, group)
 }
 
+// GetProject returns repository.ErrNotFound for a soft-deleted project.
 func GetProject(ctx context.Context, projectID string, group types.Group) (*types.Project, error) {
-	collection, err := db.GetCollection(ProjectCollection, group)
+	project, err := repos.Projects.FindByID(ctx, group, projectID)
 	if err != nil {
 		return nil, err
 	}
-
-	project, err := db.FindOneByID[types.Project](ctx, collection, projectID)
-	if err != nil {
-		return nil, err
+	if project.DeletedAt != nil {
+		return nil, repository.ErrNotFound
 	}
 	return &project, nil
 }
 
 func GetPlanning(ctx context.Context, projectID string, group types.Group) ([]types.PlanningEntry, error) {
-	collection, err := db.GetCollection(PlanningCollection, group)
+	return repos.Planning.FindByProject(ctx, group, projectID)
+}
+
+// GetPlanningEntry returns repository.ErrNotFound for a soft-deleted entry.
+func GetPlanningEntry(ctx context.Context, entryID string, group types.Group) (*types.PlanningEntry, error) {
+	entry, err := repos.Planning.FindByID(ctx, group, entryID)
 	if err != nil {
 		return nil, err
 	}
-
-	filter := bson.M{
-		"projectId": projectID,
+	if entry.DeletedAt != nil {
+		return nil, repository.ErrNotFound
 	}
-	return db.Find[types.PlanningEntry](ctx, &filter, collection, nil)
+	return &entry, nil
 }
 
+// AddOrUpdateProject returns repository.ErrConflict if the project was modified since it was read.
 func AddOrUpdateProject(ctx context.Context, project *types.Project, group types.Group) (*types.Project, error) {
 	if err := utils.ValidateStruct(project); err != nil {
 		return nil, err
 	}
-	projectCollection, err := db.GetCollection(ProjectCollection, group)
-	if err != nil {
-		return nil, err
-	}
 	if project.ID != "" {
 		project.UpdatedAt = time.Now()
 	} else {
 		project.CreatedAt = time.Now()
 	}
-	if _, err = db.InsertOrUpdate(ctx, project, projectCollection); err != nil {
+	// only DeleteProject and RestoreProject change it
+	if err := checkNotDeleted(ctx, project.ID, repos.Projects.FindByID, group); err != nil {
+		return nil, err
+	}
+	project.DeletedAt = nil
+	if err := repos.Projects.Save(ctx, group, project); err != nil {
 		return nil, err
 	}
 	return project, nil
 }
 
+// AddOrUpdatePlanningEntry returns repository.ErrConflict if the entry was modified since it was read.
 func AddOrUpdatePlanningEntry(ctx context.Context, entry types.PlanningEntry, assign bool, group types.Group) (*types.PlanningEntry, error) {
 	if err := utils.ValidateStruct(entry); err != nil {
 		return nil, err
@@ -165,7 +111,7 @@ func AddOrUpdatePlanningEntry(ctx context.Context, entry types.PlanningEntry, as
 		if len(entry.EmployeeIDs) > 1 && !entry.AllowMultipleAssignment {
 			return nil, fmt.Errorf("multiple assignment is not allowed for this entry")
 		}
-		users, err = services.FindAllUsersByIDs(ctx, entry.EmployeeIDs, group)
+		users, err = repos.Users.FindByIDs(ctx, group, entry.EmployeeIDs)
 		if err != nil {
 			return nil, err
 		}
@@ -173,23 +119,27 @@ func AddOrUpdatePlanningEntry(ctx context.Context, entry types.PlanningEntry, as
 			return nil, fmt.Errorf("could not retrieve all employees")
 		}
 		for _, user := range users {
-			if !user.Enabled || !slices.Contains(user.Roles, types.USER) {
+			if !user.CanSignIn() || !slices.Contains(user.Roles, types.USER) {
 				return nil, fmt.Errorf("user is not enabled or doesn't have the proper role")
 			}
 		}
 	}
 
-	projectCollection, err := db.GetCollection(ProjectCollection, group)
-	if err != nil {
-		return nil, err
-	}
-	project, err := db.FindOneByID[types.Project](ctx, projectCollection, entry.ProjectID)
+	project, err := repos.Projects.FindByID(ctx, group, entry.ProjectID)
 	if err != nil {
 		return nil, err
 	}
 	if project.Archived {
 		return nil, fmt.Errorf("cannot create new planning entry on archived project")
 	}
+	if project.DeletedAt != nil {
+		return nil, fmt.Errorf("cannot create new planning entry on deleted project")
+	}
+	// only DeletePlanningEntry and RestorePlanningEntry change it
+	if err := checkNotDeleted(ctx, entry.ID, repos.Planning.FindByID, group); err != nil {
+		return nil, err
+	}
+	entry.DeletedAt = nil
 	now := time.Now()
 	if entry.ID == "" {
 		entry.CreatedAt = now
@@ -197,64 +147,20 @@ func AddOrUpdatePlanningEntry(ctx context.Context, entry types.PlanningEntry, as
 		entry.UpdatedAt = &now
 	}
 
-	planningCollection, err := db.GetCollection(PlanningCollection, group)
+	// the entry and its assignments are saved together, the employees are notified once both are
+	result, err := planner.SaveAndAssign(ctx, entry, project, group, assign)
 	if err != nil {
-		return nil, err
-	}
-	if _, err := db.InsertOrUpdate(ctx, &entry, planningCollection); err != nil {
 		return &entry, err
 	}
 	if assign {
-		go func() {
-			if result, err := assignOrUnassignPlanningEntry(entry, project, group); err == nil {
-				sendMailAssignOrUnassign([]planningAssignmentResult{*result})
-			} else {
-				log.Println("could not assign/unassign planning entry")
-			}
-		}()
+		sendMailAssignOrUnassign([]planning.AssignmentResult{*result})
 	}
 
-	return &entry, nil
+	return &result.Entry, nil
 }
 
 func CheckEntriesValid(ctx context.Context, entries []types.PlanningEntry, group types.Group) (*types.PlanningValidity, error) {
-	valid := types.PlanningValidity{
-		Valid:    true,
-		Comments: make([]types.Comment, 0, 10),
-	}
-	usersCache := make(map[string]types.User, 2)
-	var (
-		user   types.User
-		exists bool
-		err    error
-	)
-	for _, entry := range entries {
-		for _, userID := range entry.EmployeeIDs {
-			if user, exists = usersCache[userID]; !exists {
-				if user, err = services.FindUserByID(ctx, userID, group); err != nil {
-					log.Println("could not fetch user with id '", userID, "'")
-					return nil, err
-				}
-				usersCache[userID] = user
-			}
-			ok, err := IsUserAvailable(ctx, &user, &entry, group)
-			if err != nil {
-				log.Println("could not check if user available")
-				return nil, err
-			}
-			if !ok {
-				valid.Comments = append(valid.Comments, types.Comment{
-					UserID:      user.ID,
-					Message:     fmt.Sprintf("Cannot assign %s for %s-> %s", user.Username, entry.Start, entry.End),
-					CommentType: types.WARNING,
-					CreatedAt:   time.Now(),
-					UpdatedAt:   nil,
-				})
-				valid.Valid = false
-			}
-		}
-	}
-	return &valid, nil
+	return planner.CheckEntriesValid(ctx, entries, group)
 }
 
 func GeneratePlanningEntriesFromCycle(ctx context.Context, cycle *types.PlanningCycle, group types.Group) ([]types.PlanningEntry, error) {
@@ -269,17 +175,17 @@ func GeneratePlanningEntriesFromCycle(ctx context.Context, cycle *types.Planning
 	}
 	if len(cycle.EmployeeIDs) != 0 {
 
-		if len(cycle.EmployeeIDs) > 1 && !cycle.AllowMultipleAssignment {
+		if len(cycle.EmployeeIDs) > 1 && !cycle.AllowMultipleAssignment && !cycle.Balanced {
 			return nil, fmt.Errorf("multiple assignment is not allowed for this entry")
 		}
-		if users, err = services.FindAllUsersByIDs(ctx, cycle.EmployeeIDs, group); err != nil {
+		if users, err = repos.Users.FindByIDs(ctx, group, cycle.EmployeeIDs); err != nil {
 			return nil, err
 		}
 		if len(users) != len(cycle.EmployeeIDs) {
 			return nil, fmt.Errorf("could not retrieve all employees")
 		}
 		for _, user := range users {
-			if !user.Enabled || !slices.Contains(user.Roles, types.USER) {
+			if !user.CanSignIn() || !slices.Contains(user.Roles, types.USER) {
 				return nil, fmt.Errorf("user is not enabled or doesn't have the proper role")
 			}
 		}
@@ -344,8 +250,14 @@ func GeneratePlanningEntriesFromCycle(ctx context.Context, cycle *types.Planning
 			Title:                   cycle.Title,
 			Description:             cycle.Description,
 			Comments:                []types.Comment{},
+			Unpopular:               cycle.Unpopular,
 		})
 	}
+	if cycle.Balanced && len(cycle.EmployeeIDs) != 0 {
+		if err = balanceCycleEntries(ctx, cycle, startDay, entries, group); err != nil {
+			return nil, err
+		}
+	}
 	// debugEntries, _ := json.Marshal(entries)
 	// os.WriteFile("/tmp/xx.json", debugEntries, 0o644)
 	return entries, nil
@@ -410,7 +322,7 @@ func MakePlanningCycle(ctx context.Context, cycle *types.PlanningCycle, group ty
 	}
 	// assigned and send mail
 	go func(entries []types.PlanningEntry, project types.Project, group types.Group) {
-		assignmentResults := make([]planningAssignmentResult, 0, len(entries))
+		assignmentResults := make([]planning.AssignmentResult, 0, len(entries))
 		for _, entry := range entries {
 			result, err := assignOrUnassignPlanningEntry(entry, project, group)
 			if err != nil {
@@ -425,27 +337,20 @@ func MakePlanningCycle(ctx context.Context, cycle *types.PlanningCycle, group ty
 	return entries, errored
 }
 
-type planningAssignmentResult struct {
-	usersToBeCancelled     []types.User
-	filteredUsersNewAssign []types.User
-	entry                  types.PlanningEntry
-	project                types.Project
-}
-
-func sendMailAssignOrUnassign(assignmentResults []planningAssignmentResult) {
+func sendMailAssignOrUnassign(assignmentResults []planning.AssignmentResult) {
 	type UserKey struct {
 		UserID string
 		Email  string
 	}
 	usersToBecancelled := make(map[UserKey][]string)
 	usersNewAssign := make(map[UserKey][]string)
-	slices.SortFunc(assignmentResults, func(a planningAssignmentResult, b planningAssignmentResult) int {
-		start, err := time.Parse(types.BelgianDateTimeFormat, a.entry.Start)
+	slices.SortFunc(assignmentResults, func(a planning.AssignmentResult, b planning.AssignmentResult) int {
+		start, err := time.Parse(types.BelgianDateTimeFormat, a.Entry.Start)
 		if err != nil {
 			log.Println("could not parse start date...sorting will be wrong", err)
 			return 0
 		}
-		end, err := time.Parse(types.BelgianDateTimeFormat, b.entry.Start)
+		end, err := time.Parse(types.BelgianDateTimeFormat, b.Entry.Start)
 		if err != nil {
 			log.Println("could not parse end date...sorting will be wrong", err)
 			return 0
@@ -453,24 +358,24 @@ func sendMailAssignOrUnassign(assignmentResults []planningAssignmentResult) {
 		return start.Compare(end)
 	})
 	for _, assignmentResult := range assignmentResults {
-		for _, user := range assignmentResult.usersToBeCancelled {
+		for _, user := range assignmentResult.UsersToBeCancelled {
 			userKey := UserKey{UserID: user.ID, Email: user.Email}
 			if _, exists := usersToBecancelled[userKey]; !exists {
 				usersToBecancelled[userKey] = make([]string, 0, 10)
 			}
 			usersToBecancelled[userKey] = append(usersToBecancelled[userKey],
 				fmt.Sprintf(`Project %s: You've been unassigned for slot %s -> %s`,
-					assignmentResult.project.Name, assignmentResult.entry.Start, assignmentResult.entry.End))
+					assignmentResult.Project.Name, assignmentResult.Entry.Start, assignmentResult.Entry.End))
 
 		}
-		for _, user := range assignmentResult.filteredUsersNewAssign {
+		for _, user := range assignmentResult.FilteredUsersNewAssign {
 			userKey := UserKey{UserID: user.ID, Email: user.Email}
 			if _, exists := usersNewAssign[userKey]; !exists {
 				usersNewAssign[userKey] = make([]string, 0, 10)
 			}
 			usersNewAssign[userKey] = append(usersNewAssign[userKey],
 				fmt.Sprintf(`Project %s: You've been assigned for slot %s -> %s`,
-					assignmentResult.project.Name, assignmentResult.entry.Start, assignmentResult.entry.End))
+					assignmentResult.Project.Name, assignmentResult.Entry.Start, assignmentResult.Entry.End))
 
 		}
 	}
@@ -485,94 +390,8 @@ func sendMailAssignOrUnassign(assignmentResults []planningAssignmentResult) {
 	}
 }
 
-func assignOrUnassignPlanningEntry(entry types.PlanningEntry, project types.Project, group types.Group) (*planningAssignmentResult, error) {
-	assignmentCol, err := db.GetCollection(PlanningAssignmentCollection, group)
-	if err != nil {
-		log.Println("could not get the assignment collection", err)
-		return nil, err
-	}
-	planningCol, err := db.GetCollection(PlanningCollection, group)
-	if err != nil {
-		log.Println("could not get the planning collection", err)
-		return nil, err
-	}
-	filter := bson.M{
-		"entryId":   entry.ID,
-		"cancelled": false,
-	}
+func assignOrUnassignPlanningEntry(entry types.PlanningEntry, project types.Project, group types.Group) (*planning.AssignmentResult, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), config.MongoCtxTimeout)
 	defer cancel()
-	existingAssignements, err := db.Find[types.PlanningAssignment](ctx, filter, assignmentCol, nil)
-	if err != nil {
-		log.Println("could not fetch existing assignments", err)
-		return nil, err
-	}
-	// delete employee ids that are not available
-	// add a comment if user was not available and therefore removed
-
-	valid, err := CheckEntriesValid(ctx, []types.PlanningEntry{entry}, group)
-	if err != nil {
-		log.Println("could not validate entry", entry.ID, "=>", entry.EmployeeIDs, "=>", len(entry.EmployeeIDs))
-		return nil, err
-	}
-	if !valid.Valid {
-		entry.Comments = append(entry.Comments, valid.Comments...)
-		entry.EmployeeIDs = slices.DeleteFunc(entry.EmployeeIDs, func(id string) bool {
-			return slices.ContainsFunc(valid.Comments, func(comment types.Comment) bool {
-				return comment.UserID == id
-			})
-		})
-		if _, err = db.InsertOrUpdate(ctx, &entry, planningCol); err != nil {
-			return nil, err
-		}
-	}
-
-	assignmentsToUpdate := make([]types.Identifiable, 0, len(existingAssignements))
-	filteredUsersNewAssign := make([]types.User, 0, len(existingAssignements))
-	filteredUsersCancelledAssign := make([]string, 0, len(existingAssignements))
-	for _, assignment := range existingAssignements {
-		if !slices.Contains(entry.EmployeeIDs, assignment.EmployeeID) {
-			assignment.Cancelled = true
-			assignment.UpdatedAt = time.Now()
-			assignmentsToUpdate = append(assignmentsToUpdate, &assignment)
-			filteredUsersCancelledAssign = append(filteredUsersCancelledAssign, assignment.EmployeeID)
-		}
-	}
-	usersToBeCancelled, err := services.FindAllUsersByIDs(ctx, filteredUsersCancelledAssign, group)
-	if err != nil {
-		log.Println("could not get users to unassign them", err)
-		return nil, err
-	}
-
-	users, err := services.FindAllUsersByIDs(ctx, entry.EmployeeIDs, group)
-	if err != nil {
-		log.Println("could not get users to assign them", err)
-		return nil, err
-	}
-	for _, user := range users {
-		if !slices.ContainsFunc(existingAssignements, func(a types.PlanningAssignment) bool {
-			return a.EmployeeID == user.ID
-		}) {
-			filteredUsersNewAssign = append(filteredUsersNewAssign, user)
-			assignmentsToUpdate = append(assignmentsToUpdate, &types.PlanningAssignment{
-				EntryID:    entry.ID,
-				EmployeeID: user.ID,
-				CreatedAt:  time.Now(),
-				SendDate:   time.Now(),
-				Cancelled:  false,
-			})
-		}
-	}
-	if len(assignmentsToUpdate) > 0 {
-		if err = db.InsertOrUpdateMany(ctx, assignmentsToUpdate, assignmentCol); err != nil {
-			log.Println("Could not update assignments", err)
-			return nil, err
-		}
-	}
-	return &planningAssignmentResult{
-		usersToBeCancelled:     usersToBeCancelled,
-		filteredUsersNewAssign: filteredUsersNewAssign,
-		entry:                  entry,
-		project:                project,
-	}, nil
+	return planner.SaveAndAssign(ctx, entry, project, group, true)
 }
@@ -0,0 +1,96 @@
+package project
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/payroll"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const ClockPunchCollection = "clockPunch"
+
+var (
+	ErrClockedIn    = errors.New("already clocked in")
+	ErrNotClockedIn = errors.New("not clocked in")
+)
+
+// ClockIn opens a punch for the employee, who must not be clocked in already. The unique index
+// on the open punches refuses the second one of two concurrent calls.
+func ClockIn(ctx context.Context, employeeID string, group types.Group) (*types.ClockPunch, error) {
+	collection, err := dbClient.Collection(ClockPunchCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	punch := types.ClockPunch{EmployeeID: employeeID, In: time.Now()}
+	if _, err = db.InsertOrUpdate(ctx, &punch, collection); mongo.IsDuplicateKeyError(err) {
+		return nil, ErrClockedIn
+	} else if err != nil {
+		return nil, err
+	}
+	return &punch, nil
+}
+
+// ClockOut closes the open punch of the employee.
+func ClockOut(ctx context.Context, employeeID string, group types.Group) (*types.ClockPunch, error) {
+	collection, err := dbClient.Collection(ClockPunchCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	punch, err := db.FindOneBy[types.ClockPunch](ctx, bson.M{"employeeId": employeeID, "out": nil}, collection)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotClockedIn
+	} else if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	// conditional, so that a concurrent clock out doesn't move the end
+	res, err := collection.UpdateOne(ctx, bson.M{"_id": punch.ID, "out": nil}, bson.M{"$set": bson.M{"out": now}})
+	if err != nil {
+		return nil, err
+	}
+	if res.ModifiedCount == 0 {
+		return nil, ErrNotClockedIn
+	}
+	punch.Out = &now
+	return &punch, nil
+}
+
+// GetClockPunches returns the punches of the employee clocked in within [from, to), the open one included.
+func GetClockPunches(ctx context.Context, employeeID string, from time.Time, to time.Time, group types.Group) ([]types.ClockPunch, error) {
+	return findClockPunches(ctx, bson.M{"employeeId": employeeID, "in": bson.M{"$gte": from, "$lt": to}}, group)
+}
+
+// getPunchedShifts returns the closed punches clocked in within [from, to). An empty employeeID
+// means every employee.
+func getPunchedShifts(ctx context.Context, employeeID string, from time.Time, to time.Time, group types.Group) ([]payroll.WorkedShift, error) {
+	filter := bson.M{"in": bson.M{"$gte": from, "$lt": to}, "out": bson.M{"$ne": nil}}
+	if employeeID != "" {
+		filter["employeeId"] = employeeID
+	}
+	punches, err := findClockPunches(ctx, filter, group)
+	if err != nil {
+		return nil, err
+	}
+	shifts := make([]payroll.WorkedShift, 0, len(punches))
+	for _, punch := range punches {
+		shifts = append(shifts, payroll.WorkedShift{EmployeeID: punch.EmployeeID, Start: punch.In.In(from.Location()), End: punch.Out.In(from.Location())})
+	}
+	return shifts, nil
+}
+
+func findClockPunches(ctx context.Context, filter bson.M, group types.Group) ([]types.ClockPunch, error) {
+	collection, err := dbClient.Collection(ClockPunchCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return db.CursorToSlice[types.ClockPunch](ctx, cursor, 100)
+}
@@ -0,0 +1,157 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// assignmentHoursPipeline joins every assignment (cancelled or not) with its entry,
+// parses the entry dates and keeps the ones starting within the filter range. The assignments of
+// soft-deleted entries are left out: they were cancelled by the deletion, not by the employees.
+func assignmentHoursPipeline(filter types.ReportFilter) mongo.Pipeline {
+	match := bson.M{
+		"start": bson.M{"$gte": filter.From, "$lt": filter.To},
+	}
+	if len(filter.EmployeeIDs) > 0 {
+		match["employeeId"] = bson.M{"$in": filter.EmployeeIDs}
+	}
+	if len(filter.ProjectIDs) > 0 {
+		match["entry.projectId"] = bson.M{"$in": filter.ProjectIDs}
+	}
+	return mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{
+			"from":         PlanningCollection,
+			"localField":   "entryId",
+			"foreignField": "_id",
+			"as":           "entry",
+		}}},
+		{{Key: "$unwind", Value: bson.M{
+			"path":                       "$entry",
+			"preserveNullAndEmptyArrays": false,
+		}}},
+		{{Key: "$match", Value: bson.M{"entry.deletedAt": nil}}},
+		{{Key: "$addFields", Value: bson.M{
+			"start": db.ParseBelgianDateTime("$entry.start"),
+			"end":   db.ParseBelgianDateTime("$entry.end"),
+		}}},
+		{{Key: "$match", Value: match}},
+		{{Key: "$addFields", Value: bson.M{
+			"hours": bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{"$end", "$start"}}, 3600000}},
+		}}},
+	}
+}
+
+func groupAssignmentHours(key interface{}) bson.D {
+	return bson.D{{Key: "$group", Value: bson.M{
+		"_id":           key,
+		"hours":         bson.M{"$sum": bson.M{"$cond": bson.A{"$cancelled", 0, "$hours"}}},
+		"assignments":   bson.M{"$sum": bson.M{"$cond": bson.A{"$cancelled", 0, 1}}},
+		"cancellations": bson.M{"$sum": bson.M{"$cond": bson.A{"$cancelled", 1, 0}}},
+	}}}
+}
+
+func aggregateReport(ctx context.Context, filter types.ReportFilter, key interface{}, group types.Group) ([]types.ReportLine, error) {
+	collection, err := dbClient.Collection(PlanningAssignmentCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := append(assignmentHoursPipeline(filter),
+		groupAssignmentHours(key),
+		bson.D{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	)
+	lines, err := db.Aggregate[types.ReportLine](ctx, collection, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	for i := range lines {
+		lines[i].Hours = math.Round(lines[i].Hours*100) / 100
+	}
+	return lines, nil
+}
+
+// GetEmployeeReport returns the planned hours per employee, with their utilization against
+// their contractual hours when they have a contract.
+func GetEmployeeReport(ctx context.Context, filter types.ReportFilter, group types.Group) ([]types.ReportLine, error) {
+	lines, err := aggregateReport(ctx, filter, "$employeeId", group)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(lines))
+	for _, line := range lines {
+		ids = append(ids, line.ID)
+	}
+	users, err := services.FindAllUsersByIDs(ctx, ids, group)
+	if err != nil {
+		return nil, err
+	}
+	usersByID := make(map[string]types.User, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+	weeks := filter.To.Sub(filter.From).Hours() / (24 * 7)
+	for i, line := range lines {
+		user, ok := usersByID[line.ID]
+		if !ok {
+			continue
+		}
+		lines[i].Label = user.Username
+		if user.Profile.ContractualHours > 0 {
+			contractual := math.Round(user.Profile.ContractualHours*weeks*100) / 100
+			utilization := math.Round(line.Hours/contractual*10000) / 10000
+			lines[i].ContractualHours = &contractual
+			lines[i].Utilization = &utilization
+		}
+	}
+	return lines, nil
+}
+
+// GetProjectReport returns the planned hours per project.
+func GetProjectReport(ctx context.Context, filter types.ReportFilter, group types.Group) ([]types.ReportLine, error) {
+	lines, err := aggregateReport(ctx, filter, "$entry.projectId", group)
+	if err != nil {
+		return nil, err
+	}
+	projects, err := GetProjects(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	for i, line := range lines {
+		for _, project := range projects {
+			if project.ID == line.ID {
+				lines[i].Label = project.Name
+				break
+			}
+		}
+	}
+	return lines, nil
+}
+
+// GetPeriodReport returns the planned hours per ISO week (e.g. 2024-W45) or per month (e.g. 2024-11).
+func GetPeriodReport(ctx context.Context, filter types.ReportFilter, granularity types.ReportGranularity, group types.Group) ([]types.ReportLine, error) {
+	var format string
+	switch granularity {
+	case types.ReportByWeek:
+		format = "%G-W%V"
+	case types.ReportByMonth:
+		format = "%Y-%m"
+	default:
+		return nil, fmt.Errorf("unknown report granularity %s", granularity)
+	}
+	key := bson.M{"$dateToString": bson.M{"date": "$start", "format": format, "timezone": config.TZ}}
+	lines, err := aggregateReport(ctx, filter, key, group)
+	if err != nil {
+		return nil, err
+	}
+	for i := range lines {
+		lines[i].Label = lines[i].ID
+	}
+	return lines, nil
+}
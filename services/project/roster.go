@@ -0,0 +1,66 @@
+package project
+
+import (
+	"context"
+	"slices"
+
+	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/pdf"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetPlanningRoster builds the printable roster for a project, or for every project when projectID is empty.
+// Only the entries starting within the period are loaded.
+func GetPlanningRoster(ctx context.Context, projectID string, opts pdf.RosterOptions, group types.Group) (*pdf.Roster, error) {
+	var (
+		projects []types.Project
+		err      error
+	)
+	if projectID != "" {
+		project, err := GetProject(ctx, projectID, group)
+		if err != nil {
+			return nil, err
+		}
+		projects = []types.Project{*project}
+	} else if projects, err = GetProjects(ctx, group); err != nil {
+		return nil, err
+	}
+
+	from, to, err := pdf.PeriodBounds(opts.Period, opts.Date)
+	if err != nil {
+		return nil, err
+	}
+	projectIDs := make([]string, 0, len(projects))
+	for _, p := range projects {
+		projectIDs = append(projectIDs, p.ID)
+	}
+	planningCollection, err := dbClient.Collection(PlanningCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := db.Aggregate[types.PlanningEntry](ctx, planningCollection, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"projectId": bson.M{"$in": projectIDs}, "deletedAt": nil}}},
+		{{Key: "$addFields", Value: bson.M{"startDate": db.ParseBelgianDateTime("$start")}}},
+		{{Key: "$match", Value: bson.M{"startDate": bson.M{"$gte": from, "$lt": to}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	employeeIDs := make([]string, 0, 10)
+	for _, entry := range entries {
+		for _, id := range entry.EmployeeIDs {
+			if !slices.Contains(employeeIDs, id) {
+				employeeIDs = append(employeeIDs, id)
+			}
+		}
+	}
+	users, err := services.FindAllUsersByIDs(ctx, employeeIDs, group)
+	if err != nil {
+		return nil, err
+	}
+	return pdf.BuildRoster(opts, projects, entries, users)
+}
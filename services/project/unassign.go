@@ -0,0 +1,44 @@
+package project
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/nbittich/wtm/services/repository"
+	"github.com/nbittich/wtm/types"
+)
+
+// UnassignFutureAssignments removes the employee from the planning entries that did not start yet.
+// It goes through AddOrUpdatePlanningEntry, so the assignments are cancelled and the employee notified
+// as with any other change of the planning. Entries of archived projects are left untouched.
+func UnassignFutureAssignments(ctx context.Context, employeeID string, group types.Group) ([]types.PlanningEntry, error) {
+	details, err := repos.Assignments.FindDetails(ctx, group, repository.AssignmentFilter{EmployeeID: employeeID, ActiveOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	entries := make([]types.PlanningEntry, 0, len(details))
+	for _, detail := range details {
+		start, err := time.ParseInLocation(types.BelgianDateTimeFormat, detail.Entry.Start, now.Location())
+		if err != nil {
+			log.Println("could not parse start of entry", detail.Entry.ID, err)
+			continue
+		}
+		if !start.After(now) || !slices.Contains(detail.Entry.EmployeeIDs, employeeID) {
+			continue
+		}
+		if detail.Project != nil && detail.Project.Archived {
+			continue
+		}
+		entry := *detail.Entry
+		entry.EmployeeIDs = slices.DeleteFunc(slices.Clone(entry.EmployeeIDs), func(id string) bool { return id == employeeID })
+		updated, err := AddOrUpdatePlanningEntry(ctx, entry, true, group)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, *updated)
+	}
+	return entries, nil
+}
@@ -0,0 +1,273 @@
+// Package memory keeps the repositories in maps, for the tests. Documents are copied in and out
+// so that a caller cannot change the stored ones behind the repository's back.
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/nbittich/wtm/services/repository"
+	"github.com/nbittich/wtm/types"
+)
+
+// store is a thread safe map of documents per group, in insertion order.
+type store[T any] struct {
+	mu    sync.RWMutex
+	docs  map[types.Group]map[string]T
+	order map[types.Group][]string
+	clone func(T) T
+}
+
+func newStore[T any](clone func(T) T) *store[T] {
+	return &store[T]{docs: map[types.Group]map[string]T{}, order: map[types.Group][]string{}, clone: clone}
+}
+
+func (s *store[T]) get(group types.Group, id string) (T, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	doc, ok := s.docs[group][id]
+	if !ok {
+		var zero T
+		return zero, repository.ErrNotFound
+	}
+	return s.clone(doc), nil
+}
+
+func (s *store[T]) filter(group types.Group, keep func(T) bool) []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	docs := make([]T, 0, len(s.order[group]))
+	for _, id := range s.order[group] {
+		if doc := s.docs[group][id]; keep == nil || keep(doc) {
+			docs = append(docs, s.clone(doc))
+		}
+	}
+	return docs
+}
+
+func (s *store[T]) put(group types.Group, id string, doc T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.putLocked(group, id, doc)
+}
+
+func (s *store[T]) putLocked(group types.Group, id string, doc T) {
+	if s.docs[group] == nil {
+		s.docs[group] = map[string]T{}
+	}
+	if _, exists := s.docs[group][id]; !exists {
+		s.order[group] = append(s.order[group], id)
+	}
+	s.docs[group][id] = s.clone(doc)
+}
+
+func (s *store[T]) delete(group types.Group, ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		if _, exists := s.docs[group][id]; !exists {
+			continue
+		}
+		delete(s.docs[group], id)
+		s.order[group] = slices.DeleteFunc(s.order[group], func(o string) bool { return o == id })
+	}
+}
+
+// saveVersioned stores the document only if its version is the stored one, and bumps it, like
+// db.InsertOrUpdate does.
+func saveVersioned[T any, P interface {
+	*T
+	types.Versioned
+}](s *store[T], group types.Group, doc P) error {
+	id := doc.GetID()
+	newID(&id)
+	doc.SetID(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current, exists := s.docs[group][id]; exists && P(&current).GetVersion() != doc.GetVersion() {
+		return repository.ErrConflict
+	}
+	doc.SetVersion(doc.GetVersion() + 1)
+	s.putLocked(group, id, *doc)
+	return nil
+}
+
+// newID gives an id to a document about to be inserted, like db.InsertOrUpdate does.
+func newID(id *string) {
+	if *id == "" {
+		*id = uuid.New().String()
+	}
+}
+
+func cloneUser(u types.User) types.User {
+	u.Roles = slices.Clone(u.Roles)
+	return u
+}
+
+func cloneProject(p types.Project) types.Project { return p }
+
+func cloneEntry(e types.PlanningEntry) types.PlanningEntry {
+	e.EmployeeIDs = slices.Clone(e.EmployeeIDs)
+	e.Comments = slices.Clone(e.Comments)
+	return e
+}
+
+func cloneAssignment(a types.PlanningAssignment) types.PlanningAssignment { return a }
+
+func cloneOrganization(o types.Organization) types.Organization {
+	o.AdditionalInfo = slices.Clone(o.AdditionalInfo)
+	return o
+}
+
+// New returns empty repositories.
+func New() repository.Repositories {
+	planning := &planningRepository{newStore(cloneEntry)}
+	projects := &projectRepository{newStore(cloneProject)}
+	return repository.Repositories{
+		Users:         &userRepository{newStore(cloneUser)},
+		Projects:      projects,
+		Planning:      planning,
+		Assignments:   &assignmentRepository{store: newStore(cloneAssignment), planning: planning, projects: projects},
+		Organizations: &organizationRepository{newStore(cloneOrganization)},
+		Transactions:  transactor{},
+	}
+}
+
+type userRepository struct{ *store[types.User] }
+
+func (r *userRepository) FindByID(_ context.Context, group types.Group, id string) (types.User, error) {
+	return r.get(group, id)
+}
+
+func (r *userRepository) FindByIDs(_ context.Context, group types.Group, ids []string) ([]types.User, error) {
+	return r.filter(group, func(u types.User) bool { return slices.Contains(ids, u.ID) }), nil
+}
+
+func (r *userRepository) Save(_ context.Context, group types.Group, user *types.User) error {
+	newID(&user.ID)
+	r.put(group, user.ID, *user)
+	return nil
+}
+
+type projectRepository struct{ *store[types.Project] }
+
+func (r *projectRepository) FindAll(_ context.Context, group types.Group) ([]types.Project, error) {
+	return r.filter(group, func(p types.Project) bool { return p.DeletedAt == nil }), nil
+}
+
+func (r *projectRepository) FindDeleted(_ context.Context, group types.Group) ([]types.Project, error) {
+	return r.filter(group, func(p types.Project) bool { return p.DeletedAt != nil }), nil
+}
+
+func (r *projectRepository) FindByID(_ context.Context, group types.Group, id string) (types.Project, error) {
+	return r.get(group, id)
+}
+
+func (r *projectRepository) Save(_ context.Context, group types.Group, project *types.Project) error {
+	return saveVersioned(r.store, group, project)
+}
+
+func (r *projectRepository) Delete(_ context.Context, group types.Group, id string) error {
+	r.delete(group, id)
+	return nil
+}
+
+type planningRepository struct{ *store[types.PlanningEntry] }
+
+func (r *planningRepository) FindByProject(_ context.Context, group types.Group, projectID string) ([]types.PlanningEntry, error) {
+	return r.filter(group, func(e types.PlanningEntry) bool { return e.ProjectID == projectID && e.DeletedAt == nil }), nil
+}
+
+func (r *planningRepository) FindDeleted(_ context.Context, group types.Group, projectID string) ([]types.PlanningEntry, error) {
+	return r.filter(group, func(e types.PlanningEntry) bool {
+		return e.DeletedAt != nil && (projectID == "" || e.ProjectID == projectID)
+	}), nil
+}
+
+func (r *planningRepository) FindByID(_ context.Context, group types.Group, id string) (types.PlanningEntry, error) {
+	return r.get(group, id)
+}
+
+func (r *planningRepository) Save(_ context.Context, group types.Group, entry *types.PlanningEntry) error {
+	return saveVersioned(r.store, group, entry)
+}
+
+func (r *planningRepository) Delete(_ context.Context, group types.Group, id string) error {
+	r.delete(group, id)
+	return nil
+}
+
+type assignmentRepository struct {
+	*store[types.PlanningAssignment]
+	planning *planningRepository
+	projects *projectRepository
+}
+
+func (r *assignmentRepository) Find(_ context.Context, group types.Group, filter repository.AssignmentFilter) ([]types.PlanningAssignment, error) {
+	return r.filter(group, filter.Match), nil
+}
+
+func (r *assignmentRepository) FindDetails(ctx context.Context, group types.Group, filter repository.AssignmentFilter) ([]types.PlanningAssignmentDetail, error) {
+	assignments, _ := r.Find(ctx, group, filter)
+	details := make([]types.PlanningAssignmentDetail, 0, len(assignments))
+	for _, assignment := range assignments {
+		entry, err := r.planning.get(group, assignment.EntryID)
+		if err != nil || entry.DeletedAt != nil || !filter.MatchEntry(entry) {
+			continue
+		}
+		detail := types.PlanningAssignmentDetail{PlanningAssignment: assignment, Entry: &entry}
+		if project, err := r.projects.get(group, entry.ProjectID); err == nil {
+			detail.Project = &project
+		}
+		details = append(details, detail)
+	}
+	return details, nil
+}
+
+func (r *assignmentRepository) SaveMany(_ context.Context, group types.Group, assignments []*types.PlanningAssignment) error {
+	for _, assignment := range assignments {
+		newID(&assignment.ID)
+		r.put(group, assignment.ID, *assignment)
+	}
+	return nil
+}
+
+func (r *assignmentRepository) Delete(_ context.Context, group types.Group, ids []string) error {
+	r.delete(group, ids...)
+	return nil
+}
+
+// organizations are not in a group, they are all stored under the empty one
+type organizationRepository struct{ *store[types.Organization] }
+
+func (r *organizationRepository) FindAll(_ context.Context) ([]types.Organization, error) {
+	return r.filter("", nil), nil
+}
+
+func (r *organizationRepository) FindByID(_ context.Context, id string) (types.Organization, error) {
+	return r.get("", id)
+}
+
+func (r *organizationRepository) FindByGroup(_ context.Context, group types.Group) (types.Organization, error) {
+	orgs := r.filter("", func(o types.Organization) bool { return o.Group == group })
+	if len(orgs) == 0 {
+		return types.Organization{}, repository.ErrNotFound
+	}
+	return orgs[0], nil
+}
+
+func (r *organizationRepository) Save(_ context.Context, org *types.Organization) error {
+	newID(&org.ID)
+	r.put("", org.ID, *org)
+	return nil
+}
+
+// transactor has no transactions, like a standalone mongo server, so the callers fall back on
+// their compensation.
+type transactor struct{}
+
+func (transactor) WithTransaction(context.Context, func(context.Context) error) error {
+	return repository.ErrNoTransaction
+}
@@ -0,0 +1,308 @@
+// Package mongorepo implements the repositories on top of services/db.
+package mongorepo
+
+import (
+	"context"
+
+	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/repository"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	PlanningCollection           = "planning"
+	ProjectCollection            = "project"
+	PlanningAssignmentCollection = "planningAssignment"
+)
+
+// New returns the repositories backed by the mongo databases of the client.
+func New(client *db.Client) repository.Repositories {
+	c := conn{client}
+	return repository.Repositories{
+		Users:         userRepository{c},
+		Projects:      projectRepository{c},
+		Planning:      planningRepository{c},
+		Assignments:   assignmentRepository{c},
+		Organizations: organizationRepository{c},
+		Transactions:  transactor{c},
+	}
+}
+
+type conn struct{ client *db.Client }
+
+func (c conn) collection(collectionName string, group types.Group) (*mongo.Collection, error) {
+	return c.client.Collection(collectionName, group)
+}
+
+type userRepository struct{ conn }
+
+func (r userRepository) FindByID(ctx context.Context, group types.Group, id string) (types.User, error) {
+	collection, err := r.collection(services.UserCollection, group)
+	if err != nil {
+		return types.User{}, err
+	}
+	return db.FindOneByID[types.User](ctx, collection, id)
+}
+
+func (r userRepository) FindByIDs(ctx context.Context, group types.Group, ids []string) ([]types.User, error) {
+	collection, err := r.collection(services.UserCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	return db.FindAllByIDs[types.User](ctx, collection, ids, nil)
+}
+
+func (r userRepository) Save(ctx context.Context, group types.Group, user *types.User) error {
+	collection, err := r.collection(services.UserCollection, group)
+	if err != nil {
+		return err
+	}
+	_, err = db.InsertOrUpdate(ctx, user, collection)
+	return err
+}
+
+type projectRepository struct{ conn }
+
+func (r projectRepository) FindAll(ctx context.Context, group types.Group) ([]types.Project, error) {
+	collection, err := r.collection(ProjectCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	return db.Find[types.Project](ctx, bson.M{"deletedAt": nil}, collection, nil)
+}
+
+func (r projectRepository) FindDeleted(ctx context.Context, group types.Group) ([]types.Project, error) {
+	collection, err := r.collection(ProjectCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	return db.Find[types.Project](ctx, bson.M{"deletedAt": bson.M{"$ne": nil}}, collection, nil)
+}
+
+func (r projectRepository) FindByID(ctx context.Context, group types.Group, id string) (types.Project, error) {
+	collection, err := r.collection(ProjectCollection, group)
+	if err != nil {
+		return types.Project{}, err
+	}
+	return db.FindOneByID[types.Project](ctx, collection, id)
+}
+
+func (r projectRepository) Save(ctx context.Context, group types.Group, project *types.Project) error {
+	collection, err := r.collection(ProjectCollection, group)
+	if err != nil {
+		return err
+	}
+	_, err = db.InsertOrUpdate(ctx, project, collection)
+	return err
+}
+
+func (r projectRepository) Delete(ctx context.Context, group types.Group, id string) error {
+	collection, err := r.collection(ProjectCollection, group)
+	if err != nil {
+		return err
+	}
+	_, err = collection.DeleteOne(ctx, db.FilterByID(id))
+	return err
+}
+
+type planningRepository struct{ conn }
+
+func (r planningRepository) FindByProject(ctx context.Context, group types.Group, projectID string) ([]types.PlanningEntry, error) {
+	collection, err := r.collection(PlanningCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	return db.Find[types.PlanningEntry](ctx, bson.M{"projectId": projectID, "deletedAt": nil}, collection, nil)
+}
+
+func (r planningRepository) FindDeleted(ctx context.Context, group types.Group, projectID string) ([]types.PlanningEntry, error) {
+	collection, err := r.collection(PlanningCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.M{"deletedAt": bson.M{"$ne": nil}}
+	if projectID != "" {
+		filter["projectId"] = projectID
+	}
+	return db.Find[types.PlanningEntry](ctx, filter, collection, nil)
+}
+
+func (r planningRepository) FindByID(ctx context.Context, group types.Group, id string) (types.PlanningEntry, error) {
+	collection, err := r.collection(PlanningCollection, group)
+	if err != nil {
+		return types.PlanningEntry{}, err
+	}
+	return db.FindOneByID[types.PlanningEntry](ctx, collection, id)
+}
+
+func (r planningRepository) Save(ctx context.Context, group types.Group, entry *types.PlanningEntry) error {
+	collection, err := r.collection(PlanningCollection, group)
+	if err != nil {
+		return err
+	}
+	_, err = db.InsertOrUpdate(ctx, entry, collection)
+	return err
+}
+
+func (r planningRepository) Delete(ctx context.Context, group types.Group, id string) error {
+	collection, err := r.collection(PlanningCollection, group)
+	if err != nil {
+		return err
+	}
+	_, err = collection.DeleteOne(ctx, db.FilterByID(id))
+	return err
+}
+
+type assignmentRepository struct{ conn }
+
+func assignmentFilter(filter repository.AssignmentFilter) bson.M {
+	match := bson.M{}
+	if filter.EmployeeID != "" {
+		match["employeeId"] = filter.EmployeeID
+	}
+	if filter.EntryID != "" {
+		match["entryId"] = filter.EntryID
+	}
+	if filter.ActiveOnly {
+		match["cancelled"] = false
+	}
+	return match
+}
+
+func (r assignmentRepository) Find(ctx context.Context, group types.Group, filter repository.AssignmentFilter) ([]types.PlanningAssignment, error) {
+	collection, err := r.collection(PlanningAssignmentCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	return db.Find[types.PlanningAssignment](ctx, assignmentFilter(filter), collection, nil)
+}
+
+func (r assignmentRepository) FindDetails(ctx context.Context, group types.Group, filter repository.AssignmentFilter) ([]types.PlanningAssignmentDetail, error) {
+	collection, err := r.collection(PlanningAssignmentCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: assignmentFilter(filter)}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         PlanningCollection,
+			"localField":   "entryId",
+			"foreignField": "_id",
+			"as":           "entry",
+		}}},
+		{{Key: "$unwind", Value: bson.M{
+			"path":                       "$entry",
+			"preserveNullAndEmptyArrays": false,
+		}}},
+		{{Key: "$match", Value: bson.M{"entry.deletedAt": nil}}},
+	}
+	if start := startRange(filter); len(start) > 0 {
+		pipeline = append(pipeline,
+			bson.D{{Key: "$addFields", Value: bson.M{"entryStart": db.ParseBelgianDateTime("$entry.start")}}},
+			bson.D{{Key: "$match", Value: bson.M{"entryStart": start}}},
+		)
+	}
+	pipeline = append(pipeline, mongo.Pipeline{
+		{{Key: "$addFields", Value: bson.M{
+			"entry": "$entry",
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         ProjectCollection,
+			"localField":   "entry.projectId",
+			"foreignField": "_id",
+			"as":           "project",
+		}}},
+		{{Key: "$unwind", Value: bson.M{
+			"path":                       "$project",
+			"preserveNullAndEmptyArrays": true,
+		}}},
+		{{Key: "$addFields", Value: bson.M{
+			"project": "$project",
+		}}},
+	}...)
+	return db.Aggregate[types.PlanningAssignmentDetail](ctx, collection, pipeline)
+}
+
+// startRange is the condition on the parsed start of the entries, empty when the range is open.
+func startRange(filter repository.AssignmentFilter) bson.M {
+	start := bson.M{}
+	if !filter.StartFrom.IsZero() {
+		start["$gte"] = filter.StartFrom
+	}
+	if !filter.StartTo.IsZero() {
+		start["$lt"] = filter.StartTo
+	}
+	return start
+}
+
+func (r assignmentRepository) SaveMany(ctx context.Context, group types.Group, assignments []*types.PlanningAssignment) error {
+	if len(assignments) == 0 {
+		return nil
+	}
+	collection, err := r.collection(PlanningAssignmentCollection, group)
+	if err != nil {
+		return err
+	}
+	entities := make([]types.Identifiable, 0, len(assignments))
+	for _, assignment := range assignments {
+		entities = append(entities, assignment)
+	}
+	return db.InsertOrUpdateMany(ctx, entities, collection)
+}
+
+func (r assignmentRepository) Delete(ctx context.Context, group types.Group, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	collection, err := r.collection(PlanningAssignmentCollection, group)
+	if err != nil {
+		return err
+	}
+	_, err = collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
+
+type organizationRepository struct{ conn }
+
+func (r organizationRepository) organizationCollection() *mongo.Collection {
+	return r.client.AdminCollection(services.OrganizationCollection)
+}
+
+func (r organizationRepository) FindAll(ctx context.Context) ([]types.Organization, error) {
+	return db.FindAll[types.Organization](ctx, r.organizationCollection(), nil)
+}
+
+func (r organizationRepository) FindByID(ctx context.Context, id string) (types.Organization, error) {
+	return db.FindOneByID[types.Organization](ctx, r.organizationCollection(), id)
+}
+
+func (r organizationRepository) FindByGroup(ctx context.Context, group types.Group) (types.Organization, error) {
+	return db.FindOneBy[types.Organization](ctx, bson.M{"group": group}, r.organizationCollection())
+}
+
+func (r organizationRepository) Save(ctx context.Context, org *types.Organization) error {
+	_, err := db.InsertOrUpdate(ctx, org, r.organizationCollection())
+	return err
+}
+
+type transactor struct{ conn }
+
+// WithTransaction runs fn in a session transaction. The driver retries it on transient errors
+// and retries the commit when its outcome is unknown.
+func (t transactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !t.client.SupportsTransactions(ctx) {
+		return repository.ErrNoTransaction
+	}
+	session, err := t.client.Mongo().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
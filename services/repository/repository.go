@@ -0,0 +1,127 @@
+// Package repository declares how the services reach the users, projects, planning entries,
+// assignments and organizations, whatever the storage. The mongo implementation is in
+// services/repository/mongorepo, an in-memory one for the tests in services/repository/memory.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNotFound is returned when a document doesn't exist. It is the error of the mongo driver, so
+// that the callers already checking it keep working.
+var ErrNotFound = mongo.ErrNoDocuments
+
+// ErrConflict is returned when saving a types.Versioned document modified since it was read.
+var ErrConflict = db.ErrConflict
+
+// ErrNoTransaction is returned by a Transactor when the storage doesn't support transactions.
+var ErrNoTransaction = errors.New("transactions are not supported")
+
+type UserRepository interface {
+	FindByID(ctx context.Context, group types.Group, id string) (types.User, error)
+	// FindByIDs returns the users found, the unknown ids are ignored
+	FindByIDs(ctx context.Context, group types.Group, ids []string) ([]types.User, error)
+	Save(ctx context.Context, group types.Group, user *types.User) error
+}
+
+type ProjectRepository interface {
+	// FindAll leaves out the soft-deleted projects
+	FindAll(ctx context.Context, group types.Group) ([]types.Project, error)
+	FindDeleted(ctx context.Context, group types.Group) ([]types.Project, error)
+	// FindByID also returns a soft-deleted project
+	FindByID(ctx context.Context, group types.Group, id string) (types.Project, error)
+	// Save returns ErrConflict if the project was modified since it was read
+	Save(ctx context.Context, group types.Group, project *types.Project) error
+	// Delete removes the project for good, an unknown id is not an error
+	Delete(ctx context.Context, group types.Group, id string) error
+}
+
+type PlanningRepository interface {
+	// FindByProject leaves out the soft-deleted entries
+	FindByProject(ctx context.Context, group types.Group, projectID string) ([]types.PlanningEntry, error)
+	// FindDeleted returns the soft-deleted entries of the project, of all projects when empty
+	FindDeleted(ctx context.Context, group types.Group, projectID string) ([]types.PlanningEntry, error)
+	// FindByID also returns a soft-deleted entry
+	FindByID(ctx context.Context, group types.Group, id string) (types.PlanningEntry, error)
+	// Save returns ErrConflict if the entry was modified since it was read
+	Save(ctx context.Context, group types.Group, entry *types.PlanningEntry) error
+	// Delete removes the entry for good, an unknown id is not an error
+	Delete(ctx context.Context, group types.Group, id string) error
+}
+
+// AssignmentFilter selects assignments, the zero value selects all of them.
+type AssignmentFilter struct {
+	EmployeeID string
+	EntryID    string
+	ActiveOnly bool // without the cancelled ones
+	// only FindDetails applies them: the entry starts within [StartFrom, StartTo), a zero bound is open
+	StartFrom time.Time
+	StartTo   time.Time
+}
+
+type AssignmentRepository interface {
+	Find(ctx context.Context, group types.Group, filter AssignmentFilter) ([]types.PlanningAssignment, error)
+	// FindDetails joins the assignments with their entry and project. Assignments whose entry is
+	// gone, or soft-deleted, are left out.
+	FindDetails(ctx context.Context, group types.Group, filter AssignmentFilter) ([]types.PlanningAssignmentDetail, error)
+	// SaveMany inserts the assignments without id and replaces the others.
+	SaveMany(ctx context.Context, group types.Group, assignments []*types.PlanningAssignment) error
+	// Delete removes the assignments for good, the unknown ids are ignored
+	Delete(ctx context.Context, group types.Group, ids []string) error
+}
+
+// Transactor runs a unit of work atomically. The repositories called with the context given to
+// fn take part in the transaction, which is retried by the storage on transient errors, so fn
+// must be safe to run more than once.
+type Transactor interface {
+	// WithTransaction returns ErrNoTransaction, without calling fn, when the storage cannot
+	// run transactions.
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// OrganizationRepository works on the admin database, organizations are not in a group.
+type OrganizationRepository interface {
+	FindAll(ctx context.Context) ([]types.Organization, error)
+	FindByID(ctx context.Context, id string) (types.Organization, error)
+	FindByGroup(ctx context.Context, group types.Group) (types.Organization, error)
+	Save(ctx context.Context, org *types.Organization) error
+}
+
+type Repositories struct {
+	Users         UserRepository
+	Projects      ProjectRepository
+	Planning      PlanningRepository
+	Assignments   AssignmentRepository
+	Organizations OrganizationRepository
+	Transactions  Transactor
+}
+
+// Match tells whether the assignment is selected by the filter.
+func (f AssignmentFilter) Match(assignment types.PlanningAssignment) bool {
+	return (f.EmployeeID == "" || assignment.EmployeeID == f.EmployeeID) &&
+		(f.EntryID == "" || assignment.EntryID == f.EntryID) &&
+		(!f.ActiveOnly || !assignment.Cancelled)
+}
+
+// MatchEntry tells whether the entry starts within the range of the filter. Its start is read in
+// the location of the bounds.
+func (f AssignmentFilter) MatchEntry(entry types.PlanningEntry) bool {
+	if f.StartFrom.IsZero() && f.StartTo.IsZero() {
+		return true
+	}
+	location := f.StartFrom.Location()
+	if f.StartFrom.IsZero() {
+		location = f.StartTo.Location()
+	}
+	start, err := time.ParseInLocation(types.BelgianDateTimeFormat, entry.Start, location)
+	if err != nil {
+		return false
+	}
+	return (f.StartFrom.IsZero() || !start.Before(f.StartFrom)) && (f.StartTo.IsZero() || start.Before(f.StartTo))
+}
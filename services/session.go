@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const SessionCollection = "session"
+
+var ErrInvalidRefreshToken = fmt.Errorf("invalid refresh token")
+
+func issueTokens(ctx context.Context, user *types.User, session *types.Session, refreshToken string, now time.Time) (*types.TokenPair, error) {
+	if err := CheckOrganizationActive(ctx, *user.Group); err != nil {
+		return nil, err
+	}
+	claims := NewUserClaims(user, session.ID, now)
+	applyMFAPolicy(ctx, claims, user, session)
+	accessToken, err := SignUserClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &types.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    claims.ExpiresAt.Time,
+	}, nil
+}
+
+// CreateSession opens a new session for the user and returns its first access and refresh tokens.
+// It is used once the password was checked, for users without a second factor.
+func CreateSession(ctx context.Context, user *types.User, userAgent string, ip string) (*types.TokenPair, error) {
+	return createSession(ctx, user, userAgent, ip, false)
+}
+
+func createSession(ctx context.Context, user *types.User, userAgent string, ip string, mfaVerified bool) (*types.TokenPair, error) {
+	collection, err := dbClient.Collection(SessionCollection, *user.Group)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, hash, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := types.Session{
+		UserID:      user.ID,
+		RefreshHash: hash,
+		UserAgent:   userAgent,
+		IP:          ip,
+		CreatedAt:   now,
+		RefreshedAt: now,
+		ExpiresAt:   now.Add(config.RefreshTokenExpiresAfter),
+		MFAVerified: mfaVerified,
+	}
+	if _, err = db.InsertOrUpdate(ctx, &session, collection); err != nil {
+		return nil, err
+	}
+	return issueTokens(ctx, user, &session, refreshToken, now)
+}
+
+// RefreshSession exchanges a refresh token for a new pair. The refresh token rotates: presenting
+// an already used one means it leaked, and the whole session is revoked.
+func RefreshSession(ctx context.Context, refreshToken string, group types.Group, userAgent string, ip string) (*types.TokenPair, error) {
+	collection, err := dbClient.Collection(SessionCollection, group)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	hash := hashToken(refreshToken)
+	session, err := db.FindOneBy[types.Session](ctx, bson.M{
+		"$or": []bson.M{
+			{"refreshHash": hash},
+			{"previousRefreshHash": hash},
+		},
+	}, collection)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	now := time.Now()
+	if session.RevokedAt != nil || now.After(session.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if session.RefreshHash != hash {
+		log.Println("refresh token reused, revoking session", session.ID)
+		if err = RevokeSession(ctx, session.ID, group); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	user, err := FindUserByID(ctx, session.UserID, group)
+	if err != nil || !user.CanSignIn() {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	newRefreshToken, newHash, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	// conditional on the current hash, so that two concurrent refreshes cannot both win
+	res, err := collection.UpdateOne(ctx, bson.M{"_id": session.ID, "refreshHash": hash}, bson.M{"$set": bson.M{
+		"refreshHash":         newHash,
+		"previousRefreshHash": hash,
+		"refreshedAt":         now,
+		"userAgent":           userAgent,
+		"ip":                  ip,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if res.ModifiedCount == 0 {
+		return nil, ErrInvalidRefreshToken
+	}
+	return issueTokens(ctx, &user, &session, newRefreshToken, now)
+}
+
+func RevokeSession(ctx context.Context, sessionID string, group types.Group) error {
+	collection, err := dbClient.Collection(SessionCollection, group)
+	if err != nil {
+		return err
+	}
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": sessionID, "revokedAt": nil}, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	return err
+}
+
+// RevokeUserSessions kills every active session of a user and returns how many were revoked.
+func RevokeUserSessions(ctx context.Context, userID string, group types.Group) (int64, error) {
+	collection, err := dbClient.Collection(SessionCollection, group)
+	if err != nil {
+		return 0, err
+	}
+	res, err := collection.UpdateMany(ctx, bson.M{"userId": userID, "revokedAt": nil}, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// RevokeOtherSessions kills every active session of a user but the current one.
+func RevokeOtherSessions(ctx context.Context, userID string, currentSessionID string, group types.Group) (int64, error) {
+	collection, err := dbClient.Collection(SessionCollection, group)
+	if err != nil {
+		return 0, err
+	}
+	res, err := collection.UpdateMany(ctx, OtherSessionsFilter(userID, currentSessionID), bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// OtherSessionsFilter selects the sessions of a user still to revoke, but the current one.
+func OtherSessionsFilter(userID string, currentSessionID string) bson.M {
+	return bson.M{"userId": userID, "_id": bson.M{"$ne": currentSessionID}, "revokedAt": nil}
+}
+
+// RenewAccessToken signs a new access token for the current session, so that it carries the latest
+// profile and settings of the user. The refresh token is unchanged and not returned.
+func RenewAccessToken(ctx context.Context, claims *types.UserClaims) (*types.TokenPair, error) {
+	collection, err := dbClient.Collection(SessionCollection, claims.Group)
+	if err != nil {
+		return nil, err
+	}
+	session, err := db.FindOneByID[types.Session](ctx, collection, claims.RegisteredClaims.ID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := FindUserByID(ctx, claims.ID, claims.Group)
+	if err != nil {
+		return nil, err
+	}
+	return issueTokens(ctx, &user, &session, "", time.Now())
+}
+
+// FindActiveSessions returns the sessions of a user that were neither revoked nor expired.
+func FindActiveSessions(ctx context.Context, userID string, group types.Group) ([]types.Session, error) {
+	collection, err := dbClient.Collection(SessionCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	return db.Find[types.Session](ctx, bson.M{
+		"userId":    userID,
+		"revokedAt": nil,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}, collection, nil)
+}
+
+// IsSessionActive checks on every authenticated request that the session of the token is still
+// valid and that its user is still enabled.
+func IsSessionActive(ctx context.Context, claims *types.UserClaims) (bool, error) {
+	if claims.RegisteredClaims.ID == "" {
+		return false, nil
+	}
+	userCollection, err := dbClient.Collection(UserCollection, claims.Group)
+	if err != nil {
+		return false, err
+	}
+	sessionCollection, err := dbClient.Collection(SessionCollection, claims.Group)
+	if err != nil {
+		return false, err
+	}
+	filter := bson.M{
+		"$and": []bson.M{
+			{"username": claims.Username},
+			{"group": claims.Group},
+			{"_id": claims.ID},
+			{"enabled": true},
+			{"disabled": bson.M{"$ne": true}},
+		},
+	}
+	if exist, err := db.Exist(ctx, filter, userCollection); !exist || err != nil {
+		return false, err
+	}
+	return db.Exist(ctx, bson.M{
+		"_id":       claims.RegisteredClaims.ID,
+		"userId":    claims.ID,
+		"revokedAt": nil,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}, sessionCollection)
+}
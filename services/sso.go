@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/oidc"
+	"github.com/nbittich/wtm/services/utils"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	OIDCStateCollection = "oidcState"
+	oidcStateExpiration = 10 * time.Minute
+	oidcDiscoveryTTL    = time.Hour
+	// attempts to find a free username for a provisioned user
+	ssoUsernameAttempts = 20
+)
+
+var oidcProviders = oidc.NewCache(oidcDiscoveryTTL, nil)
+
+var (
+	ErrSSONotConfigured = fmt.Errorf("single sign-on not configured for this organization")
+	ErrSSOFailed        = fmt.Errorf("single sign-on failed")
+)
+
+func oidcProvider(ctx context.Context, group types.Group) (*oidc.Provider, *types.OIDCConfig, error) {
+	org, err := db.FindOneBy[types.Organization](ctx, bson.M{"group": group}, dbClient.AdminCollection(OrganizationCollection))
+	if err != nil || org.OIDC == nil {
+		return nil, nil, ErrSSONotConfigured
+	}
+	redirectURL := fmt.Sprintf("%s/users/sso/%s/callback", config.BaseURL, url.PathEscape(string(group)))
+	provider, err := oidcProviders.Discover(ctx, org.OIDC.Issuer, org.OIDC.ClientID, org.OIDC.ClientSecret, redirectURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	return provider, org.OIDC, nil
+}
+
+// StartSSO returns the url of the identity provider of the organization where the user must sign in.
+func StartSSO(ctx context.Context, group types.Group) (string, error) {
+	provider, _, err := oidcProvider(ctx, group)
+	if err != nil {
+		return "", err
+	}
+	collection, err := dbClient.Collection(OIDCStateCollection, group)
+	if err != nil {
+		return "", err
+	}
+	state, hash, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, _, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	oidcState := types.OIDCState{
+		Hash:      hash,
+		Nonce:     nonce,
+		ExpiresAt: time.Now().Add(oidcStateExpiration),
+	}
+	if _, err = db.InsertOrUpdate(ctx, &oidcState, collection); err != nil {
+		return "", err
+	}
+	return provider.AuthCodeURL(state, nonce), nil
+}
+
+// CompleteSSO handles the callback of the identity provider and signs in the matching user. Like
+// a password login, a user who enabled two factor authentication must then complete the returned
+// mfa challenge, unless the organization trusts the second factor of its identity provider. Either
+// the tokens or the mfa token are returned.
+func CompleteSSO(ctx context.Context, group types.Group, state string, code string, userAgent string, ip string) (*types.TokenPair, string, error) {
+	collection, err := dbClient.Collection(OIDCStateCollection, group)
+	if err != nil {
+		return nil, "", ErrSSOFailed
+	}
+	var oidcState types.OIDCState
+	// single use: the state is removed as soon as it is read
+	if err = collection.FindOneAndDelete(ctx, bson.M{"hash": hashToken(state)}).Decode(&oidcState); err != nil {
+		return nil, "", ErrSSOFailed
+	}
+	if time.Now().After(oidcState.ExpiresAt) {
+		return nil, "", ErrSSOFailed
+	}
+	provider, oidcConfig, err := oidcProvider(ctx, group)
+	if err != nil {
+		return nil, "", err
+	}
+	idToken, err := provider.Exchange(ctx, code, oidcState.Nonce)
+	if err != nil {
+		log.Println("could not exchange authorization code:", err)
+		return nil, "", ErrSSOFailed
+	}
+	user, err := findOrProvisionSSOUser(ctx, group, idToken, oidcConfig.Provisioning)
+	if err != nil {
+		return nil, "", err
+	}
+	if !user.CanSignIn() {
+		return nil, "", ErrSSOFailed
+	}
+	mfaVerified := oidcConfig.TrustMFA && idToken.MultiFactor()
+	if !mfaVerified && user.TOTP != nil && user.TOTP.Enabled {
+		mfaToken, err := StartMFAChallenge(ctx, user)
+		return nil, mfaToken, err
+	}
+	tokens, err := createSession(ctx, user, userAgent, ip, mfaVerified)
+	return tokens, "", err
+}
+
+// findOrProvisionSSOUser maps the identity to a user: first by subject, then by verified email,
+// in which case the subject is linked for the next logins. A user linked to another subject is
+// refused.
+func findOrProvisionSSOUser(ctx context.Context, group types.Group, idToken *oidc.IDToken, provisioning bool) (*types.User, error) {
+	collection, err := dbClient.Collection(UserCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	user, err := db.FindOneBy[*types.User](ctx, bson.M{"oidcSubject": idToken.Subject}, collection)
+	if err == nil {
+		return user, nil
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	if idToken.Email == "" || !idToken.EmailVerified {
+		log.Println("identity provider didn't give a verified email for subject", idToken.Subject)
+		return nil, ErrSSOFailed
+	}
+	user, err = db.FindOneBy[*types.User](ctx, bson.M{"email": idToken.Email}, collection)
+	if err == nil {
+		// the address may have been given to another account at the identity provider
+		if !user.LinkableTo(idToken.Subject) {
+			log.Println("user", user.ID, "is already linked to another subject than", idToken.Subject)
+			return nil, ErrSSOFailed
+		}
+		linked, err := updateUser(ctx, group, bson.M{"_id": user.ID, "oidcSubject": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"oidcSubject": idToken.Subject}})
+		if err != nil {
+			return nil, err
+		}
+		if !linked {
+			return nil, ErrSSOFailed
+		}
+		user.OIDCSubject = idToken.Subject
+		return user, nil
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	if !provisioning {
+		return nil, ErrSSOFailed
+	}
+	username, err := freeUsername(ctx, idToken.Email, collection)
+	if err != nil {
+		return nil, err
+	}
+	lang, _ := ctx.Value(types.LangKey).(string)
+	user = &types.User{
+		Username:    username,
+		Email:       idToken.Email,
+		Enabled:     true,
+		Settings:    types.UserSetting{Lang: lang},
+		Profile:     types.UserProfile{},
+		Roles:       []types.Role{types.USER},
+		Group:       &group,
+		OIDCSubject: idToken.Subject,
+	}
+	if _, err = db.InsertOrUpdate(ctx, user, collection); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// freeUsername derives from the email a valid username that no user of the group has yet.
+func freeUsername(ctx context.Context, email string, collection *mongo.Collection) (string, error) {
+	for suffix := range ssoUsernameAttempts {
+		username := utils.UsernameFromEmail(email, suffix)
+		exist, err := db.Exist(ctx, bson.M{"username": username}, collection)
+		if err != nil {
+			return "", err
+		}
+		if !exist {
+			return username, nil
+		}
+	}
+	return "", fmt.Errorf("no free username for %s", email)
+}
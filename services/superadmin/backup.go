@@ -0,0 +1,205 @@
+package superadmin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nbittich/wtm/services/backup"
+	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/migrations"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const importBatchSize = 1000
+
+// same rule as OrganizationForm.Group
+var groupPattern = regexp.MustCompile(`^[a-zA-Z]{2,24}$`)
+
+// ExportOrg writes the archive of the organization id: its document and every collection of its group.
+func ExportOrg(ctx context.Context, id string, w io.Writer) error {
+	raw, err := orgCollection().FindOne(ctx, db.FilterByID(id)).Raw()
+	if err != nil {
+		return err
+	}
+	var org types.Organization
+	if err = bson.Unmarshal(raw, &org); err != nil {
+		return err
+	}
+	names, err := dbClient.ListCollectionNames(ctx, org.Group)
+	if err != nil {
+		return err
+	}
+	names = slices.DeleteFunc(names, func(name string) bool { return strings.HasPrefix(name, "system.") })
+	slices.Sort(names)
+
+	archive := backup.NewWriter(w, string(org.Group), time.Now())
+	if err = archive.WriteOrganization(raw); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err = exportCollection(ctx, archive, name, org.Group); err != nil {
+			return fmt.Errorf("could not export collection %s: %w", name, err)
+		}
+	}
+	return archive.Close()
+}
+
+func exportCollection(ctx context.Context, archive *backup.Writer, name string, group types.Group) error {
+	collection, err := dbClient.Collection(name, group)
+	if err != nil {
+		return err
+	}
+	cw, err := archive.Collection(name)
+	if err != nil {
+		return err
+	}
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		if err = cw.Write(cursor.Current); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// ImportOrg restores an archive into group, or into the group it was exported from when empty.
+// The group must be new or empty. The organization gets a new id when its id is already taken,
+// so that a tenant can be copied within the same environment.
+func ImportOrg(ctx context.Context, r io.ReaderAt, size int64, group types.Group) (*types.Organization, error) {
+	archive, err := backup.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if group == "" {
+		group = types.Group(archive.Manifest.Group)
+	}
+	if !groupPattern.MatchString(string(group)) {
+		return nil, fmt.Errorf("invalid group %s", group)
+	}
+	rawOrg, err := archive.Organization()
+	if err != nil {
+		return nil, err
+	}
+	var org types.Organization
+	if err = bson.Unmarshal(rawOrg, &org); err != nil {
+		return nil, err
+	}
+	if exist, err := db.Exist(ctx, bson.M{"group": group}, orgCollection()); err != nil || exist {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("organization %s already exists", group)
+	}
+	if dbClient.GroupExists(group) {
+		if err = checkGroupEmpty(ctx, group); err != nil {
+			return nil, err
+		}
+	} else if err = dbClient.NewGroup(ctx, group); err != nil {
+		return nil, err
+	}
+	if err = importGroup(ctx, archive, &org, group); err != nil {
+		// the group was empty, dropping it lets the import be retried
+		if dropErr := dbClient.DropGroup(context.WithoutCancel(ctx), group); dropErr != nil {
+			log.Printf("could not drop group %s after a failed import: %v\n", group, dropErr)
+		}
+		return nil, err
+	}
+	return &org, nil
+}
+
+// importGroup fills the empty group with the collections of the archive, then saves the organization.
+func importGroup(ctx context.Context, archive *backup.Reader, org *types.Organization, group types.Group) error {
+	from := archive.Manifest.Group
+	for _, entry := range archive.Manifest.Collections {
+		if err := importCollection(ctx, archive, entry, from, group); err != nil {
+			return fmt.Errorf("could not import collection %s: %w", entry.Name, err)
+		}
+	}
+	// the archive may come from an older version
+	if _, err := migrations.MigrateGroup(ctx, group); err != nil {
+		return err
+	}
+
+	org.Group = group
+	// a suspended or deleted organization is exported as is, it must not be purged once imported
+	org.ResetLifecycle()
+	if exist, err := db.Exist(ctx, db.FilterByID(org.ID), orgCollection()); err != nil {
+		return err
+	} else if exist {
+		org.ID = ""
+	}
+	_, err := db.InsertOrUpdate(ctx, org, orgCollection())
+	return err
+}
+
+// checkGroupEmpty refuses to import into a group holding data.
+func checkGroupEmpty(ctx context.Context, group types.Group) error {
+	names, err := dbClient.ListCollectionNames(ctx, group)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		collection, err := dbClient.Collection(name, group)
+		if err != nil {
+			return err
+		}
+		count, err := db.Count(ctx, bson.M{}, collection)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("group %s is not empty, collection %s has %d documents", group, name, count)
+		}
+	}
+	return nil
+}
+
+func importCollection(ctx context.Context, archive *backup.Reader, entry backup.CollectionEntry, from string, group types.Group) error {
+	collection, err := dbClient.Collection(entry.Name, group)
+	if err != nil {
+		return err
+	}
+	batch := make([]interface{}, 0, importBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := collection.InsertMany(ctx, batch)
+		batch = batch[:0]
+		return err
+	}
+	if err = archive.ReadCollection(entry, func(doc bson.Raw) error {
+		doc, err := backup.RewriteGroup(doc, from, string(group))
+		if err != nil {
+			return err
+		}
+		batch = append(batch, doc)
+		if len(batch) == importBatchSize {
+			return flush()
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err = flush(); err != nil {
+		return err
+	}
+	// empty collections are created too, so that the group looks the same as the exported one
+	if entry.Count == 0 {
+		if err := collection.Database().CreateCollection(ctx, entry.Name); err != nil && !db.IsNamespaceExists(err) {
+			return err
+		}
+	}
+	return nil
+}
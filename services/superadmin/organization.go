@@ -3,18 +3,45 @@ package superadmin
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/nbittich/wtm/config"
 	"github.com/nbittich/wtm/services"
 	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/migrations"
+	"github.com/nbittich/wtm/services/repository"
+	"github.com/nbittich/wtm/services/repository/mongorepo"
 	"github.com/nbittich/wtm/services/utils"
 	"github.com/nbittich/wtm/types"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-var adminOrgCollection = db.GetAdminCollection("organization")
+var (
+	dbClient *db.Client
+	repos    repository.Repositories
+)
+
+// Init sets the database client of the organizations and builds the repositories on top of it.
+func Init(client *db.Client) {
+	dbClient = client
+	repos = mongorepo.New(client)
+}
+
+func orgCollection() *mongo.Collection {
+	return dbClient.AdminCollection(services.OrganizationCollection)
+}
 
 func ListOrgs(ctx context.Context) ([]types.Organization, error) {
-	return db.FindAll[types.Organization](ctx, adminOrgCollection, nil)
+	return repos.Organizations.FindAll(ctx)
+}
+
+func GetOrgByGroup(ctx context.Context, group types.Group) (types.Organization, error) {
+	return repos.Organizations.FindByGroup(ctx, group)
+}
+
+func OrgExists(ctx context.Context, id string) (bool, error) {
+	return db.Exist(ctx, db.FilterByID(id), orgCollection())
 }
 
 func AddOrUpdateOrg(ctx context.Context, form *types.OrganizationForm) (*types.Organization, error) {
@@ -28,30 +55,50 @@ func AddOrUpdateOrg(ctx context.Context, form *types.OrganizationForm) (*types.O
 			{"group": form.Group},
 		},
 	}
-	org, err := db.FindOneBy[*types.Organization](ctx, filter, adminOrgCollection)
+	org, err := db.FindOneBy[*types.Organization](ctx, filter, orgCollection())
 	if err != nil {
-		if form.NewUser == nil {
-			return nil, fmt.Errorf("user cannot be null")
+		if form.Admin == nil && form.NewUser == nil {
+			return nil, fmt.Errorf("admin cannot be null")
 		}
 		// create a new org
 		org = &types.Organization{
 			Group:          types.Group(form.Group),
 			FullName:       form.FullName,
 			AdditionalInfo: form.AdditionalInfo,
-			Email:          form.NewUser.Email,
 		}
-		if err := db.NewGroup(ctx, org.Group); err != nil {
+		if form.Admin != nil {
+			org.Email = form.Admin.Email
+		} else {
+			org.Email = form.NewUser.Email
+		}
+		if form.RequireMFAForAdmins != nil {
+			org.RequireMFAForAdmins = *form.RequireMFAForAdmins
+		}
+		if form.OIDC != nil {
+			org.OIDC = applyOIDCForm(org.OIDC, form.OIDC)
+		}
+		if err := dbClient.NewGroup(ctx, org.Group); err != nil {
+			return org, err
+		}
+		if err := migrations.Baseline(ctx, org.Group); err != nil {
 			return org, err
 		}
-		if _, err := db.InsertOrUpdate(ctx, org, adminOrgCollection); err != nil {
+		if _, err := db.InsertOrUpdate(ctx, org, orgCollection()); err != nil {
 			return org, err
 		}
-		// create a default user
-		if form.NewUser.Role == nil {
-			role := types.ADMIN
-			form.NewUser.Role = &role
+		role := types.ADMIN
+		if form.Admin == nil {
+			if form.NewUser.Role == nil {
+				form.NewUser.Role = &role
+			}
+			if _, err := services.NewUser(ctx, form.NewUser, org.Group); err != nil {
+				return org, err
+			}
+			return org, nil
 		}
-		if _, err := services.NewUser(ctx, form.NewUser, org.Group); err != nil {
+		// invite the first admin, who chooses their own username and password
+		form.Admin.Role = &role
+		if _, err := services.InviteUser(ctx, form.Admin, org.Group, ""); err != nil {
 			return org, err
 		}
 
@@ -63,7 +110,13 @@ func AddOrUpdateOrg(ctx context.Context, form *types.OrganizationForm) (*types.O
 		if form.Email != nil {
 			org.Email = *form.Email
 		}
-		if _, err := db.InsertOrUpdate(ctx, org, adminOrgCollection); err != nil {
+		if form.RequireMFAForAdmins != nil {
+			org.RequireMFAForAdmins = *form.RequireMFAForAdmins
+		}
+		if form.OIDC != nil {
+			org.OIDC = applyOIDCForm(org.OIDC, form.OIDC)
+		}
+		if _, err := db.InsertOrUpdate(ctx, org, orgCollection()); err != nil {
 			return nil, err
 		}
 	} else {
@@ -71,3 +124,94 @@ func AddOrUpdateOrg(ctx context.Context, form *types.OrganizationForm) (*types.O
 	}
 	return org, nil
 }
+
+func applyOIDCForm(current *types.OIDCConfig, form *types.OIDCForm) *types.OIDCConfig {
+	config := &types.OIDCConfig{
+		Issuer:       form.Issuer,
+		ClientID:     form.ClientID,
+		ClientSecret: form.ClientSecret,
+		Provisioning: form.Provisioning,
+		TrustMFA:     form.TrustMFA,
+	}
+	if config.ClientSecret == "" && current != nil {
+		config.ClientSecret = current.ClientSecret
+	}
+	return config
+}
+
+func findOrg(ctx context.Context, id string) (*types.Organization, error) {
+	org, err := repos.Organizations.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// SuspendOrg blocks the members of the organization until it is reactivated. Their tokens stop
+// working at once, their data is kept.
+func SuspendOrg(ctx context.Context, id string) (*types.Organization, error) {
+	return changeOrgStatus(ctx, id, func(org *types.Organization) error { return org.Suspend(time.Now()) })
+}
+
+func ReactivateOrg(ctx context.Context, id string) (*types.Organization, error) {
+	return changeOrgStatus(ctx, id, (*types.Organization).Reactivate)
+}
+
+// DeleteOrg blocks the organization and schedules the drop of its database after the grace
+// period. Until then, it can be restored.
+func DeleteOrg(ctx context.Context, id string) (*types.Organization, error) {
+	return changeOrgStatus(ctx, id, func(org *types.Organization) error {
+		return org.Delete(time.Now(), config.OrganizationDeletionGrace)
+	})
+}
+
+// RestoreOrg cancels the deletion of the organization. It goes back to suspended when it was
+// suspended before the deletion.
+func RestoreOrg(ctx context.Context, id string) (*types.Organization, error) {
+	return changeOrgStatus(ctx, id, func(org *types.Organization) error { return org.Restore(time.Now()) })
+}
+
+func changeOrgStatus(ctx context.Context, id string, change func(*types.Organization) error) (*types.Organization, error) {
+	org, err := findOrg(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err = change(org); err != nil {
+		return nil, err
+	}
+	if err = repos.Organizations.Save(ctx, org); err != nil {
+		return nil, err
+	}
+	services.ForgetOrganizationStatus(org.Group)
+	return org, nil
+}
+
+// PurgeDeletedOrgs drops the database of the organizations whose grace period is over, then
+// forgets them. It returns the purged groups.
+func PurgeDeletedOrgs(ctx context.Context, now time.Time) ([]types.Group, error) {
+	orgs, err := db.Find[types.Organization](ctx, bson.M{
+		"status":  types.OrganizationDeleted,
+		"purgeAt": bson.M{"$lte": now},
+	}, orgCollection(), nil)
+	if err != nil {
+		return nil, err
+	}
+	purged := make([]types.Group, 0, len(orgs))
+	for _, org := range orgs {
+		if !org.PurgeDue(now) {
+			continue
+		}
+		if err := dbClient.DropGroup(ctx, org.Group); err != nil {
+			return purged, fmt.Errorf("could not drop group %s: %w", org.Group, err)
+		}
+		if _, err := orgCollection().DeleteOne(ctx, db.FilterByID(org.ID)); err != nil {
+			return purged, err
+		}
+		if _, err := dbClient.AdminCollection(services.LoginThrottleCollection).DeleteMany(ctx, bson.M{"group": org.Group}); err != nil {
+			return purged, err
+		}
+		services.ForgetOrganizationStatus(org.Group)
+		purged = append(purged, org.Group)
+	}
+	return purged, nil
+}
@@ -0,0 +1,62 @@
+package throttle
+
+import "time"
+
+// Policy of the login throttling. The first FreeAttempts failures cost nothing, then every failure
+// doubles the delay before the next attempt, up to MaxDelay. After LockAfter failures the subject is
+// locked for LockDuration. Failures older than ResetAfter are forgotten.
+type Policy struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockAfter    int // 0 never locks
+	LockDuration time.Duration
+	ResetAfter   time.Duration
+}
+
+// State is the failure counter of a subject, a user or an ip address.
+type State struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// Backoff returns the delay to wait after the given number of consecutive failures.
+func (p Policy) Backoff(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Stale tells whether the failures are old enough to be forgotten.
+func (p Policy) Stale(state State, now time.Time) bool {
+	return p.ResetAfter > 0 && !state.LastFailureAt.IsZero() && now.Sub(state.LastFailureAt) >= p.ResetAfter &&
+		(state.LockedUntil == nil || !now.Before(*state.LockedUntil))
+}
+
+// Check returns how long the subject must wait before trying again, and whether it is locked.
+func (p Policy) Check(state State, now time.Time) (time.Duration, bool) {
+	if state.LockedUntil != nil && now.Before(*state.LockedUntil) {
+		return state.LockedUntil.Sub(now), true
+	}
+	if p.Stale(state, now) {
+		return 0, false
+	}
+	if wait := state.LastFailureAt.Add(p.Backoff(state.Failures)).Sub(now); wait > 0 {
+		return wait, false
+	}
+	return 0, false
+}
+
+// ShouldLock tells whether the failures reached the lock threshold.
+func (p Policy) ShouldLock(failures int) bool {
+	return p.LockAfter > 0 && failures >= p.LockAfter
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nbittich/wtm/config"
+	"github.com/nbittich/wtm/services/jwks"
+	"github.com/nbittich/wtm/types"
+)
+
+// generateToken returns a random url safe token and its sha256, only the latter is stored.
+func generateToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewUserClaims returns the claims of an access token bound to the given session.
+func NewUserClaims(user *types.User, sessionID string, now time.Time) *types.UserClaims {
+	return &types.UserClaims{
+		ID:       user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		Profile:  user.Profile,
+		Settings: user.Settings,
+		Roles:    user.Roles,
+		Group:    *user.Group,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(config.JWTExpiresAFterMinutes)),
+			Issuer:    config.JWTIssuer,
+		},
+	}
+}
+
+var (
+	keySet *jwks.KeySet
+
+	errNoKeySet = fmt.Errorf("signing keys not loaded")
+)
+
+// LoadKeySet reads the keys signing the access tokens from JWT_KEYS_DIRECTORY, it must be called
+// once at startup. Without a directory, an ephemeral key is generated in development only: tokens
+// then don't survive a restart and are not shared between instances.
+func LoadKeySet() error {
+	if config.JWTKeysDirectory != "" {
+		ks, err := jwks.LoadDirectory(config.JWTKeysDirectory, config.JWTActiveKeyID)
+		if err != nil {
+			return err
+		}
+		keySet = ks
+		return nil
+	}
+	if config.GoEnv != config.DEVELOPMENT {
+		return fmt.Errorf("JWT_KEYS_DIRECTORY must be set outside development")
+	}
+	log.Println("JWT_KEYS_DIRECTORY not set, using an ephemeral signing key")
+	signer, err := jwks.GenerateKey(jwks.EdDSA)
+	if err != nil {
+		return err
+	}
+	kid, err := jwks.NewKeyID(time.Now())
+	if err != nil {
+		return err
+	}
+	key, err := jwks.NewKey(kid, signer)
+	if err != nil {
+		return err
+	}
+	ks, err := jwks.NewKeySet([]*jwks.Key{key}, kid)
+	if err != nil {
+		return err
+	}
+	keySet = ks
+	return nil
+}
+
+func SignUserClaims(claims *types.UserClaims) (string, error) {
+	if keySet == nil {
+		return "", errNoKeySet
+	}
+	return keySet.Sign(claims)
+}
+
+// JWTKeyfunc resolves the key verifying an access token from its kid.
+func JWTKeyfunc(token *jwt.Token) (interface{}, error) {
+	if keySet == nil {
+		return nil, errNoKeySet
+	}
+	return keySet.Keyfunc(token)
+}
+
+// JWKS returns the public keys other services use to verify our access tokens.
+func JWKS() jwks.JSONWebKeySet {
+	if keySet == nil {
+		return jwks.JSONWebKeySet{Keys: []jwks.JSONWebKey{}}
+	}
+	return keySet.JWKS()
+}
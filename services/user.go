@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,10 +13,12 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/nbittich/wtm/config"
 	"github.com/nbittich/wtm/services/db"
+	"github.com/nbittich/wtm/services/db/query"
 	"github.com/nbittich/wtm/services/email"
 	"github.com/nbittich/wtm/services/utils"
 	"github.com/nbittich/wtm/types"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -22,8 +26,17 @@ import (
 const (
 	UserCollection              = "user"
 	UserActivationURLCollection = "userActivationUrl"
+	OrganizationCollection      = "organization" // in the admin db
 )
 
+var dbClient *db.Client
+
+// Init sets the database client of the services. It must be called once connected, before
+// serving any request.
+func Init(client *db.Client) {
+	dbClient = client
+}
+
 func hashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), config.DefaultBCryptCost)
 	return string(bytes), err
@@ -44,7 +57,7 @@ func GetUser(c echo.Context) (*types.UserClaims, error) {
 }
 
 func AllUsers(ctx context.Context, group types.Group, page *db.PageOptions) ([]types.User, error) {
-	collection, err := db.GetCollection(UserCollection, group)
+	collection, err := dbClient.Collection(UserCollection, group)
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +67,7 @@ func AllUsers(ctx context.Context, group types.Group, page *db.PageOptions) ([]t
 func NewUser(ctx context.Context, newUserForm *types.NewUserForm, group types.Group) (*types.User, error) {
 	lang := ctx.Value(types.LangKey).(string)
 	var err error
-	collection, err := db.GetCollection(UserCollection, group)
+	collection, err := dbClient.Collection(UserCollection, group)
 	if err != nil {
 		return nil, err
 	}
@@ -110,7 +123,7 @@ func NewUser(ctx context.Context, newUserForm *types.NewUserForm, group types.Gr
 }
 
 func sendActivationEmail(user *types.User, createUser bool) {
-	collection, err := db.GetCollection(UserCollection, *user.Group)
+	collection, err := dbClient.Collection(UserCollection, *user.Group)
 	if err != nil {
 		log.Println("could not create user:", err)
 		return
@@ -133,7 +146,7 @@ func sendActivationEmail(user *types.User, createUser bool) {
 }
 
 func FindUserByID(ctx context.Context, id string, group types.Group) (types.User, error) {
-	userCollection, err := db.GetCollection(UserCollection, group)
+	userCollection, err := dbClient.Collection(UserCollection, group)
 	if err != nil {
 		return types.User{}, err
 	}
@@ -141,15 +154,34 @@ func FindUserByID(ctx context.Context, id string, group types.Group) (types.User
 }
 
 func FindAllUsersByIDs(ctx context.Context, ids []string, group types.Group) ([]types.User, error) {
-	userCollection, err := db.GetCollection(UserCollection, group)
+	userCollection, err := dbClient.Collection(UserCollection, group)
 	if err != nil {
 		return nil, err
 	}
 	return db.FindAllByIDs[types.User](ctx, userCollection, ids, nil)
 }
 
+func SetContractualHours(ctx context.Context, userID string, hours float64, group types.Group) (*types.User, error) {
+	userCollection, err := dbClient.Collection(UserCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	user, err := db.FindOneByID[types.User](ctx, userCollection, userID)
+	if err != nil {
+		return nil, err
+	}
+	user.Profile.ContractualHours = hours
+	if err = utils.ValidateStruct(user.Profile); err != nil {
+		return nil, err
+	}
+	if _, err = db.InsertOrUpdate(ctx, &user, userCollection); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 func FindByUsernameOrEmail(ctx context.Context, username string, group types.Group) (types.User, error) {
-	userCollection, err := db.GetCollection(UserCollection, group)
+	userCollection, err := dbClient.Collection(UserCollection, group)
 	if err != nil {
 		return types.User{}, err
 	}
@@ -168,11 +200,11 @@ func ActivateUser(ctx context.Context, hash string, group types.Group) (bool, er
 		userActivationURLCollection *mongo.Collection
 		err                         error
 	)
-	if userCollection, err = db.GetCollection(UserCollection, group); err != nil {
+	if userCollection, err = dbClient.Collection(UserCollection, group); err != nil {
 		return false, err
 	}
 
-	if userActivationURLCollection, err = db.GetCollection(UserActivationURLCollection, group); err != nil {
+	if userActivationURLCollection, err = dbClient.Collection(UserActivationURLCollection, group); err != nil {
 		return false, err
 	}
 	userActivationURL, err := db.FindOneBy[types.UserActivationURL](ctx, bson.M{
@@ -188,6 +220,9 @@ func ActivateUser(ctx context.Context, hash string, group types.Group) (bool, er
 	if user.Enabled {
 		return false, fmt.Errorf("user already enabled")
 	}
+	if user.Disabled {
+		return false, fmt.Errorf("user disabled")
+	}
 	now := time.Now()
 	duration := now.Sub(userActivationURL.UpdatedAt)
 	if duration > config.ActivationExpiration {
@@ -213,10 +248,10 @@ func GenerateActivateURL(ctx context.Context, baseURL string, userID string, gro
 		err                         error
 		user                        types.User
 	)
-	if userCollection, err = db.GetCollection(UserCollection, group); err != nil {
+	if userCollection, err = dbClient.Collection(UserCollection, group); err != nil {
 		return "", err
 	}
-	if userActivationURLCollection, err = db.GetCollection(UserActivationURLCollection, group); err != nil {
+	if userActivationURLCollection, err = dbClient.Collection(UserActivationURLCollection, group); err != nil {
 		return "", err
 	}
 	if user, err = db.FindOneByID[types.User](ctx, userCollection, userID); err != nil {
@@ -225,6 +260,9 @@ func GenerateActivateURL(ctx context.Context, baseURL string, userID string, gro
 	if user.Enabled {
 		return "", fmt.Errorf("user.alreadyEnabled")
 	}
+	if user.Disabled {
+		return "", fmt.Errorf("user.disabled")
+	}
 	filter := bson.M{
 		"userId": user.ID,
 	}
@@ -247,3 +285,154 @@ func GenerateActivateURL(ctx context.Context, baseURL string, userID string, gro
 	}
 	return userActivationURL.GenerateURL(baseURL), nil
 }
+
+var UserQuery = query.Spec{
+	Sorts: map[string]string{
+		"username":  "username",
+		"email":     "email",
+		"firstName": "profile.firstname",
+		"lastName":  "profile.lastname",
+	},
+	DefaultSort: "username",
+}
+
+// SearchUsers returns a page of the users selected by the filter, the query being contained in
+// their username, email or name.
+func SearchUsers(ctx context.Context, filter types.UserFilter, page query.Page, group types.Group) (query.Result[types.User], error) {
+	collection, err := dbClient.Collection(UserCollection, group)
+	if err != nil {
+		return query.Result[types.User]{}, err
+	}
+	return db.FindPage[types.User](ctx, collection, mongo.Pipeline{{{Key: "$match", Value: UserSearchMatch(filter)}}}, page)
+}
+
+// UserSearchMatch returns the mongo filter of the users selected by SearchUsers.
+func UserSearchMatch(filter types.UserFilter) bson.M {
+	match := bson.M{}
+	if q := strings.TrimSpace(filter.Query); q != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+		match["$or"] = []bson.M{
+			{"username": pattern},
+			{"email": pattern},
+			{"profile.firstname": pattern},
+			{"profile.lastname": pattern},
+		}
+	}
+	if filter.Role != "" {
+		match["roles"] = filter.Role
+	}
+	if filter.Enabled != nil {
+		match["enabled"] = *filter.Enabled
+	}
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			match["disabled"] = true
+		} else {
+			match["disabled"] = bson.M{"$ne": true}
+		}
+	}
+	return match
+}
+
+// UpdateUser applies the changes of an admin to a user. Unlike a change requested through /users/me,
+// the email is changed without confirmation.
+func UpdateUser(ctx context.Context, userID string, group types.Group, form *types.AdminUserForm) (*types.User, error) {
+	if err := utils.ValidateStruct(form); err != nil {
+		return nil, err
+	}
+	collection, err := dbClient.Collection(UserCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	user, err := db.FindOneByID[types.User](ctx, collection, userID)
+	if err != nil {
+		return nil, err
+	}
+	usernameChanged, emailChanged := user.ApplyAdminForm(form)
+	conflicts := make([]bson.M, 0, 2)
+	if usernameChanged {
+		conflicts = append(conflicts, bson.M{"username": user.Username})
+	}
+	if emailChanged {
+		conflicts = append(conflicts, bson.M{"email": user.Email})
+	}
+	if len(conflicts) > 0 {
+		exist, err := db.Exist(ctx, bson.M{"_id": bson.M{"$ne": user.ID}, "$or": conflicts}, collection)
+		if err != nil {
+			return nil, err
+		}
+		if exist {
+			return nil, types.InvalidFormError{Form: form, Messages: types.InvalidMessage{"general": "home.signup.user.exist"}}
+		}
+	}
+	if _, err = db.InsertOrUpdate(ctx, &user, collection); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetUserEnabled enables or disables a user. The sessions of a disabled user are revoked at once,
+// and it can no longer sign in nor activate its account until enabled again. Enabling a user also
+// activates its account.
+func SetUserEnabled(ctx context.Context, userID string, enabled bool, group types.Group) (*types.User, error) {
+	collection, err := dbClient.Collection(UserCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	user, err := db.FindOneByID[types.User](ctx, collection, userID)
+	if err != nil {
+		return nil, err
+	}
+	user.SetEnabled(enabled)
+	if _, err = db.InsertOrUpdate(ctx, &user, collection); err != nil {
+		return nil, err
+	}
+	if !enabled {
+		if _, err = RevokeUserSessions(ctx, user.ID, group); err != nil {
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// SetUserRoles replaces the roles of a user, USER is always kept. When ADMIN is withdrawn, the
+// sessions are revoked so that the role stops working before the access tokens expire.
+func SetUserRoles(ctx context.Context, userID string, form *types.UserRolesForm, group types.Group) (*types.User, error) {
+	if err := utils.ValidateStruct(form); err != nil {
+		return nil, err
+	}
+	collection, err := dbClient.Collection(UserCollection, group)
+	if err != nil {
+		return nil, err
+	}
+	user, err := db.FindOneByID[types.User](ctx, collection, userID)
+	if err != nil {
+		return nil, err
+	}
+	demoted := user.SetRoles(form.Roles)
+	if _, err = db.InsertOrUpdate(ctx, &user, collection); err != nil {
+		return nil, err
+	}
+	if demoted {
+		if _, err = RevokeUserSessions(ctx, user.ID, group); err != nil {
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// ResendActivationEmail sends a new activation link to a user whose account is not activated yet.
+func ResendActivationEmail(ctx context.Context, userID string, group types.Group) error {
+	user, err := FindUserByID(ctx, userID, group)
+	if err != nil {
+		return err
+	}
+	if user.Enabled {
+		return fmt.Errorf("user already enabled")
+	}
+	if user.Disabled {
+		return fmt.Errorf("user disabled")
+	}
+	go sendActivationEmail(&user, false)
+	return nil
+}
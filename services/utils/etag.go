@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ETag returns the entity tag of a version of a types.Versioned document.
+func ETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// SetETag sets the ETag header of the response.
+func SetETag(c echo.Context, version int64) {
+	c.Response().Header().Set("ETag", ETag(version))
+}
+
+// ParseETag returns the version of an entity tag, weak or not.
+func ParseETag(tag string) (int64, error) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	unquoted, err := strconv.Unquote(tag)
+	if err != nil {
+		return 0, fmt.Errorf("invalid entity tag %s", tag)
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("invalid entity tag %s", tag)
+	}
+	return version, nil
+}
+
+// IfMatch returns the version of the If-Match header. ok is false when there is none, or when
+// it is "*", in which case the version of the body is kept.
+func IfMatch(c echo.Context) (version int64, ok bool, err error) {
+	header := strings.TrimSpace(c.Request().Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, false, nil
+	}
+	if strings.Contains(header, ",") {
+		return 0, false, fmt.Errorf("only one entity tag is supported in If-Match")
+	}
+	version, err = ParseETag(header)
+	return version, err == nil, err
+}
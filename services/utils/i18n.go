@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/BurntSushi/toml"
+	"github.com/nbittich/wtm/types"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+var bundle *i18n.Bundle
+
+func init() {
+	bundle = i18n.NewBundle(language.French)
+	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
+	bundle.LoadMessageFile("i18n/fr.toml")
+	bundle.LoadMessageFile("i18n/en.toml")
+}
+
+// NewLocalizer returns a localizer for the languages by order of preference, they can be
+// Accept-Language headers.
+func NewLocalizer(langs ...string) *i18n.Localizer {
+	return i18n.NewLocalizer(bundle, langs...)
+}
+
+// WithLang returns a context translating in lang, e.g. to email users in their own language
+// whatever the language of the request. The context is kept as is when lang is empty.
+func WithLang(ctx context.Context, lang string) context.Context {
+	if lang == "" {
+		return ctx
+	}
+	ctx = context.WithValue(ctx, types.LangKey, lang)
+	return context.WithValue(ctx, types.I18nKey, NewLocalizer(lang))
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nbittich/wtm/services/db/query"
+)
+
+// ParsePage reads the sort, limit and cursor query params of a list.
+func ParsePage(c echo.Context, spec query.Spec) (query.Page, error) {
+	return spec.Parse(c.QueryParam("sort"), c.QueryParam("limit"), c.QueryParam("cursor"))
+}
+
+// QueryBool reads an optional boolean query param, nil when absent.
+func QueryBool(c echo.Context, name string) (*bool, error) {
+	param := c.QueryParam(name)
+	if param == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseBool(param)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", name)
+	}
+	return &value, nil
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nbittich/wtm/types"
+)
+
+// ParsePeriod reads the inclusive from/to query params (dd/mm/yyyy) and returns [from, to+1day).
+func ParsePeriod(c echo.Context) (time.Time, time.Time, error) {
+	from, err := time.ParseInLocation(types.BelgianDateFormat, c.QueryParam("from"), time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := time.ParseInLocation(types.BelgianDateFormat, c.QueryParam("to"), time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from cannot be after to")
+	}
+	return from, to.AddDate(0, 0, 1), nil
+}
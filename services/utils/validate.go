@@ -2,6 +2,7 @@ package utils
 
 import (
 	"regexp"
+	"strconv"
 	"strings"
 	"unicode"
 
@@ -62,3 +63,29 @@ func validatePassword(fl validator.FieldLevel) bool {
 
 	return specialChars.MatchString(password)
 }
+
+// UsernameFromEmail derives a username valid for the signup form (3 to 15 ascii letters and digits,
+// starting with a letter) from the local part of an email. A non zero suffix is appended, to try
+// again when the username is taken.
+func UsernameFromEmail(email string, suffix int) string {
+	local, _, _ := strings.Cut(email, "@")
+	var b strings.Builder
+	for _, r := range strings.ToLower(local) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	username := b.String()
+	if username == "" || username[0] < 'a' || username[0] > 'z' {
+		username = "user" + username
+	}
+	tail := ""
+	if suffix != 0 {
+		tail = strconv.Itoa(suffix)
+	}
+	username = username[:min(len(username), 15-len(tail))] + tail
+	for len(username) < 3 {
+		username += "0"
+	}
+	return username
+}
@@ -0,0 +1,123 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/nbittich/wtm/services/backup"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func marshal(t *testing.T, doc any) bson.Raw {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := backup.NewWriter(&buf, "acme", time.Now())
+	if err := w.WriteOrganization(marshal(t, bson.M{"_id": "1", "group": "acme"})); err != nil {
+		t.Fatal(err)
+	}
+	users, err := w.Collection("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"john", "jane"} {
+		if err := users.Write(marshal(t, bson.M{"username": name, "group": "acme"})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = w.Collection("_migration"); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := backup.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Manifest.Group != "acme" || len(r.Manifest.Collections) != 2 {
+		t.Fatalf("unexpected manifest %+v", r.Manifest)
+	}
+	org, err := r.Organization()
+	if err != nil || org.Lookup("_id").StringValue() != "1" {
+		t.Fatalf("unexpected organization %v %v", org, err)
+	}
+	var names []string
+	if err = r.ReadCollection(r.Manifest.Collections[0], func(doc bson.Raw) error {
+		names = append(names, doc.Lookup("username").StringValue())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "john" || names[1] != "jane" {
+		t.Errorf("unexpected documents %v", names)
+	}
+	if err = r.ReadCollection(r.Manifest.Collections[1], func(bson.Raw) error {
+		t.Error("no document expected")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReaderRejectsInvalidArchives(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+	}{
+		{"no manifest", ""},
+		{"unknown version", `{"version":99,"group":"acme"}`},
+		{"path in collection name", `{"version":1,"group":"acme","collections":[{"name":"../user","file":"collections/../user.bson"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			zw := zip.NewWriter(&buf)
+			if tt.manifest != "" {
+				f, _ := zw.Create("manifest.json")
+				f.Write([]byte(tt.manifest))
+			}
+			zw.Close()
+			if _, err := backup.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestRewriteGroup(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	tests := []struct {
+		name     string
+		doc      bson.M
+		expected string
+	}{
+		{"same group", bson.M{"group": "acme", "createdAt": now}, "other"},
+		{"other group kept", bson.M{"group": "foo"}, "foo"},
+		{"no group", bson.M{"name": "x"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := backup.RewriteGroup(marshal(t, tt.doc), "acme", "other")
+			if err != nil {
+				t.Fatal(err)
+			}
+			group, _ := doc.Lookup("group").StringValueOK()
+			if group != tt.expected {
+				t.Errorf("expected group %q, got %q", tt.expected, group)
+			}
+			if createdAt, ok := tt.doc["createdAt"]; ok && !doc.Lookup("createdAt").Time().Equal(createdAt.(time.Time)) {
+				t.Error("other fields must be kept")
+			}
+		})
+	}
+}
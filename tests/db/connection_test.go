@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nbittich/wtm/services/db"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{5, 16 * time.Second},
+		{6, 30 * time.Second},
+		{100, 30 * time.Second},
+	}
+	for _, test := range tests {
+		if got := db.Backoff(test.attempt, 30*time.Second); got != test.expected {
+			t.Errorf("attempt %d: expected %s, got %s", test.attempt, test.expected, got)
+		}
+	}
+}
+
+// nothing listens on the port, every attempt fails
+var unreachable = db.Config{
+	URI:             "mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=100",
+	AdminDBName:     "wtm",
+	ConnectTimeout:  200 * time.Millisecond,
+	ConnectAttempts: 3,
+	MaxBackoff:      10 * time.Millisecond,
+}
+
+func TestConnectGivesUp(t *testing.T) {
+	start := time.Now()
+	if _, err := db.Connect(context.Background(), unreachable); err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected to give up after 3 attempts, took %s", elapsed)
+	}
+}
+
+func TestConnectStopsWithContext(t *testing.T) {
+	cfg := unreachable
+	cfg.ConnectAttempts = 1000
+	cfg.MaxBackoff = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := db.Connect(ctx, cfg); err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected to stop with the context, took %s", elapsed)
+	}
+}
@@ -0,0 +1,77 @@
+package fairness
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nbittich/wtm/services/fairness"
+	"github.com/nbittich/wtm/types"
+)
+
+func at(day int, hour int) time.Time {
+	return time.Date(2024, time.November, day, hour, 0, 0, 0, time.UTC)
+}
+
+func TestClassify(t *testing.T) {
+	rules := types.DefaultPayrollRules()
+	rules.PublicHolidays = []string{"11/11/2024"}
+	tests := []struct {
+		label     string
+		start     time.Time
+		end       time.Time
+		unpopular bool
+		expected  []types.ShiftKind
+	}{
+		{"Monday November 4th, 06:00h->14:00h", at(4, 6), at(4, 14), false, []types.ShiftKind{}},
+		{"Monday November 4th, 14:00h->22:30h", at(4, 14), at(4, 22).Add(30 * time.Minute), false, []types.ShiftKind{}},
+		{"Monday November 4th, 22:00h->06:00h next day", at(4, 22), at(5, 6), false, []types.ShiftKind{types.NightShift}},
+		{"Saturday November 9th, 06:00h->14:00h", at(9, 6), at(9, 14), true, []types.ShiftKind{types.WeekendShift, types.UnpopularShift}},
+		{"Monday November 11th, 06:00h->14:00h", at(11, 6), at(11, 14), false, []types.ShiftKind{types.HolidayShift}},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			kinds := fairness.Classify(rules, test.start, test.end, test.unpopular)
+			if !slices.Equal(kinds, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, kinds)
+			}
+		})
+	}
+}
+
+func TestPickBalancesPenalizedShifts(t *testing.T) {
+	tracker := fairness.NewTracker(types.DefaultPayrollRules(), types.DefaultFairnessWeights())
+	// john already did two weekends
+	tracker.Add(fairness.AssignedShift{EmployeeID: "john", Start: at(2, 6), End: at(2, 14)})
+	tracker.Add(fairness.AssignedShift{EmployeeID: "john", Start: at(3, 6), End: at(3, 14)})
+
+	candidates := []string{"john", "jane", "jack"}
+	picked := make([]string, 0, 4)
+	for _, day := range []int{9, 10, 16, 17} {
+		picked = append(picked, tracker.Pick(candidates, 1, at(day, 6), at(day, 14), false)...)
+	}
+	if expected := []string{"jane", "jack", "jane", "jack"}; !slices.Equal(picked, expected) {
+		t.Errorf("expected %v, got %v", expected, picked)
+	}
+	// weekdays go to whoever has the fewest shifts
+	if picked := tracker.Pick(candidates, 2, at(18, 6), at(18, 14), false); !slices.Equal(picked, []string{"john", "jane"}) {
+		t.Errorf("unexpected weekday pick %v", picked)
+	}
+
+	report := tracker.Report(at(1, 0), at(30, 0), []types.User{{ID: "john", Username: "john"}, {ID: "jane", Username: "jane"}, {ID: "jack", Username: "jack"}})
+	if report.Index[types.WeekendShift] != 1 {
+		t.Errorf("weekends should be evenly spread, got %v", report.Index)
+	}
+	if report.Index[types.NightShift] != 1 {
+		t.Errorf("nobody worked at night, got %v", report.Index)
+	}
+}
+
+func TestJainIndex(t *testing.T) {
+	if index := fairness.JainIndex([]float64{4, 0, 0, 0}); index != 0.25 {
+		t.Errorf("expected 0.25, got %f", index)
+	}
+	if index := fairness.JainIndex([]float64{2, 2, 2}); index != 1 {
+		t.Errorf("expected 1, got %f", index)
+	}
+}
@@ -0,0 +1,103 @@
+package index
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nbittich/wtm/services/db/index"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestName(t *testing.T) {
+	if name := (index.Spec{Keys: index.Ascending("employeeId", "cancelled")}).Name(); name != "employeeId_1_cancelled_1" {
+		t.Errorf("unexpected name %s", name)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	ttl := time.Hour
+	seconds := int32(3600)
+	otherSeconds := int32(60)
+	email := index.Spec{Keys: index.Ascending("email"), Unique: true}
+	expiry := index.Spec{Keys: index.Ascending("expiresAt"), ExpireAfter: &ttl}
+	id := index.Existing{Name: "_id_", Keys: bson.D{{Key: "_id", Value: int32(1)}}}
+	tests := []struct {
+		name     string
+		existing []index.Existing
+		missing  int
+		drift    int
+	}{
+		{"nothing exists", []index.Existing{id}, 2, 0},
+		{"up to date", []index.Existing{
+			id,
+			{Name: "email_1", Keys: bson.D{{Key: "email", Value: int32(1)}}, Unique: true},
+			{Name: "expiresAt_1", Keys: bson.D{{Key: "expiresAt", Value: int32(1)}}, ExpireAfter: &seconds},
+		}, 0, 0},
+		{"not unique", []index.Existing{
+			{Name: "email_1", Keys: bson.D{{Key: "email", Value: int32(1)}}},
+		}, 1, 1},
+		{"other ttl", []index.Existing{
+			{Name: "expiresAt_1", Keys: bson.D{{Key: "expiresAt", Value: int32(1)}}, ExpireAfter: &otherSeconds},
+		}, 1, 1},
+		{"undeclared", []index.Existing{
+			{Name: "username_1", Keys: bson.D{{Key: "username", Value: int32(1)}}},
+		}, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing, drift := index.Diff([]index.Spec{email, expiry}, tt.existing)
+			if len(missing) != tt.missing {
+				t.Errorf("expected %d missing, got %v", tt.missing, missing)
+			}
+			if len(drift) != tt.drift {
+				t.Errorf("expected %d drift, got %v", tt.drift, drift)
+			}
+		})
+	}
+}
+
+func TestDiffPartialFilter(t *testing.T) {
+	open := index.Spec{Keys: index.Ascending("employeeId"), Unique: true, PartialFilter: bson.D{{Key: "out", Value: nil}}}
+	tests := []struct {
+		name     string
+		existing index.Existing
+		drift    int
+	}{
+		{"same filter", index.Existing{Name: "employeeId_1", Keys: bson.D{{Key: "employeeId", Value: int32(1)}}, Unique: true, PartialFilter: bson.D{{Key: "out", Value: nil}}}, 0},
+		{"no filter", index.Existing{Name: "employeeId_1", Keys: bson.D{{Key: "employeeId", Value: int32(1)}}, Unique: true}, 1},
+		{"other filter", index.Existing{Name: "employeeId_1", Keys: bson.D{{Key: "employeeId", Value: int32(1)}}, Unique: true, PartialFilter: bson.D{{Key: "in", Value: nil}}}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing, drift := index.Diff([]index.Spec{open}, []index.Existing{tt.existing})
+			if len(missing) != 0 {
+				t.Errorf("expected nothing missing, got %v", missing)
+			}
+			if len(drift) != tt.drift {
+				t.Errorf("expected %d drift, got %v", tt.drift, drift)
+			}
+		})
+	}
+}
+
+// the indexes are read back from mongo as raw documents
+func TestExistingDecoding(t *testing.T) {
+	raw, err := bson.Marshal(bson.D{
+		{Key: "v", Value: int32(2)},
+		{Key: "key", Value: bson.D{{Key: "employeeId", Value: int32(1)}}},
+		{Key: "name", Value: "employeeId_1"},
+		{Key: "unique", Value: true},
+		{Key: "partialFilterExpression", Value: bson.D{{Key: "out", Value: nil}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var existing index.Existing
+	if err = bson.Unmarshal(raw, &existing); err != nil {
+		t.Fatal(err)
+	}
+	open := index.Spec{Keys: index.Ascending("employeeId"), Unique: true, PartialFilter: bson.D{{Key: "out", Value: nil}}}
+	if missing, drift := index.Diff([]index.Spec{open}, []index.Existing{existing}); len(missing) != 0 || len(drift) != 0 {
+		t.Errorf("expected the decoded index to match its declaration, got missing %v and drift %v", missing, drift)
+	}
+}
@@ -0,0 +1,117 @@
+package jwks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nbittich/wtm/services/jwks"
+)
+
+func newKey(t *testing.T, kid string, alg string) *jwks.Key {
+	signer, err := jwks.GenerateKey(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwks.NewKey(kid, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func claims() jwt.Claims {
+	return jwt.RegisteredClaims{Subject: "john", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}
+}
+
+func TestRotation(t *testing.T) {
+	old := newKey(t, "20240101T000000-aaaa", jwks.RS256)
+	oldSet, err := jwks.NewKeySet([]*jwks.Key{old}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedBefore, err := oldSet.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rotation: a newer key is added, it signs from now on and the old one still verifies
+	current := newKey(t, "20240201T000000-bbbb", jwks.EdDSA)
+	ks, err := jwks.NewKeySet([]*jwks.Key{old, current}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedAfter, err := ks.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for label, signed := range map[string]string{"before rotation": signedBefore, "after rotation": signedAfter} {
+		if _, err := jwt.Parse(signed, ks.Keyfunc); err != nil {
+			t.Errorf("%s: %v", label, err)
+		}
+	}
+	token, _, _ := jwt.NewParser().ParseUnverified(signedAfter, jwt.MapClaims{})
+	if token.Header["kid"] != current.ID || token.Method.Alg() != jwks.EdDSA {
+		t.Errorf("expected newest key to sign, got %v", token.Header)
+	}
+
+	// once removed, the old key doesn't verify anymore
+	newSet, _ := jwks.NewKeySet([]*jwks.Key{current}, "")
+	if _, err := jwt.Parse(signedBefore, newSet.Keyfunc); err == nil {
+		t.Errorf("token of a removed key should be refused")
+	}
+}
+
+func TestKeyfuncRefusesAlgorithmMismatch(t *testing.T) {
+	key := newKey(t, "k1", jwks.RS256)
+	ks, _ := jwks.NewKeySet([]*jwks.Key{key}, "k1")
+	// same kid, but HS256 with the public key as secret
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	token.Header["kid"] = "k1"
+	signed, _ := token.SignedString([]byte("secret"))
+	if _, err := jwt.Parse(signed, ks.Keyfunc); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey := newKey(t, "a", jwks.RS256)
+	edKey := newKey(t, "b", jwks.EdDSA)
+	ks, _ := jwks.NewKeySet([]*jwks.Key{rsaKey, edKey}, "a")
+	set := ks.JWKS()
+	if len(set.Keys) != 2 || set.Keys[0].Kid != "a" || set.Keys[1].Kid != "b" {
+		t.Fatalf("unexpected keys %+v", set.Keys)
+	}
+	if set.Keys[0].Kty != "RSA" || set.Keys[0].N == "" || set.Keys[0].E != "AQAB" {
+		t.Errorf("unexpected rsa key %+v", set.Keys[0])
+	}
+	if set.Keys[1].Kty != "OKP" || set.Keys[1].Crv != "Ed25519" || set.Keys[1].X == "" || set.Keys[1].Alg != jwks.EdDSA {
+		t.Errorf("unexpected ed25519 key %+v", set.Keys[1])
+	}
+}
+
+func TestLoadDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for kid, alg := range map[string]string{"20240101T000000-aaaa": jwks.RS256, "20240201T000000-bbbb": jwks.EdDSA} {
+		signer, _ := jwks.GenerateKey(alg)
+		content, err := jwks.EncodePEM(signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(filepath.Join(dir, kid+".pem"), content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ks, err := jwks.LoadDirectory(dir, "20240101T000000-aaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set := ks.JWKS(); len(set.Keys) != 2 || set.Keys[0].Kid != "20240101T000000-aaaa" {
+		t.Errorf("pinned key should be active, got %+v", set.Keys)
+	}
+	if _, err = jwks.LoadDirectory(dir, "unknown"); err == nil {
+		t.Errorf("expected an error for an unknown active kid")
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nbittich/wtm/middleware"
+)
+
+func TestRateLimitKey(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies string
+		remoteAddr     string
+		forwardedFor   string
+		realIP         string
+		expected       string
+	}{
+		{"direct", "", "203.0.113.7:4242", "", "", "login:203.0.113.7"},
+		{"spoofed forwarded for", "", "203.0.113.7:4242", "198.51.100.1", "", "login:203.0.113.7"},
+		{"spoofed real ip", "", "203.0.113.7:4242", "", "198.51.100.1", "login:203.0.113.7"},
+		{"behind a trusted proxy", "10.0.0.0/8", "10.0.0.2:4242", "203.0.113.7", "", "login:203.0.113.7"},
+		{"spoofed behind a trusted proxy", "10.0.0.0/8", "10.0.0.2:4242", "198.51.100.1, 203.0.113.7", "", "login:203.0.113.7"},
+		{"untrusted proxy", "10.0.0.0/8", "192.168.1.2:4242", "203.0.113.7", "", "login:192.168.1.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extractor, err := middleware.IPExtractor(tt.trustedProxies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := echo.New()
+			e.IPExtractor = extractor
+			req := httptest.NewRequest("POST", "/login", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				req.Header.Set(echo.HeaderXForwardedFor, tt.forwardedFor)
+			}
+			if tt.realIP != "" {
+				req.Header.Set(echo.HeaderXRealIP, tt.realIP)
+			}
+			c := e.NewContext(req, httptest.NewRecorder())
+			if got := middleware.RateLimitKey(c, "login"); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIPExtractorInvalidProxy(t *testing.T) {
+	if _, err := middleware.IPExtractor("10.0.0.0/8, not a cidr"); err == nil {
+		t.Error("expected an error")
+	}
+}
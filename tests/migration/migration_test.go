@@ -0,0 +1,120 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nbittich/wtm/services/migration"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func up(context.Context, *mongo.Database) error { return nil }
+
+var migrations = []migration.Migration{
+	{Version: 1, Name: "first", Scope: migration.Group, Revision: "1", Up: up},
+	{Version: 2, Name: "second", Scope: migration.Admin, Revision: "1", Up: up},
+	{Version: 3, Name: "third", Scope: migration.Group, Revision: "1", Up: up},
+}
+
+func applied(ms ...migration.Migration) []migration.Record {
+	records := make([]migration.Record, 0, len(ms))
+	for _, m := range ms {
+		records = append(records, migration.Record{Version: m.Version, Name: m.Name, Scope: m.Scope, Checksum: m.Checksum()})
+	}
+	return records
+}
+
+func TestPlan(t *testing.T) {
+	renamed := migrations[0]
+	renamed.Name = "renamed"
+	revised := migrations[0]
+	revised.Revision = "2"
+	tests := []struct {
+		name     string
+		applied  []migration.Record
+		expected []int
+		wantErr  bool
+	}{
+		{"nothing applied", nil, []int{1, 3}, false},
+		{"partially applied", applied(migrations[0]), []int{3}, false},
+		{"all applied", applied(migrations...), []int{}, false},
+		{"other scope applied", applied(migrations[1]), []int{1, 3}, false},
+		{"changed after applied", applied(renamed), nil, true},
+		{"revised after applied", applied(revised), nil, true},
+		{"unknown applied", []migration.Record{{Version: 42, Name: "gone", Scope: migration.Group}}, nil, true},
+		{"unknown applied of the other scope", []migration.Record{{Version: 42, Name: "gone", Scope: migration.Admin}}, []int{1, 3}, false},
+		{"pending older than applied", applied(migrations[2]), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pending, err := migration.Plan(migration.Group, migrations, tt.applied)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pending) != len(tt.expected) {
+				t.Fatalf("expected %v, got %d pending", tt.expected, len(pending))
+			}
+			for i, m := range pending {
+				if m.Version != tt.expected[i] {
+					t.Errorf("expected version %d at %d, got %d", tt.expected[i], i, m.Version)
+				}
+			}
+		})
+	}
+}
+
+// records of both scopes may share the collection of a database migrated as admin and as group:
+// each run must only see its own records, and a second run must find nothing to do
+func TestPlanBothScopesOnOneDatabase(t *testing.T) {
+	var records []migration.Record
+	for run := 1; run <= 2; run++ {
+		for _, scope := range []migration.Scope{migration.Admin, migration.Group} {
+			pending, err := migration.Plan(scope, migrations, records)
+			if err != nil {
+				t.Fatalf("run %d, scope %s: %v", run, scope, err)
+			}
+			expected := len(migration.ForScope(migrations, scope))
+			if run == 2 {
+				expected = 0
+			}
+			if len(pending) != expected {
+				t.Errorf("run %d, scope %s: expected %d pending, got %d", run, scope, expected, len(pending))
+			}
+			records = append(records, applied(pending...)...)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		migrations []migration.Migration
+	}{
+		{"not increasing", []migration.Migration{{Version: 2, Name: "a", Scope: migration.Group, Revision: "1", Up: up}, {Version: 1, Name: "b", Scope: migration.Group, Revision: "1", Up: up}}},
+		{"duplicate", []migration.Migration{{Version: 1, Name: "a", Scope: migration.Group, Revision: "1", Up: up}, {Version: 1, Name: "b", Scope: migration.Group, Revision: "1", Up: up}}},
+		{"zero version", []migration.Migration{{Version: 0, Name: "a", Scope: migration.Group, Revision: "1", Up: up}}},
+		{"missing up", []migration.Migration{{Version: 1, Name: "a", Scope: migration.Group, Revision: "1"}}},
+		{"missing revision", []migration.Migration{{Version: 1, Name: "a", Scope: migration.Group, Up: up}}},
+		{"unknown scope", []migration.Migration{{Version: 1, Name: "a", Scope: "x", Revision: "1", Up: up}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := migration.Validate(tt.migrations); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestForScope(t *testing.T) {
+	group := migration.ForScope(migrations, migration.Group)
+	if len(group) != 2 || group[0].Version != 1 || group[1].Version != 3 {
+		t.Errorf("unexpected group migrations %v", group)
+	}
+}
@@ -0,0 +1,237 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nbittich/wtm/services/oidc"
+)
+
+const (
+	clientID     = "wtm"
+	clientSecret = "s3cr3t"
+	redirectURL  = "http://localhost:8080/users/sso/acme/callback"
+)
+
+// fakeIdP is a minimal authorization code provider: /authorize immediately redirects back with a
+// code remembering the nonce, /token signs an id token for it.
+type fakeIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	nonces map[string]string
+	// overrides applied to the id token claims
+	audience string
+	expired  bool
+	amr      []string
+	// how many times the metadata was fetched
+	discoveries int
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{key: key, nonces: map[string]string{}, audience: clientID}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		idp.discoveries++
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kid": "k1",
+			"kty": "RSA",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		code := "code-" + q.Get("state")
+		idp.nonces[code] = q.Get("nonce")
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code="+url.QueryEscape(code)+"&state="+url.QueryEscape(q.Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != clientID || secret != clientSecret {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		nonce, ok := idp.nonces[r.FormValue("code")]
+		if !ok || r.FormValue("redirect_uri") != redirectURL {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		delete(idp.nonces, r.FormValue("code"))
+		exp := time.Now().Add(time.Hour)
+		if idp.expired {
+			exp = time.Now().Add(-time.Hour)
+		}
+		claims := jwt.MapClaims{
+			"iss":            idp.server.URL,
+			"aud":            idp.audience,
+			"sub":            "user-42",
+			"email":          "john@example.com",
+			"email_verified": true,
+			"nonce":          nonce,
+			"exp":            exp.Unix(),
+			"iat":            time.Now().Unix(),
+		}
+		if idp.amr != nil {
+			claims["amr"] = idp.amr
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": signed})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize follows the login redirect like a browser would and returns the code and state.
+func authorize(t *testing.T, authURL string) (string, string) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	tests := []struct {
+		label       string
+		audience    string
+		expired     bool
+		nonce       string
+		expectedErr bool
+	}{
+		{label: "valid login", audience: clientID, nonce: "n1"},
+		{label: "token for another client", audience: "other", nonce: "n1", expectedErr: true},
+		{label: "expired token", audience: clientID, expired: true, nonce: "n1", expectedErr: true},
+		{label: "nonce mismatch", audience: clientID, nonce: "other", expectedErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			idp := newFakeIdP(t)
+			idp.audience = test.audience
+			idp.expired = test.expired
+			ctx := context.Background()
+			provider, err := oidc.Discover(ctx, nil, idp.server.URL, clientID, clientSecret, redirectURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, state := authorize(t, provider.AuthCodeURL("state1", "n1"))
+			if state != "state1" {
+				t.Fatalf("unexpected state %s", state)
+			}
+			idToken, err := provider.Exchange(ctx, code, test.nonce)
+			if test.expectedErr {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if idToken.Subject != "user-42" || idToken.Email != "john@example.com" || !idToken.EmailVerified {
+				t.Errorf("unexpected id token %+v", idToken)
+			}
+		})
+	}
+}
+
+func TestDiscoverUnknownIssuer(t *testing.T) {
+	idp := newFakeIdP(t)
+	if _, err := oidc.Discover(context.Background(), nil, idp.server.URL+"/realms/other", clientID, clientSecret, redirectURL); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestMultiFactor(t *testing.T) {
+	tests := []struct {
+		label    string
+		amr      []string
+		expected bool
+	}{
+		{label: "no amr", amr: nil, expected: false},
+		{label: "password only", amr: []string{"pwd"}, expected: false},
+		{label: "password and otp", amr: []string{"pwd", "otp", "mfa"}, expected: true},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			idp := newFakeIdP(t)
+			idp.amr = test.amr
+			ctx := context.Background()
+			provider, err := oidc.Discover(ctx, nil, idp.server.URL, clientID, clientSecret, redirectURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, _ := authorize(t, provider.AuthCodeURL("state1", "n1"))
+			idToken, err := provider.Exchange(ctx, code, "n1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if idToken.MultiFactor() != test.expected {
+				t.Errorf("expected multi factor %t with amr %v", test.expected, test.amr)
+			}
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	idp := newFakeIdP(t)
+	ctx := context.Background()
+	cache := oidc.NewCache(time.Hour, nil)
+	for _, secret := range []string{clientSecret, "other"} {
+		provider, err := cache.Discover(ctx, idp.server.URL, clientID, secret, redirectURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if provider.ClientSecret != secret || provider.TokenEndpoint != idp.server.URL+"/token" {
+			t.Errorf("unexpected provider %+v", provider)
+		}
+	}
+	if idp.discoveries != 1 {
+		t.Errorf("expected the metadata to be fetched once, got %d", idp.discoveries)
+	}
+
+	expired := oidc.NewCache(0, nil)
+	for range 2 {
+		if _, err := expired.Discover(ctx, idp.server.URL, clientID, clientSecret, redirectURL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if idp.discoveries != 3 {
+		t.Errorf("expected the expired metadata to be fetched again, got %d", idp.discoveries)
+	}
+}
@@ -0,0 +1,93 @@
+package payroll
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nbittich/wtm/services/payroll"
+	"github.com/nbittich/wtm/types"
+)
+
+func TestComputeOvertime(t *testing.T) {
+	shifts := []payroll.WorkedShift{
+		// week 45: 5 x 9h
+		{Start: at(4, 8), End: at(4, 17)},
+		{Start: at(5, 8), End: at(5, 17)},
+		{Start: at(6, 8), End: at(6, 17)},
+		{Start: at(7, 8), End: at(7, 17)},
+		{Start: at(8, 8), End: at(8, 17)},
+		// week 46: 1 x 8h
+		{Start: at(12, 8), End: at(12, 16)},
+	}
+	weeks, months := payroll.ComputeOvertime(38, at(4, 0), at(18, 0), shifts)
+	if len(weeks) != 2 {
+		t.Fatalf("expected 2 weeks, got %v", weeks)
+	}
+	if weeks[0].Worked != 45 || weeks[0].Overtime != 7 || weeks[0].Start != "04/11/2024" || weeks[0].End != "10/11/2024" {
+		t.Errorf("unexpected first week %+v", weeks[0])
+	}
+	if weeks[1].Worked != 8 || weeks[1].Overtime != 0 {
+		t.Errorf("unexpected second week %+v", weeks[1])
+	}
+	if len(months) != 1 || months[0].Overtime != 7 || months[0].Contractual != 76 || months[0].Start != "01/11/2024" {
+		t.Errorf("unexpected months %+v", months)
+	}
+
+	weeks, _ = payroll.ComputeOvertime(0, at(4, 0), at(11, 0), shifts)
+	if len(weeks) != 1 || weeks[0].Overtime != 0 {
+		t.Errorf("no contract should not yield overtime %+v", weeks)
+	}
+}
+
+func TestComputeTimeInLieu(t *testing.T) {
+	worked := []payroll.WorkedShift{
+		{Start: at(4, 8), End: at(4, 18)},
+		{Start: at(5, 8), End: at(5, 18)},
+		{Start: at(6, 8), End: at(6, 18)},
+		{Start: at(7, 8), End: at(7, 18)},
+		// current week, not completed yet
+		{Start: at(11, 8), End: at(11, 20)},
+		{Start: at(12, 8), End: at(12, 20)},
+		{Start: at(13, 8), End: at(13, 20)},
+		{Start: at(14, 8), End: at(14, 20)},
+	}
+	taken := []payroll.WorkedShift{
+		{Start: at(8, 8), End: at(8, 11)},
+		// in the future
+		{Start: at(22, 8), End: at(22, 16)},
+	}
+	adjustments := []types.TimeInLieuAdjustment{{Hours: -0.5, Reason: "paid out"}}
+	now := time.Date(2024, time.November, 15, 12, 0, 0, 0, time.UTC)
+
+	balance := payroll.ComputeTimeInLieu(38, worked, taken, adjustments, now)
+	expected := types.TimeInLieuBalance{Earned: 2, Taken: 3, Adjusted: -0.5, Balance: -1.5}
+	if balance != expected {
+		t.Errorf("expected %+v, got %+v", expected, balance)
+	}
+}
+
+func TestPreferPunches(t *testing.T) {
+	assigned := []payroll.WorkedShift{
+		{EmployeeID: "a", Start: at(4, 8), End: at(4, 16)},
+		{EmployeeID: "a", Start: at(5, 8), End: at(5, 16)},
+		{EmployeeID: "b", Start: at(4, 8), End: at(4, 16)},
+	}
+	punched := []payroll.WorkedShift{
+		{EmployeeID: "a", Start: at(4, 7), End: at(4, 12)},
+		{EmployeeID: "a", Start: at(4, 13), End: at(4, 18)},
+		// punched without being assigned
+		{EmployeeID: "b", Start: at(6, 9), End: at(6, 11)},
+	}
+	shifts := payroll.PreferPunches(assigned, punched)
+	expected := []payroll.WorkedShift{
+		{EmployeeID: "a", Start: at(4, 7), End: at(4, 12)},
+		{EmployeeID: "b", Start: at(4, 8), End: at(4, 16)},
+		{EmployeeID: "a", Start: at(4, 13), End: at(4, 18)},
+		{EmployeeID: "a", Start: at(5, 8), End: at(5, 16)},
+		{EmployeeID: "b", Start: at(6, 9), End: at(6, 11)},
+	}
+	if !slices.Equal(shifts, expected) {
+		t.Errorf("expected %+v, got %+v", expected, shifts)
+	}
+}
@@ -0,0 +1,115 @@
+package payroll
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbittich/wtm/services/payroll"
+	"github.com/nbittich/wtm/types"
+)
+
+func at(day int, hour int) time.Time {
+	return time.Date(2024, time.November, day, hour, 0, 0, 0, time.UTC)
+}
+
+func TestComputeHours(t *testing.T) {
+	from, to := at(1, 0), at(30, 0)
+	tests := []struct {
+		label    string
+		rules    types.PayrollRules
+		shifts   []payroll.WorkedShift
+		expected map[types.HourCategory]float64
+	}{
+		{
+			label:    "Monday November 4th, 06:00h->14:00h",
+			rules:    types.DefaultPayrollRules(),
+			shifts:   []payroll.WorkedShift{{Start: at(4, 6), End: at(4, 14)}},
+			expected: map[types.HourCategory]float64{types.NormalHours: 8},
+		},
+		{
+			label:    "Monday November 4th, 20:00h->04:00h next day",
+			rules:    types.DefaultPayrollRules(),
+			shifts:   []payroll.WorkedShift{{Start: at(4, 20), End: at(5, 4)}},
+			expected: map[types.HourCategory]float64{types.NormalHours: 2, types.NightHours: 6},
+		},
+		{
+			label:    "Saturday November 9th, 20:00h->04:00h on sunday",
+			rules:    types.DefaultPayrollRules(),
+			shifts:   []payroll.WorkedShift{{Start: at(9, 20), End: at(10, 4)}},
+			expected: map[types.HourCategory]float64{types.NormalHours: 2, types.NightHours: 2, types.SundayHours: 4},
+		},
+		{
+			label: "Monday November 11th is a public holiday",
+			rules: types.PayrollRules{PublicHolidays: []string{"11/11/2024"}},
+			shifts: []payroll.WorkedShift{
+				{Start: at(11, 6), End: at(11, 14)},
+				{Start: at(12, 6), End: at(12, 14)},
+			},
+			expected: map[types.HourCategory]float64{types.NormalHours: 8, types.PublicHolidayHours: 8},
+		},
+		{
+			label: "five 9h days with 8h daily and 38h weekly thresholds",
+			rules: types.PayrollRules{DailyOvertimeAfter: 8, WeeklyOvertimeAfter: 38},
+			shifts: []payroll.WorkedShift{
+				{Start: at(4, 8), End: at(4, 17)},
+				{Start: at(5, 8), End: at(5, 17)},
+				{Start: at(6, 8), End: at(6, 17)},
+				{Start: at(7, 8), End: at(7, 17)},
+				{Start: at(8, 8), End: at(8, 17)},
+			},
+			// 4 x (8 + 1), then 38 - 32 = 6 normal and 3 overtime on friday
+			expected: map[types.HourCategory]float64{types.NormalHours: 38, types.OvertimeHours: 7},
+		},
+		{
+			label:    "shift starting outside the period is ignored",
+			rules:    types.DefaultPayrollRules(),
+			shifts:   []payroll.WorkedShift{{Start: at(30, 6), End: at(30, 14)}},
+			expected: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			for i := range test.shifts {
+				test.shifts[i].EmployeeID = "u1"
+			}
+			hours := payroll.ComputeHours(test.rules, from, to, test.shifts)["u1"]
+			if test.expected == nil {
+				if hours != nil {
+					t.Fatalf("expected no hours, got %v", hours)
+				}
+				return
+			}
+			for _, c := range types.HourCategories {
+				if hours[c] != test.expected[c] {
+					t.Errorf("%s: expected %.2f, got %.2f (%v)", c, test.expected[c], hours[c], hours)
+				}
+			}
+		})
+	}
+}
+
+func TestCSVFormatter(t *testing.T) {
+	users := []types.User{{ID: "u1", Username: "john", Profile: types.UserProfile{FirstName: "John", LastName: "Doe"}}}
+	hours := map[string]map[types.HourCategory]float64{
+		"u1": {types.NormalHours: 7.5, types.NightHours: 0.5},
+	}
+	report := payroll.NewReport(at(1, 0), at(8, 0), hours, users)
+	formatter, err := payroll.GetFormatter("CSV")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = formatter.Format(&buf, report); err != nil {
+		t.Fatal(err)
+	}
+	expected := "employeeId,username,firstName,lastName,from,to,normal,overtime,night,sunday,public_holiday,total\n" +
+		"u1,john,John,Doe,01/11/2024,07/11/2024,7.50,0.00,0.50,0.00,0.00,8.00\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected csv:\n%s", buf.String())
+	}
+	if _, err = payroll.GetFormatter("unknown"); err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Errorf("expected an unknown format error")
+	}
+}
@@ -0,0 +1,119 @@
+package pdf
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/nbittich/wtm/services/pdf"
+	"github.com/nbittich/wtm/types"
+)
+
+func TestPeriodBounds(t *testing.T) {
+	tests := []struct {
+		label        string
+		period       pdf.RosterPeriod
+		date         time.Time
+		expectedFrom time.Time
+		expectedTo   time.Time
+	}{
+		{
+			label:        "week of Wednesday November 6th",
+			period:       pdf.Weekly,
+			date:         time.Date(2024, time.November, 6, 15, 0, 0, 0, time.UTC),
+			expectedFrom: time.Date(2024, time.November, 4, 0, 0, 0, 0, time.UTC),
+			expectedTo:   time.Date(2024, time.November, 11, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			label:        "week of Sunday November 10th",
+			period:       pdf.Weekly,
+			date:         time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC),
+			expectedFrom: time.Date(2024, time.November, 4, 0, 0, 0, 0, time.UTC),
+			expectedTo:   time.Date(2024, time.November, 11, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			label:        "month of November",
+			period:       pdf.Monthly,
+			date:         time.Date(2024, time.November, 18, 0, 0, 0, 0, time.UTC),
+			expectedFrom: time.Date(2024, time.November, 1, 0, 0, 0, 0, time.UTC),
+			expectedTo:   time.Date(2024, time.December, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			from, to, err := pdf.PeriodBounds(test.period, test.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !from.Equal(test.expectedFrom) || !to.Equal(test.expectedTo) {
+				t.Errorf("expected %s -> %s, got %s -> %s", test.expectedFrom, test.expectedTo, from, to)
+			}
+		})
+	}
+}
+
+func TestBuildRoster(t *testing.T) {
+	projects := []types.Project{{ID: "p1", Name: "Site A", Type: types.Work}}
+	users := []types.User{
+		{ID: "u1", Username: "john", Profile: types.UserProfile{FirstName: "John", LastName: "Doe"}},
+		{ID: "u2", Username: "jane"},
+	}
+	entries := []types.PlanningEntry{
+		{ID: "e1", ProjectID: "p1", Start: "04/11/2024 06:00", End: "04/11/2024 14:00", EmployeeIDs: []string{"u1", "u2"}},
+		{ID: "e2", ProjectID: "p1", Start: "12/11/2024 22:00", End: "13/11/2024 06:00", EmployeeIDs: []string{"u2"}},
+		{ID: "e3", ProjectID: "p1", Start: "05/11/2024 06:00", End: "05/11/2024 14:00"},
+		{ID: "e4", ProjectID: "p2", Start: "05/11/2024 06:00", End: "05/11/2024 14:00", EmployeeIDs: []string{"u1"}},
+	}
+	opts := pdf.RosterOptions{
+		OrganizationName: "ACME",
+		Period:           pdf.Weekly,
+		Date:             time.Date(2024, time.November, 6, 0, 0, 0, 0, time.UTC),
+		Labels: pdf.RosterLabels{
+			Days:       [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+			Unassigned: "Unassigned",
+		},
+	}
+
+	roster, err := pdf.BuildRoster(opts, projects, entries, users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roster.Pages) != 1 {
+		t.Fatalf("expected 1 page, got %d", len(roster.Pages))
+	}
+	page := roster.Pages[0]
+	if page.DayHeaders[0] != "Mon 04/11" || len(page.Days) != 7 {
+		t.Errorf("unexpected day headers %v", page.DayHeaders)
+	}
+	expectedRows := []string{"John Doe", "Unassigned", "jane"}
+	if len(page.Rows) != len(expectedRows) {
+		t.Fatalf("expected rows %v, got %v", expectedRows, page.Rows)
+	}
+	for i, row := range page.Rows {
+		if row.Label != expectedRows[i] {
+			t.Errorf("expected row %s, got %s", expectedRows[i], row.Label)
+		}
+	}
+	if cell := page.Rows[0].Cells[0]; len(cell) != 1 || cell[0] != "06:00-14:00" {
+		t.Errorf("unexpected cell %v", cell)
+	}
+
+	opts.Period = pdf.Monthly
+	opts.Grouping = pdf.ByEmployee
+	roster, err = pdf.BuildRoster(opts, projects, entries, users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2 employees, november 2024 spans 5 weeks
+	if len(roster.Pages) != 10 {
+		t.Fatalf("expected 10 pages, got %d", len(roster.Pages))
+	}
+
+	var buf bytes.Buffer
+	if err = roster.Render(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF")) {
+		t.Errorf("output is not a pdf")
+	}
+}
@@ -0,0 +1,335 @@
+package planning
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nbittich/wtm/services/planning"
+	"github.com/nbittich/wtm/services/repository"
+	"github.com/nbittich/wtm/services/repository/memory"
+	"github.com/nbittich/wtm/types"
+)
+
+const group = types.Group("acme")
+
+type fixture struct {
+	repos   repository.Repositories
+	planner *planning.Planner
+	project types.Project
+	users   map[string]types.User
+}
+
+func newFixture(t *testing.T, usernames ...string) *fixture {
+	ctx := context.Background()
+	f := &fixture{repos: memory.New(), users: map[string]types.User{}}
+	f.planner = planning.New(f.repos)
+	f.project = types.Project{Name: "night shifts", Type: types.Work}
+	if err := f.repos.Projects.Save(ctx, group, &f.project); err != nil {
+		t.Fatal(err)
+	}
+	for _, username := range usernames {
+		user := types.User{Username: username, Email: username + "@example.com", Enabled: true, Roles: []types.Role{types.USER}}
+		if err := f.repos.Users.Save(ctx, group, &user); err != nil {
+			t.Fatal(err)
+		}
+		f.users[username] = user
+	}
+	return f
+}
+
+func (f *fixture) ids(usernames ...string) []string {
+	ids := make([]string, 0, len(usernames))
+	for _, username := range usernames {
+		ids = append(ids, f.users[username].ID)
+	}
+	return ids
+}
+
+// assign saves the entry and assigns its employees, like AddOrUpdatePlanningEntry does.
+func (f *fixture) assign(t *testing.T, start string, end string, usernames ...string) (types.PlanningEntry, *planning.AssignmentResult) {
+	ctx := context.Background()
+	entry := types.PlanningEntry{ProjectID: f.project.ID, Start: start, End: end, Title: "shift", EmployeeIDs: f.ids(usernames...), AllowMultipleAssignment: true}
+	if err := f.repos.Planning.Save(ctx, group, &entry); err != nil {
+		t.Fatal(err)
+	}
+	result, err := f.planner.AssignOrUnassign(ctx, entry, f.project, group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.Entry, result
+}
+
+func usernames(users []types.User) []string {
+	names := make([]string, 0, len(users))
+	for _, user := range users {
+		names = append(names, user.Username)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestCheckEntriesValid(t *testing.T) {
+	f := newFixture(t, "john", "jane")
+	f.assign(t, "04/11/2024 06:00", "04/11/2024 14:00", "john")
+	tests := []struct {
+		name      string
+		start     string
+		end       string
+		employees []string
+		valid     bool
+	}{
+		{"overlapping", "04/11/2024 12:00", "04/11/2024 20:00", []string{"john"}, false},
+		{"after", "04/11/2024 14:30", "04/11/2024 22:00", []string{"john"}, true},
+		{"other employee", "04/11/2024 12:00", "04/11/2024 20:00", []string{"jane"}, true},
+		{"one of two overlapping", "04/11/2024 06:00", "04/11/2024 14:00", []string{"jane", "john"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := types.PlanningEntry{ProjectID: f.project.ID, Start: tt.start, End: tt.end, EmployeeIDs: f.ids(tt.employees...)}
+			validity, err := f.planner.CheckEntriesValid(context.Background(), []types.PlanningEntry{entry}, group)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if validity.Valid != tt.valid {
+				t.Errorf("expected valid %t, got %t %v", tt.valid, validity.Valid, validity.Comments)
+			}
+			if !tt.valid && (len(validity.Comments) != 1 || validity.Comments[0].UserID != f.users["john"].ID) {
+				t.Errorf("expected a comment for john, got %v", validity.Comments)
+			}
+		})
+	}
+}
+
+func TestAssignOrUnassign(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, "john", "jane", "bob")
+	entry, result := f.assign(t, "05/11/2024 06:00", "05/11/2024 14:00", "john", "jane")
+	if got := usernames(result.FilteredUsersNewAssign); !slices.Equal(got, []string{"jane", "john"}) {
+		t.Errorf("expected jane and john assigned, got %v", got)
+	}
+
+	// replace jane by bob
+	entry.EmployeeIDs = f.ids("john", "bob")
+	result, err := f.planner.AssignOrUnassign(ctx, entry, f.project, group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(result.FilteredUsersNewAssign); !slices.Equal(got, []string{"bob"}) {
+		t.Errorf("expected bob assigned, got %v", got)
+	}
+	if got := usernames(result.UsersToBeCancelled); !slices.Equal(got, []string{"jane"}) {
+		t.Errorf("expected jane unassigned, got %v", got)
+	}
+	active, err := f.repos.Assignments.Find(ctx, group, repository.AssignmentFilter{EntryID: entry.ID, ActiveOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 2 {
+		t.Errorf("expected 2 active assignments, got %d", len(active))
+	}
+}
+
+func TestAssignOrUnassignRemovesUnavailableEmployees(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, "john", "jane")
+	f.assign(t, "06/11/2024 06:00", "06/11/2024 14:00", "john")
+
+	entry, result := f.assign(t, "06/11/2024 10:00", "06/11/2024 18:00", "john", "jane")
+	if got := usernames(result.FilteredUsersNewAssign); !slices.Equal(got, []string{"jane"}) {
+		t.Errorf("expected only jane assigned, got %v", got)
+	}
+	saved, err := f.repos.Planning.FindByID(ctx, group, entry.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(saved.EmployeeIDs, f.ids("jane")) {
+		t.Errorf("expected john removed from the entry, got %v", saved.EmployeeIDs)
+	}
+	if len(saved.Comments) != 1 || saved.Comments[0].UserID != f.users["john"].ID {
+		t.Errorf("expected a comment about john, got %v", saved.Comments)
+	}
+}
+
+// failingAssignments fails the first SaveMany after having saved the first assignment, like a
+// write interrupted midway.
+type failingAssignments struct {
+	repository.AssignmentRepository
+	failed bool
+}
+
+func (r *failingAssignments) SaveMany(ctx context.Context, group types.Group, assignments []*types.PlanningAssignment) error {
+	if r.failed || len(assignments) < 2 {
+		return r.AssignmentRepository.SaveMany(ctx, group, assignments)
+	}
+	r.failed = true
+	if err := r.AssignmentRepository.SaveMany(ctx, group, assignments[:1]); err != nil {
+		return err
+	}
+	return errors.New("connection reset")
+}
+
+func TestSaveAndAssign(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, "john", "jane")
+	entry := types.PlanningEntry{ProjectID: f.project.ID, Start: "07/11/2024 06:00", End: "07/11/2024 14:00", EmployeeIDs: f.ids("john", "jane"), AllowMultipleAssignment: true}
+	result, err := f.planner.SaveAndAssign(ctx, entry, f.project, group, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Entry.ID == "" {
+		t.Fatal("expected the entry to get an id")
+	}
+	if got := usernames(result.FilteredUsersNewAssign); !slices.Equal(got, []string{"jane", "john"}) {
+		t.Errorf("expected jane and john assigned, got %v", got)
+	}
+	if _, err := f.repos.Planning.FindByID(ctx, group, result.Entry.ID); err != nil {
+		t.Errorf("expected the entry saved, got %v", err)
+	}
+}
+
+func TestSaveAndAssignCompensatesNewEntry(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, "john", "jane")
+	f.repos.Assignments = &failingAssignments{AssignmentRepository: f.repos.Assignments}
+	planner := planning.New(f.repos)
+
+	entry := types.PlanningEntry{ProjectID: f.project.ID, Start: "08/11/2024 06:00", End: "08/11/2024 14:00", EmployeeIDs: f.ids("john", "jane"), AllowMultipleAssignment: true}
+	if _, err := planner.SaveAndAssign(ctx, entry, f.project, group, true); err == nil {
+		t.Fatal("expected an error")
+	}
+	if entries, _ := f.repos.Planning.FindByProject(ctx, group, f.project.ID); len(entries) != 0 {
+		t.Errorf("expected the entry removed, got %v", entries)
+	}
+	if assignments, _ := f.repos.Assignments.Find(ctx, group, repository.AssignmentFilter{}); len(assignments) != 0 {
+		t.Errorf("expected no assignment left, got %v", assignments)
+	}
+}
+
+func TestSaveAndAssignCompensatesUpdate(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, "john", "jane", "bob")
+	entry, _ := f.assign(t, "09/11/2024 06:00", "09/11/2024 14:00", "john")
+	f.repos.Assignments = &failingAssignments{AssignmentRepository: f.repos.Assignments}
+	planner := planning.New(f.repos)
+
+	// john is cancelled and saved first, then the write fails before jane and bob are assigned
+	update := entry
+	update.EmployeeIDs = f.ids("jane", "bob")
+	if _, err := planner.SaveAndAssign(ctx, update, f.project, group, true); err == nil {
+		t.Fatal("expected an error")
+	}
+	saved, err := f.repos.Planning.FindByID(ctx, group, entry.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(saved.EmployeeIDs, f.ids("john")) {
+		t.Errorf("expected the entry put back with john, got %v", saved.EmployeeIDs)
+	}
+	active, err := f.repos.Assignments.Find(ctx, group, repository.AssignmentFilter{EntryID: entry.ID, ActiveOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 1 || active[0].EmployeeID != f.users["john"].ID {
+		t.Errorf("expected john still assigned, got %v", active)
+	}
+}
+
+func TestSaveAndAssignRefusesStaleEntry(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, "john", "jane")
+	entry, _ := f.assign(t, "10/11/2024 06:00", "10/11/2024 14:00", "john")
+
+	// someone else saved the entry meanwhile
+	other := entry
+	other.Title = "early shift"
+	if err := f.repos.Planning.Save(ctx, group, &other); err != nil {
+		t.Fatal(err)
+	}
+
+	entry.EmployeeIDs = f.ids("jane")
+	if _, err := f.planner.SaveAndAssign(ctx, entry, f.project, group, true); !errors.Is(err, repository.ErrConflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	saved, err := f.repos.Planning.FindByID(ctx, group, entry.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Title != "early shift" || !slices.Equal(saved.EmployeeIDs, f.ids("john")) {
+		t.Errorf("expected the other save kept, got %s %v", saved.Title, saved.EmployeeIDs)
+	}
+	if saved.Version != other.Version {
+		t.Errorf("expected version %d, got %d", other.Version, saved.Version)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, "john", "jane")
+	entry, _ := f.assign(t, "11/11/2024 06:00", "11/11/2024 14:00", "john", "jane")
+
+	at := time.Date(2024, 11, 1, 9, 0, 0, 0, time.UTC)
+	result, err := f.planner.Delete(ctx, entry, f.project, group, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(result.UsersToBeCancelled); !slices.Equal(got, []string{"jane", "john"}) {
+		t.Errorf("expected jane and john unassigned, got %v", got)
+	}
+	if result.Entry.DeletedAt == nil || !result.Entry.DeletedAt.Equal(at) {
+		t.Errorf("expected the entry deleted at %s, got %v", at, result.Entry.DeletedAt)
+	}
+	if entries, _ := f.repos.Planning.FindByProject(ctx, group, f.project.ID); len(entries) != 0 {
+		t.Errorf("expected the entry hidden, got %v", entries)
+	}
+	if deleted, _ := f.repos.Planning.FindDeleted(ctx, group, f.project.ID); len(deleted) != 1 {
+		t.Errorf("expected the entry among the deleted ones, got %v", deleted)
+	}
+	if active, _ := f.repos.Assignments.Find(ctx, group, repository.AssignmentFilter{EntryID: entry.ID, ActiveOnly: true}); len(active) != 0 {
+		t.Errorf("expected the assignments cancelled, got %v", active)
+	}
+
+	// john is free again for the same slot
+	_, result = f.assign(t, "11/11/2024 06:00", "11/11/2024 14:00", "john")
+	if got := usernames(result.FilteredUsersNewAssign); !slices.Equal(got, []string{"john"}) {
+		t.Errorf("expected john assigned, got %v", got)
+	}
+}
+
+func TestFindDetailsStartRange(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, "john")
+	f.assign(t, "03/11/2024 22:00", "04/11/2024 06:00", "john")
+	f.assign(t, "06/11/2024 06:00", "06/11/2024 14:00", "john")
+	f.assign(t, "11/11/2024 06:00", "11/11/2024 14:00", "john")
+	from := time.Date(2024, 11, 4, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 11, 11, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		filter   repository.AssignmentFilter
+		expected []string
+	}{
+		{"open range", repository.AssignmentFilter{}, []string{"03/11/2024 22:00", "06/11/2024 06:00", "11/11/2024 06:00"}},
+		{"within the week", repository.AssignmentFilter{StartFrom: from, StartTo: to}, []string{"06/11/2024 06:00"}},
+		{"from only", repository.AssignmentFilter{StartFrom: from}, []string{"06/11/2024 06:00", "11/11/2024 06:00"}},
+		{"to only", repository.AssignmentFilter{StartTo: to}, []string{"03/11/2024 22:00", "06/11/2024 06:00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			details, err := f.repos.Assignments.FindDetails(ctx, group, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			starts := make([]string, 0, len(details))
+			for _, detail := range details {
+				starts = append(starts, detail.Entry.Start)
+			}
+			slices.Sort(starts)
+			if !slices.Equal(starts, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, starts)
+			}
+		})
+	}
+}
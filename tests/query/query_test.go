@@ -0,0 +1,133 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/nbittich/wtm/services/db/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var spec = query.Spec{
+	Sorts:       map[string]string{"name": "projectName", "createdAt": "createdAt"},
+	DefaultSort: "name",
+}
+
+func TestParse(t *testing.T) {
+	kind, value, err := bson.MarshalValue("2024-01-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor, err := query.Cursor{Sort: "-createdAt", Value: bson.RawValue{Type: kind, Value: value}, ID: "42"}.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		sort   string
+		limit  string
+		cursor string
+		field  string
+		desc   bool
+		valid  bool
+	}{
+		{"defaults", "", "", "", "projectName", false, true},
+		{"descending", "-createdAt", "10", "", "createdAt", true, true},
+		{"not whitelisted", "password", "", "", "", false, false},
+		{"limit too small", "", "0", "", "", false, false},
+		{"limit too big", "", "201", "", "", false, false},
+		{"limit not a number", "", "ten", "", "", false, false},
+		{"cursor of the sort", "-createdAt", "", cursor, "createdAt", true, true},
+		{"cursor of another sort", "createdAt", "", cursor, "", false, false},
+		{"garbage cursor", "", "", "not-a-cursor", "", false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := spec.Parse(test.sort, test.limit, test.cursor)
+			if (err == nil) != test.valid {
+				t.Fatalf("expected valid %t, got %v", test.valid, err)
+			}
+			if test.valid && (page.Field != test.field || page.Desc != test.desc) {
+				t.Errorf("expected %s desc %t, got %s desc %t", test.field, test.desc, page.Field, page.Desc)
+			}
+		})
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		valid bool
+	}{
+		{"string", "2024-01-01", true},
+		{"number", int64(42), true},
+		{"boolean", true, true},
+		{"document", bson.M{"$ne": nil}, false},
+		{"array", bson.A{"a", "b"}, false},
+		{"regex", primitive.Regex{Pattern: ".*"}, false},
+		{"javascript", primitive.JavaScript("return true"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kind, value, err := bson.MarshalValue(test.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cursor, err := query.Cursor{Sort: "name", Value: bson.RawValue{Type: kind, Value: value}, ID: "42"}.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = query.DecodeCursor(cursor); (err == nil) != test.valid {
+				t.Errorf("expected valid %t, got %v", test.valid, err)
+			}
+		})
+	}
+}
+
+func docs(t *testing.T, names ...string) []bson.Raw {
+	raws := make([]bson.Raw, 0, len(names))
+	for i, name := range names {
+		raw, err := bson.Marshal(bson.M{"_id": string(rune('a' + i)), "projectName": name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		raws = append(raws, raw)
+	}
+	return raws
+}
+
+func TestNext(t *testing.T) {
+	page, err := spec.Parse("name", "2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last, next, err := page.Next(docs(t, "alpha", "beta"))
+	if err != nil || next != "" || len(last) != 2 {
+		t.Errorf("expected the last page, got %d documents, cursor %q, %v", len(last), next, err)
+	}
+
+	// the third document tells there is a next page
+	kept, next, err := page.Next(docs(t, "alpha", "beta", "gamma"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 2 || next == "" {
+		t.Fatalf("expected 2 documents and a cursor, got %d %q", len(kept), next)
+	}
+	after, err := spec.Parse("name", "2", next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.After.ID != "b" || after.After.Value.StringValue() != "beta" {
+		t.Errorf("expected the cursor after beta, got %s %v", after.After.ID, after.After.Value)
+	}
+	stages := after.Stages()
+	if len(stages) != 3 || stages[0][0].Key != "$match" {
+		t.Errorf("expected a match on the cursor, a sort and a limit, got %v", stages)
+	}
+	if limit := stages[2][0].Value; limit != int64(3) {
+		t.Errorf("expected to fetch one more than the limit, got %v", limit)
+	}
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/types"
+)
+
+func TestParseAPIKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		group types.Group
+		valid bool
+	}{
+		{key: "wtm_acme_s3cr3t", group: "acme", valid: true},
+		{key: "wtm_acme_s3cr3t_with_underscores", group: "acme", valid: true},
+		{key: "eyJhbGciOiJFZERTQSJ9.e30.sig", valid: false},
+		{key: "wtm_acme", valid: false},
+		{key: "wtm__s3cr3t", valid: false},
+		{key: "wtm_acme_", valid: false},
+		{key: "xtm_acme_s3cr3t", valid: false},
+	}
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			group, ok := services.ParseAPIKey(test.key)
+			if ok != test.valid || group != test.group {
+				t.Errorf("expected %q valid %t, got %q valid %t", test.group, test.valid, group, ok)
+			}
+		})
+	}
+}
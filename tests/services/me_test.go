@@ -0,0 +1,46 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMeUpdate(t *testing.T) {
+	firstName, lang := "John", "fr"
+	tests := []struct {
+		label    string
+		form     types.UpdateMeForm
+		expected []string
+	}{
+		{label: "nothing", form: types.UpdateMeForm{}, expected: []string{}},
+		{label: "first name", form: types.UpdateMeForm{FirstName: &firstName}, expected: []string{"profile.firstname"}},
+		{label: "every field", form: types.UpdateMeForm{FirstName: &firstName, LastName: &firstName, Availability: &types.UserNormalAvailability{}, Lang: &lang}, expected: []string{"profile.firstname", "profile.lastname", "profile.availability", "settings.lang"}},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			set := services.MeUpdate(&test.form)
+			if len(set) != len(test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, set)
+			}
+			// the paths must be the ones of the stored user, with the form applied
+			user := types.User{}
+			user.ApplyMeForm(&test.form)
+			raw, err := bson.Marshal(user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, path := range test.expected {
+				if _, ok := set[path]; !ok {
+					t.Errorf("expected %s to be set, got %v", path, set)
+				}
+				if _, err := bson.Raw(raw).LookupErr(strings.Split(path, ".")...); err != nil {
+					t.Errorf("%s is not a field of the user: %v", path, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/services/totp"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// base32 of the RFC 6238 SHA1 test seed "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestSecondFactorUse(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := totp.Step(now)
+	code, err := totp.Code(rfcSecret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("ABCDE12345"))
+	recoveryHash := hex.EncodeToString(sum[:])
+	enabled := func(lastStep uint64) types.User {
+		return types.User{ID: "u1", TOTP: &types.UserTOTP{Secret: rfcSecret, Enabled: true, LastStep: lastStep, RecoveryCodes: []string{recoveryHash}}}
+	}
+	tests := []struct {
+		label          string
+		user           types.User
+		code           string
+		ok             bool
+		expectedFilter bson.M
+		expectedUpdate bson.M
+	}{
+		{
+			label: "totp code", user: enabled(0), code: code, ok: true,
+			expectedFilter: bson.M{"_id": "u1", "totp.enabled": true, "totp.lastStep": bson.M{"$lt": step}},
+			expectedUpdate: bson.M{"$set": bson.M{"totp.lastStep": step}},
+		},
+		{
+			label: "recovery code", user: enabled(0), code: " abcde-12345 ", ok: true,
+			expectedFilter: bson.M{"_id": "u1", "totp.enabled": true, "totp.recoveryCodes": recoveryHash},
+			expectedUpdate: bson.M{"$pull": bson.M{"totp.recoveryCodes": recoveryHash}},
+		},
+		{label: "replayed totp code", user: enabled(step), code: code},
+		{label: "wrong code", user: enabled(0), code: "000000"},
+		{label: "no second factor", user: types.User{ID: "u1"}, code: code},
+		{label: "pending enrollment", user: types.User{ID: "u1", TOTP: &types.UserTOTP{Secret: rfcSecret}}, code: code},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			filter, update, ok := services.SecondFactorUse(&test.user, test.code, now)
+			if ok != test.ok {
+				t.Fatalf("expected ok %t, got %t", test.ok, ok)
+			}
+			if !reflect.DeepEqual(filter, test.expectedFilter) || !reflect.DeepEqual(update, test.expectedUpdate) {
+				t.Errorf("expected %v %v, got %v %v", test.expectedFilter, test.expectedUpdate, filter, update)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nbittich/wtm/services"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestOtherSessionsFilter(t *testing.T) {
+	tests := []struct {
+		label     string
+		userID    string
+		sessionID string
+		expected  bson.M
+	}{
+		{
+			label: "keeps the current session", userID: "u1", sessionID: "s1",
+			expected: bson.M{"userId": "u1", "_id": bson.M{"$ne": "s1"}, "revokedAt": nil},
+		},
+		{
+			// an api key or an old token without session id revokes every session
+			label: "no current session", userID: "u1", sessionID: "",
+			expected: bson.M{"userId": "u1", "_id": bson.M{"$ne": ""}, "revokedAt": nil},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			filter := services.OtherSessionsFilter(test.userID, test.sessionID)
+			if !reflect.DeepEqual(filter, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, filter)
+			}
+		})
+	}
+}
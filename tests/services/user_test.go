@@ -0,0 +1,46 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nbittich/wtm/services"
+	"github.com/nbittich/wtm/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUserSearchMatch(t *testing.T) {
+	yes, no := true, false
+	pattern := primitive.Regex{Pattern: `john\.doe`, Options: "i"}
+	tests := []struct {
+		label    string
+		filter   types.UserFilter
+		expected bson.M
+	}{
+		{label: "all users", filter: types.UserFilter{}, expected: bson.M{}},
+		{label: "blank query", filter: types.UserFilter{Query: "  "}, expected: bson.M{}},
+		{
+			label:  "query is escaped",
+			filter: types.UserFilter{Query: " john.doe "},
+			expected: bson.M{"$or": []bson.M{
+				{"username": pattern},
+				{"email": pattern},
+				{"profile.firstname": pattern},
+				{"profile.lastname": pattern},
+			}},
+		},
+		{label: "role", filter: types.UserFilter{Role: types.ADMIN}, expected: bson.M{"roles": types.ADMIN}},
+		{label: "not activated", filter: types.UserFilter{Enabled: &no}, expected: bson.M{"enabled": false}},
+		{label: "disabled", filter: types.UserFilter{Disabled: &yes}, expected: bson.M{"disabled": true}},
+		{label: "not disabled", filter: types.UserFilter{Disabled: &no}, expected: bson.M{"disabled": bson.M{"$ne": true}}},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			match := services.UserSearchMatch(test.filter)
+			if !reflect.DeepEqual(match, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, match)
+			}
+		})
+	}
+}
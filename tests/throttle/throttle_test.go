@@ -0,0 +1,73 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nbittich/wtm/services/throttle"
+)
+
+var policy = throttle.Policy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     time.Minute,
+	LockAfter:    10,
+	LockDuration: 30 * time.Minute,
+	ResetAfter:   30 * time.Minute,
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{7, 8 * time.Second},
+		{9, 32 * time.Second},
+		{10, time.Minute},
+		{100, time.Minute},
+	}
+	for _, test := range tests {
+		if got := policy.Backoff(test.failures); got != test.expected {
+			t.Errorf("%d failures: expected %s, got %s", test.failures, test.expected, got)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	now := time.Date(2024, time.November, 4, 12, 0, 0, 0, time.UTC)
+	lockedUntil := now.Add(10 * time.Minute)
+	tests := []struct {
+		label          string
+		state          throttle.State
+		expectedWait   time.Duration
+		expectedLocked bool
+	}{
+		{label: "no failure", state: throttle.State{}},
+		{label: "free attempts", state: throttle.State{Failures: 3, LastFailureAt: now}},
+		{label: "back-off", state: throttle.State{Failures: 5, LastFailureAt: now.Add(-time.Second)}, expectedWait: time.Second},
+		{label: "back-off elapsed", state: throttle.State{Failures: 5, LastFailureAt: now.Add(-2 * time.Second)}},
+		{label: "locked", state: throttle.State{Failures: 10, LastFailureAt: now, LockedUntil: &lockedUntil}, expectedWait: 10 * time.Minute, expectedLocked: true},
+		{label: "stale failures", state: throttle.State{Failures: 9, LastFailureAt: now.Add(-time.Hour)}},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			wait, locked := policy.Check(test.state, now)
+			if wait != test.expectedWait || locked != test.expectedLocked {
+				t.Errorf("expected (%s, %v), got (%s, %v)", test.expectedWait, test.expectedLocked, wait, locked)
+			}
+		})
+	}
+}
+
+func TestShouldLock(t *testing.T) {
+	if policy.ShouldLock(9) || !policy.ShouldLock(10) {
+		t.Errorf("should lock from the 10th failure")
+	}
+	if (throttle.Policy{}).ShouldLock(1000) {
+		t.Errorf("a policy without threshold never locks")
+	}
+}
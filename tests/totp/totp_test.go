@@ -0,0 +1,70 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbittich/wtm/services/totp"
+)
+
+// base32 of the RFC 6238 SHA1 test seed "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, last 6 digits
+	tests := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			code, err := totp.Code(rfcSecret, time.Unix(test.unix, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, code)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, _ := totp.Code(rfcSecret, now)
+
+	step, ok := totp.Validate(rfcSecret, code, now, 0)
+	if !ok || step != totp.Step(now) {
+		t.Fatalf("code should be valid")
+	}
+	if _, ok = totp.Validate(rfcSecret, code, now.Add(totp.Period), 0); !ok {
+		t.Errorf("previous code should be accepted within the skew")
+	}
+	if _, ok = totp.Validate(rfcSecret, code, now.Add(3*totp.Period), 0); ok {
+		t.Errorf("code should have expired")
+	}
+	if _, ok = totp.Validate(rfcSecret, code, now, step); ok {
+		t.Errorf("code must not be replayed")
+	}
+	if _, ok = totp.Validate(rfcSecret, "000000", now, 0); ok {
+		t.Errorf("wrong code accepted")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri := totp.ProvisioningURI(secret, "WorkingTimeManagement", "john@example.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/WorkingTimeManagement:john@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("unexpected uri %s", uri)
+	}
+}
@@ -0,0 +1,117 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nbittich/wtm/types"
+)
+
+func TestResetLifecycle(t *testing.T) {
+	now := time.Now()
+	purgeAt := now.Add(time.Hour)
+	tests := []struct {
+		label string
+		org   types.Organization
+	}{
+		{label: "active", org: types.Organization{Status: types.OrganizationActive}},
+		{label: "suspended", org: types.Organization{Status: types.OrganizationSuspended, SuspendedAt: &now}},
+		{label: "deleted", org: types.Organization{Status: types.OrganizationDeleted, SuspendedAt: &now, DeletedAt: &now, PurgeAt: &purgeAt}},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			org := test.org
+			org.ResetLifecycle()
+			if !org.IsActive() || org.SuspendedAt != nil || org.DeletedAt != nil || org.PurgeAt != nil {
+				t.Errorf("expected an active organization, got %+v", org)
+			}
+		})
+	}
+}
+
+func TestOrganizationStatusTransitions(t *testing.T) {
+	now := time.Date(2024, time.November, 4, 12, 0, 0, 0, time.UTC)
+	grace := 30 * 24 * time.Hour
+	suspended := func() types.Organization {
+		org := types.Organization{}
+		org.Suspend(now)
+		return org
+	}
+	deleted := func(org types.Organization) types.Organization {
+		org.Delete(now, grace)
+		return org
+	}
+	tests := []struct {
+		label          string
+		org            types.Organization
+		change         func(*types.Organization) error
+		wantErr        bool
+		expectedStatus types.OrganizationStatus
+	}{
+		{label: "suspend active", org: types.Organization{}, change: func(o *types.Organization) error { return o.Suspend(now) }, expectedStatus: types.OrganizationSuspended},
+		{label: "suspend suspended", org: suspended(), change: func(o *types.Organization) error { return o.Suspend(now) }, wantErr: true},
+		{label: "suspend deleted", org: deleted(types.Organization{}), change: func(o *types.Organization) error { return o.Suspend(now) }, wantErr: true},
+		{label: "reactivate suspended", org: suspended(), change: (*types.Organization).Reactivate, expectedStatus: types.OrganizationActive},
+		{label: "reactivate active", org: types.Organization{Status: types.OrganizationActive}, change: (*types.Organization).Reactivate, wantErr: true},
+		{label: "reactivate deleted", org: deleted(suspended()), change: (*types.Organization).Reactivate, wantErr: true},
+		{label: "delete active", org: types.Organization{}, change: func(o *types.Organization) error { return o.Delete(now, grace) }, expectedStatus: types.OrganizationDeleted},
+		{label: "delete suspended", org: suspended(), change: func(o *types.Organization) error { return o.Delete(now, grace) }, expectedStatus: types.OrganizationDeleted},
+		{label: "delete deleted", org: deleted(types.Organization{}), change: func(o *types.Organization) error { return o.Delete(now, grace) }, wantErr: true},
+		{label: "restore deleted", org: deleted(types.Organization{}), change: func(o *types.Organization) error { return o.Restore(now.Add(grace - time.Second)) }, expectedStatus: types.OrganizationActive},
+		{label: "restore deleted suspended", org: deleted(suspended()), change: func(o *types.Organization) error { return o.Restore(now) }, expectedStatus: types.OrganizationSuspended},
+		{label: "restore after grace", org: deleted(types.Organization{}), change: func(o *types.Organization) error { return o.Restore(now.Add(grace)) }, wantErr: true},
+		{label: "restore active", org: types.Organization{}, change: func(o *types.Organization) error { return o.Restore(now) }, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			org := test.org
+			before := org
+			err := test.change(&org)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", org)
+				}
+				if org.Status != before.Status {
+					t.Errorf("a refused change must not touch the status, got %s", org.Status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if org.Status != test.expectedStatus {
+				t.Errorf("expected %s, got %s", test.expectedStatus, org.Status)
+			}
+			if deleted := org.Status == types.OrganizationDeleted; deleted != (org.DeletedAt != nil) || deleted != (org.PurgeAt != nil) {
+				t.Errorf("deletedAt and purgeAt must be set only while deleted, got %+v", org)
+			}
+			if (org.Status == types.OrganizationSuspended) && org.SuspendedAt == nil {
+				t.Errorf("suspendedAt must be set while suspended, got %+v", org)
+			}
+		})
+	}
+}
+
+func TestPurgeDue(t *testing.T) {
+	now := time.Date(2024, time.November, 4, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Second), now.Add(time.Second)
+	tests := []struct {
+		label    string
+		org      types.Organization
+		expected bool
+	}{
+		{label: "active", org: types.Organization{}, expected: false},
+		{label: "deleted within grace", org: types.Organization{Status: types.OrganizationDeleted, PurgeAt: &future}, expected: false},
+		{label: "deleted at the end of grace", org: types.Organization{Status: types.OrganizationDeleted, PurgeAt: &now}, expected: true},
+		{label: "deleted after grace", org: types.Organization{Status: types.OrganizationDeleted, PurgeAt: &past}, expected: true},
+		{label: "restored with a stale purge date", org: types.Organization{Status: types.OrganizationActive, PurgeAt: &past}, expected: false},
+		{label: "deleted without purge date", org: types.Organization{Status: types.OrganizationDeleted}, expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			if test.org.PurgeDue(now) != test.expected {
+				t.Errorf("expected purge due %t for %+v", test.expected, test.org)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"slices"
 	"testing"
 	"time"
 
@@ -117,3 +118,235 @@ func TestIsAvailable(t *testing.T) {
 		})
 	}
 }
+
+func TestSetEnabled(t *testing.T) {
+	tests := []struct {
+		label     string
+		user      types.User
+		enabled   bool
+		canSignIn bool
+	}{
+		{label: "disable an active user", user: types.User{Enabled: true}, enabled: false, canSignIn: false},
+		{label: "disable a user not activated yet", user: types.User{}, enabled: false, canSignIn: false},
+		{label: "enable a disabled user", user: types.User{Enabled: true, Disabled: true}, enabled: true, canSignIn: true},
+		{label: "enable a user not activated yet", user: types.User{}, enabled: true, canSignIn: true},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			activated := test.user.Enabled
+			test.user.SetEnabled(test.enabled)
+			if test.user.CanSignIn() != test.canSignIn {
+				t.Errorf("expected can sign in %t, got %+v", test.canSignIn, test.user)
+			}
+			// disabling must not look like a pending activation, which the user could complete
+			if !test.enabled && test.user.Enabled != activated {
+				t.Errorf("disabling changed the activation: %+v", test.user)
+			}
+		})
+	}
+}
+
+func TestLinkableTo(t *testing.T) {
+	tests := []struct {
+		label    string
+		user     types.User
+		expected bool
+	}{
+		{label: "not linked", user: types.User{}, expected: true},
+		{label: "linked to the subject", user: types.User{OIDCSubject: "s1"}, expected: true},
+		{label: "linked to another subject", user: types.User{OIDCSubject: "s2"}, expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			if test.user.LinkableTo("s1") != test.expected {
+				t.Errorf("expected linkable %t, got %+v", test.expected, test.user)
+			}
+		})
+	}
+}
+
+func TestApplyAdminForm(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		label           string
+		form            types.AdminUserForm
+		usernameChanged bool
+		emailChanged    bool
+		expected        types.User
+	}{
+		{
+			label:    "empty form",
+			form:     types.AdminUserForm{},
+			expected: types.User{Username: "john", Email: "john@example.com", PendingEmail: "new@example.com", Settings: types.UserSetting{Lang: "en"}},
+		},
+		{
+			label:    "same username and email",
+			form:     types.AdminUserForm{Username: str("john"), Email: str("john@example.com")},
+			expected: types.User{Username: "john", Email: "john@example.com", PendingEmail: "new@example.com", Settings: types.UserSetting{Lang: "en"}},
+		},
+		{
+			label:           "new username",
+			form:            types.AdminUserForm{Username: str("jdoe")},
+			usernameChanged: true,
+			expected:        types.User{Username: "jdoe", Email: "john@example.com", PendingEmail: "new@example.com", Settings: types.UserSetting{Lang: "en"}},
+		},
+		{
+			label:        "new email drops the pending one",
+			form:         types.AdminUserForm{Email: str("jdoe@example.com")},
+			emailChanged: true,
+			expected:     types.User{Username: "john", Email: "jdoe@example.com", Settings: types.UserSetting{Lang: "en"}},
+		},
+		{
+			label: "profile and settings",
+			form:  types.AdminUserForm{FirstName: str("John"), LastName: str("Doe"), Lang: str("fr")},
+			expected: types.User{Username: "john", Email: "john@example.com", PendingEmail: "new@example.com",
+				Profile: types.UserProfile{FirstName: "John", LastName: "Doe"}, Settings: types.UserSetting{Lang: "fr"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			user := types.User{Username: "john", Email: "john@example.com", PendingEmail: "new@example.com", Settings: types.UserSetting{Lang: "en"}}
+			usernameChanged, emailChanged := user.ApplyAdminForm(&test.form)
+			if usernameChanged != test.usernameChanged || emailChanged != test.emailChanged {
+				t.Errorf("expected changes %t %t, got %t %t", test.usernameChanged, test.emailChanged, usernameChanged, emailChanged)
+			}
+			if user.Username != test.expected.Username || user.Email != test.expected.Email || user.PendingEmail != test.expected.PendingEmail ||
+				user.Profile.FirstName != test.expected.Profile.FirstName || user.Profile.LastName != test.expected.Profile.LastName ||
+				user.Settings.Lang != test.expected.Settings.Lang {
+				t.Errorf("expected %+v, got %+v", test.expected, user)
+			}
+		})
+	}
+}
+
+func TestSetRoles(t *testing.T) {
+	tests := []struct {
+		label    string
+		current  []types.Role
+		roles    []types.Role
+		expected []types.Role
+		demoted  bool
+	}{
+		{label: "promote", current: []types.Role{types.USER}, roles: []types.Role{types.ADMIN}, expected: []types.Role{types.USER, types.ADMIN}},
+		{label: "demote", current: []types.Role{types.USER, types.ADMIN}, roles: []types.Role{types.USER}, expected: []types.Role{types.USER}, demoted: true},
+		{label: "keep admin", current: []types.Role{types.USER, types.ADMIN}, roles: []types.Role{types.ADMIN, types.USER}, expected: []types.Role{types.USER, types.ADMIN}},
+		{label: "superadmin cannot be granted", current: []types.Role{types.USER}, roles: []types.Role{types.SUPERADMIN}, expected: []types.Role{types.USER}},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			user := types.User{Roles: test.current}
+			demoted := user.SetRoles(test.roles)
+			if demoted != test.demoted || !slices.Equal(user.Roles, test.expected) {
+				t.Errorf("expected %v demoted %t, got %v demoted %t", test.expected, test.demoted, user.Roles, demoted)
+			}
+		})
+	}
+}
+
+func TestAPIKeyIsValid(t *testing.T) {
+	now := time.Date(2024, time.November, 4, 12, 0, 0, 0, time.UTC)
+	revokedAt := now.Add(-time.Hour)
+	tests := []struct {
+		label    string
+		key      types.APIKey
+		expected bool
+	}{
+		{label: "valid", key: types.APIKey{ExpiresAt: now.Add(time.Hour)}, expected: true},
+		{label: "expired", key: types.APIKey{ExpiresAt: now.Add(-time.Second)}, expected: false},
+		{label: "expiring now", key: types.APIKey{ExpiresAt: now}, expected: false},
+		{label: "revoked", key: types.APIKey{ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt}, expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			if test.key.IsValid(now) != test.expected {
+				t.Errorf("expected valid %t for %+v", test.expected, test.key)
+			}
+		})
+	}
+}
+
+func TestAPIKeyScopedRoles(t *testing.T) {
+	tests := []struct {
+		label    string
+		scopes   []types.Role
+		roles    []types.Role
+		expected []types.Role
+	}{
+		{label: "user key of an admin", scopes: []types.Role{types.USER}, roles: []types.Role{types.USER, types.ADMIN}, expected: []types.Role{types.USER}},
+		{label: "admin key of an admin", scopes: []types.Role{types.ADMIN, types.USER}, roles: []types.Role{types.USER, types.ADMIN}, expected: []types.Role{types.USER, types.ADMIN}},
+		{label: "admin key of a demoted user", scopes: []types.Role{types.ADMIN}, roles: []types.Role{types.USER}, expected: []types.Role{}},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			roles := types.APIKey{Scopes: test.scopes}.ScopedRoles(test.roles)
+			if !slices.Equal(roles, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, roles)
+			}
+		})
+	}
+}
+
+func TestApplyMeForm(t *testing.T) {
+	str := func(s string) *string { return &s }
+	availability := &types.UserNormalAvailability{Days: []time.Weekday{time.Monday}, MinHour: 8, MaxHour: 17, HoursPerDay: 8}
+	tests := []struct {
+		label    string
+		form     types.UpdateMeForm
+		expected types.User
+	}{
+		{
+			label:    "empty form",
+			form:     types.UpdateMeForm{},
+			expected: types.User{Profile: types.UserProfile{FirstName: "John", LastName: "Doe"}, Settings: types.UserSetting{Lang: "en"}},
+		},
+		{
+			label:    "names",
+			form:     types.UpdateMeForm{FirstName: str("Jane"), LastName: str("Roe")},
+			expected: types.User{Profile: types.UserProfile{FirstName: "Jane", LastName: "Roe"}, Settings: types.UserSetting{Lang: "en"}},
+		},
+		{
+			label:    "availability and lang",
+			form:     types.UpdateMeForm{Availability: availability, Lang: str("fr")},
+			expected: types.User{Profile: types.UserProfile{FirstName: "John", LastName: "Doe", Availability: availability}, Settings: types.UserSetting{Lang: "fr"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			user := types.User{Username: "john", Email: "john@example.com", Profile: types.UserProfile{FirstName: "John", LastName: "Doe"}, Settings: types.UserSetting{Lang: "en"}}
+			user.ApplyMeForm(&test.form)
+			if user.Username != "john" || user.Email != "john@example.com" {
+				t.Errorf("the form must not touch the username nor the email, got %+v", user)
+			}
+			if user.Profile.FirstName != test.expected.Profile.FirstName || user.Profile.LastName != test.expected.Profile.LastName ||
+				user.Profile.Availability != test.expected.Profile.Availability || user.Settings.Lang != test.expected.Settings.Lang {
+				t.Errorf("expected %+v, got %+v", test.expected, user)
+			}
+		})
+	}
+}
+
+func TestEmailChangeTokenConfirms(t *testing.T) {
+	now := time.Date(2024, time.November, 4, 12, 0, 0, 0, time.UTC)
+	token := types.EmailChangeToken{UserID: "u1", Email: "new@example.com", ExpiresAt: now.Add(time.Minute)}
+	tests := []struct {
+		label    string
+		token    types.EmailChangeToken
+		user     types.User
+		now      time.Time
+		expected bool
+	}{
+		{label: "pending address", token: token, user: types.User{ID: "u1", PendingEmail: "new@example.com"}, now: now, expected: true},
+		{label: "expired", token: token, user: types.User{ID: "u1", PendingEmail: "new@example.com"}, now: now.Add(time.Minute), expected: false},
+		{label: "another user", token: token, user: types.User{ID: "u2", PendingEmail: "new@example.com"}, now: now, expected: false},
+		{label: "a later request", token: token, user: types.User{ID: "u1", PendingEmail: "other@example.com"}, now: now, expected: false},
+		{label: "email set by an admin meanwhile", token: token, user: types.User{ID: "u1", Email: "admin@example.com"}, now: now, expected: false},
+		{label: "token without address", token: types.EmailChangeToken{UserID: "u1", ExpiresAt: now.Add(time.Minute)}, user: types.User{ID: "u1"}, now: now, expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.label, func(t *testing.T) {
+			if test.token.Confirms(test.user, test.now) != test.expected {
+				t.Errorf("expected confirms %t for %+v", test.expected, test.user)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/nbittich/wtm/services/utils"
+)
+
+func TestParseETag(t *testing.T) {
+	tests := []struct {
+		tag      string
+		expected int64
+		valid    bool
+	}{
+		{utils.ETag(3), 3, true},
+		{`"0"`, 0, true},
+		{`W/"12"`, 12, true},
+		{` "7" `, 7, true},
+		{`7`, 0, false},
+		{`"abc"`, 0, false},
+		{`"-1"`, 0, false},
+	}
+	for _, test := range tests {
+		version, err := utils.ParseETag(test.tag)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %t, got %v", test.tag, test.valid, err)
+		}
+		if test.valid && version != test.expected {
+			t.Errorf("%s: expected version %d, got %d", test.tag, test.expected, version)
+		}
+	}
+}
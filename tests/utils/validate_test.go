@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/nbittich/wtm/services/utils"
+)
+
+func TestUsernameFromEmail(t *testing.T) {
+	tests := []struct {
+		email    string
+		suffix   int
+		expected string
+	}{
+		{"john@example.com", 0, "john"},
+		{"John.Doe-42@example.com", 0, "johndoe42"},
+		{"jo@example.com", 0, "jo0"},
+		{"42@example.com", 0, "user42"},
+		{"é@example.com", 0, "user"},
+		{"averyveryverylongname@example.com", 0, "averyveryverylo"},
+		{"averyveryverylongname@example.com", 12, "averyveryvery12"},
+		{"john@example.com", 3, "john3"},
+	}
+	for _, test := range tests {
+		t.Run(test.email, func(t *testing.T) {
+			username := utils.UsernameFromEmail(test.email, test.suffix)
+			if username != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, username)
+			}
+			if err := utils.Validate.Var(username, "required,min=3,max=15,alphanum,startswithalpha"); err != nil {
+				t.Errorf("invalid username %s: %v", username, err)
+			}
+		})
+	}
+}
@@ -39,6 +39,15 @@ type Identifiable interface {
 	SetID(id string)
 }
 
+// Versioned documents are saved only if they were not modified since they were read, see
+// db.InsertOrUpdate. The version is bumped on each save, documents saved before it existed
+// have the version 0.
+type Versioned interface {
+	Identifiable
+	GetVersion() int64
+	SetVersion(version int64)
+}
+
 const (
 	I18nKey = CtxKey("localizer")
 	LangKey = CtxKey("lang")
@@ -0,0 +1,40 @@
+package types
+
+type ShiftKind string
+
+const (
+	WeekendShift   ShiftKind = "WEEKEND"
+	NightShift     ShiftKind = "NIGHT"
+	HolidayShift   ShiftKind = "HOLIDAY"
+	UnpopularShift ShiftKind = "UNPOPULAR"
+)
+
+var ShiftKinds = []ShiftKind{WeekendShift, NightShift, HolidayShift, UnpopularShift}
+
+// FairnessWeights is the penalty of each kind of shift when computing the score of a user.
+type FairnessWeights map[ShiftKind]float64
+
+func DefaultFairnessWeights() FairnessWeights {
+	return FairnessWeights{
+		WeekendShift:   1,
+		NightShift:     1,
+		HolidayShift:   2,
+		UnpopularShift: 1,
+	}
+}
+
+type (
+	FairnessLine struct {
+		UserID string            `json:"userId"`
+		Label  string            `json:"label"`
+		Shifts int               `json:"shifts"`
+		Counts map[ShiftKind]int `json:"counts"`
+		Score  float64           `json:"score"`
+	}
+	FairnessReport struct {
+		From  string                `json:"from"`
+		To    string                `json:"to"`
+		Lines []FairnessLine        `json:"lines"`
+		Index map[ShiftKind]float64 `json:"index"` // Jain's index, from 1/n (one user does everything) to 1 (evenly spread)
+	}
+)
@@ -0,0 +1,61 @@
+package types
+
+import "time"
+
+type (
+	OvertimePeriod struct {
+		Start       string  `json:"start"`
+		End         string  `json:"end"`
+		Worked      float64 `json:"worked"`
+		Contractual float64 `json:"contractual"`
+		Overtime    float64 `json:"overtime"`
+	}
+	OvertimeSummary struct {
+		UserID           string           `json:"userId"`
+		ContractualHours float64          `json:"contractualHours"`
+		Weeks            []OvertimePeriod `json:"weeks"`
+		Months           []OvertimePeriod `json:"months"`
+	}
+	TimeInLieuBalance struct {
+		UserID   string  `json:"userId"`
+		Earned   float64 `json:"earned"`
+		Taken    float64 `json:"taken"`
+		Adjusted float64 `json:"adjusted"`
+		Balance  float64 `json:"balance"`
+	}
+)
+
+// ClockPunch is a period worked by an employee, as recorded by the time clock. Out is nil while
+// the employee is clocked in.
+type ClockPunch struct {
+	ID         string     `bson:"_id" json:"_id"`
+	EmployeeID string     `bson:"employeeId" json:"employeeId"`
+	In         time.Time  `bson:"in" json:"in"`
+	Out        *time.Time `bson:"out,omitempty" json:"out,omitempty"`
+}
+
+func (punch ClockPunch) GetID() string {
+	return punch.ID
+}
+
+func (punch *ClockPunch) SetID(id string) {
+	punch.ID = id
+}
+
+// TimeInLieuAdjustment is a manual correction of the balance by an admin, e.g. overtime paid out.
+type TimeInLieuAdjustment struct {
+	ID        string    `bson:"_id" json:"_id"`
+	UserID    string    `bson:"userId" json:"userId"`
+	Hours     float64   `bson:"hours" json:"hours" validate:"required"`
+	Reason    string    `bson:"reason" json:"reason" validate:"required,min=2"`
+	CreatedBy string    `bson:"createdBy" json:"createdBy"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+func (adjustment TimeInLieuAdjustment) GetID() string {
+	return adjustment.ID
+}
+
+func (adjustment *TimeInLieuAdjustment) SetID(id string) {
+	adjustment.ID = id
+}
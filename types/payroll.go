@@ -0,0 +1,60 @@
+package types
+
+import "time"
+
+type HourCategory string
+
+const (
+	NormalHours        HourCategory = "NORMAL"
+	OvertimeHours      HourCategory = "OVERTIME"
+	NightHours         HourCategory = "NIGHT"
+	SundayHours        HourCategory = "SUNDAY"
+	PublicHolidayHours HourCategory = "PUBLIC_HOLIDAY"
+)
+
+// HourCategories lists the categories in the order they are exported.
+var HourCategories = []HourCategory{NormalHours, OvertimeHours, NightHours, SundayHours, PublicHolidayHours}
+
+type PayrollRules struct {
+	ID                  string    `bson:"_id" json:"_id"`
+	NightStartHour      int       `bson:"nightStartHour" json:"nightStartHour" validate:"min=0,max=23"`
+	NightEndHour        int       `bson:"nightEndHour" json:"nightEndHour" validate:"min=0,max=23"`
+	DailyOvertimeAfter  float64   `bson:"dailyOvertimeAfter" json:"dailyOvertimeAfter" validate:"min=0,max=24"`
+	WeeklyOvertimeAfter float64   `bson:"weeklyOvertimeAfter" json:"weeklyOvertimeAfter" validate:"min=0,max=168"`
+	PublicHolidays      []string  `bson:"publicHolidays" json:"publicHolidays" validate:"dive,datetime=02/01/2006"`
+	UpdatedAt           time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+type (
+	PayrollReport struct {
+		From  string        `json:"from"`
+		To    string        `json:"to"`
+		Lines []PayrollLine `json:"lines"`
+	}
+	PayrollLine struct {
+		EmployeeID string                   `json:"employeeId"`
+		Username   string                   `json:"username"`
+		FirstName  string                   `json:"firstName"`
+		LastName   string                   `json:"lastName"`
+		Hours      map[HourCategory]float64 `json:"hours"`
+		Total      float64                  `json:"total"`
+	}
+)
+
+// DefaultPayrollRules are used until an admin configures the rules of the organization.
+func DefaultPayrollRules() PayrollRules {
+	return PayrollRules{
+		NightStartHour:      22,
+		NightEndHour:        6,
+		WeeklyOvertimeAfter: 38,
+		PublicHolidays:      []string{},
+	}
+}
+
+func (rules PayrollRules) GetID() string {
+	return rules.ID
+}
+
+func (rules *PayrollRules) SetID(id string) {
+	rules.ID = id
+}
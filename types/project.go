@@ -10,15 +10,32 @@ type Project struct {
 	UpdatedAt   time.Time   `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
 	Archived    bool        `bson:"archived" json:"archived"`
 	Type        ProjectType `bson:"projectType" json:"projectType" validate:"required"`
+	Version     int64       `bson:"version" json:"version"`
+	DeletedAt   *time.Time  `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"` // restorable until purged
 }
 
 type ProjectType string
 
+// ProjectFilter selects the projects listed, the zero value all the ones not deleted.
+type ProjectFilter struct {
+	Type     ProjectType
+	Archived *bool
+}
+
+// PlanningFilter selects the entries listed of a project, the zero value all the ones not deleted.
+type PlanningFilter struct {
+	From       *time.Time // starting on or after
+	To         *time.Time // starting before
+	EmployeeID string
+}
+
 const (
 	Work     ProjectType = "WORK"
 	Holidays ProjectType = "HOLIDAYS"
 	Sickness ProjectType = "SICKNESS"
 	Absence  ProjectType = "ABSENCE"
+	// TimeInLieu is an absence compensating overtime, it is deducted from the time-in-lieu balance
+	TimeInLieu ProjectType = "TIME_IN_LIEU"
 )
 
 type PlanningEntry struct {
@@ -33,6 +50,9 @@ type PlanningEntry struct {
 	Title                   string     `bson:"title" json:"title" validate:"required"`
 	Description             *string    `bson:"description,omitempty" json:"description"`
 	Comments                []Comment  `bson:"comments" json:"comments"`
+	Unpopular               bool       `bson:"unpopular" json:"unpopular"`
+	Version                 int64      `bson:"version" json:"version"`
+	DeletedAt               *time.Time `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"` // restorable until purged
 }
 
 type PlanningAssignment struct {
@@ -59,6 +79,9 @@ type (
 		Shifts                  []Shift               `json:"shifts" validate:"required,min=1"`
 		IncludeSaturday         bool                  `json:"includeSaturday"`
 		IncludeSunday           bool                  `json:"includeSunday"`
+		Unpopular               bool                  `json:"unpopular"`
+		Balanced                bool                  `json:"balanced"` // hand out shifts by fairness score instead of assigning everyone
+		EmployeesPerShift       int                   `json:"employeesPerShift" validate:"omitempty,min=1"`
 	}
 	PlanningValidity struct {
 		Valid    bool      `json:"valid"`
@@ -104,6 +127,18 @@ func (entry *Project) SetID(id string) {
 	entry.ID = id
 }
 
+func (entry Project) GetDeletedAt() *time.Time {
+	return entry.DeletedAt
+}
+
+func (entry Project) GetVersion() int64 {
+	return entry.Version
+}
+
+func (entry *Project) SetVersion(version int64) {
+	entry.Version = version
+}
+
 func (entry PlanningEntry) GetID() string {
 	return entry.ID
 }
@@ -111,3 +146,15 @@ func (entry PlanningEntry) GetID() string {
 func (entry *PlanningEntry) SetID(id string) {
 	entry.ID = id
 }
+
+func (entry PlanningEntry) GetDeletedAt() *time.Time {
+	return entry.DeletedAt
+}
+
+func (entry PlanningEntry) GetVersion() int64 {
+	return entry.Version
+}
+
+func (entry *PlanningEntry) SetVersion(version int64) {
+	entry.Version = version
+}
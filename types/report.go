@@ -0,0 +1,33 @@
+package types
+
+import "time"
+
+type ReportGranularity string
+
+const (
+	ReportByWeek  ReportGranularity = "WEEK"
+	ReportByMonth ReportGranularity = "MONTH"
+)
+
+// ReportFilter restricts a report to [From, To). wtm has no team entity, a team is
+// given as the list of its employees.
+type ReportFilter struct {
+	From        time.Time
+	To          time.Time
+	EmployeeIDs []string
+	ProjectIDs  []string
+}
+
+type ReportLine struct {
+	ID               string   `bson:"_id" json:"_id"` // employee id, project id or period, depending on the report
+	Label            string   `bson:"-" json:"label"`
+	Hours            float64  `bson:"hours" json:"hours"`
+	Assignments      int64    `bson:"assignments" json:"assignments"`
+	Cancellations    int64    `bson:"cancellations" json:"cancellations"`
+	ContractualHours *float64 `bson:"-" json:"contractualHours,omitempty"`
+	Utilization      *float64 `bson:"-" json:"utilization,omitempty"`
+}
+
+func (line ReportLine) GetID() string {
+	return line.ID
+}
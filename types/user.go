@@ -16,21 +16,295 @@ type UserActivationURL struct {
 	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
 }
 
+// EmailChangeToken confirms the new address of a user. It is single use.
+type EmailChangeToken struct {
+	ID        string    `bson:"_id" json:"_id"`
+	UserID    string    `bson:"userId" json:"userId"`
+	Email     string    `bson:"email" json:"email"` // the new address, the link is sent to
+	Hash      string    `bson:"hash" json:"-"`      // sha256 of the token sent by email
+	Group     Group     `bson:"group" json:"group"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"`
+}
+
+// Session is created at login, the access tokens carry its id and the refresh token rotates on every use.
+type Session struct {
+	ID                  string     `bson:"_id" json:"_id"`
+	UserID              string     `bson:"userId" json:"userId"`
+	RefreshHash         string     `bson:"refreshHash" json:"-"`
+	PreviousRefreshHash string     `bson:"previousRefreshHash,omitempty" json:"-"`
+	UserAgent           string     `bson:"userAgent" json:"userAgent"`
+	IP                  string     `bson:"ip" json:"ip"`
+	CreatedAt           time.Time  `bson:"createdAt" json:"createdAt"`
+	RefreshedAt         time.Time  `bson:"refreshedAt" json:"refreshedAt"`
+	ExpiresAt           time.Time  `bson:"expiresAt" json:"expiresAt"`
+	RevokedAt           *time.Time `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	MFAVerified         bool       `bson:"mfaVerified" json:"mfaVerified"`
+}
+
+type TokenPair struct {
+	AccessToken  string    `json:"jwt"`
+	RefreshToken string    `json:"refreshToken,omitempty"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// APIKey lets a user call the api from a script. Only the sha256 of the key is stored.
+type APIKey struct {
+	ID         string     `bson:"_id" json:"_id"`
+	UserID     string     `bson:"userId" json:"userId"`
+	Name       string     `bson:"name" json:"name"`
+	Prefix     string     `bson:"prefix" json:"prefix"` // first characters of the key, to recognize it
+	Hash       string     `bson:"hash" json:"-"`
+	Scopes     []Role     `bson:"scopes" json:"scopes"` // roles the key may act with, among the roles of its owner
+	CreatedAt  time.Time  `bson:"createdAt" json:"createdAt"`
+	ExpiresAt  time.Time  `bson:"expiresAt" json:"expiresAt"`
+	LastUsedAt *time.Time `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+// IsValid tells whether the key can still be used at the given time.
+func (key APIKey) IsValid(now time.Time) bool {
+	return key.RevokedAt == nil && now.Before(key.ExpiresAt)
+}
+
+// ScopedRoles returns the roles of the owner the key may act with.
+func (key APIKey) ScopedRoles(roles []Role) []Role {
+	return slices.DeleteFunc(slices.Clone(roles), func(r Role) bool { return !slices.Contains(key.Scopes, r) })
+}
+
+type NewAPIKeyForm struct {
+	Name          string `json:"name" form:"name" validate:"required,min=2,max=64"`
+	Scopes        []Role `json:"scopes" form:"scopes" validate:"required,min=1,dive,oneof=USER ADMIN"`
+	ExpiresInDays int    `json:"expiresInDays" form:"expiresInDays" validate:"required,min=1,max=365"`
+}
+
+// NewAPIKey is only returned once, at creation: the key cannot be read afterwards.
+type NewAPIKey struct {
+	APIKey APIKey `json:"apiKey"`
+	Key    string `json:"key"`
+}
+
+// LoginThrottle counts the failed logins of a user or of an ip address. Its id is the throttled key.
+type LoginThrottle struct {
+	ID            string     `bson:"_id" json:"_id"`
+	UserID        string     `bson:"userId,omitempty" json:"userId,omitempty"`
+	Group         Group      `bson:"group,omitempty" json:"group,omitempty"`
+	Failures      int        `bson:"failures" json:"failures"`
+	LastFailureAt time.Time  `bson:"lastFailureAt" json:"lastFailureAt"`
+	LockedUntil   *time.Time `bson:"lockedUntil,omitempty" json:"lockedUntil,omitempty"`
+	UnlockHash    string     `bson:"unlockHash,omitempty" json:"-"` // sha256 of the token sent by email to unlock
+}
+
+// Invitation lets someone join an organization, choosing their own username and password.
+type Invitation struct {
+	ID         string     `bson:"_id" json:"_id"`
+	Email      string     `bson:"email" json:"email"`
+	FirstName  string     `bson:"firstName" json:"firstName"`
+	LastName   string     `bson:"lastName" json:"lastName"`
+	Role       Role       `bson:"role" json:"role"`
+	Hash       string     `bson:"hash" json:"-"` // sha256 of the token sent by email
+	Group      Group      `bson:"group" json:"group"`
+	InvitedBy  string     `bson:"invitedBy,omitempty" json:"invitedBy,omitempty"`
+	CreatedAt  time.Time  `bson:"createdAt" json:"createdAt"`
+	ExpiresAt  time.Time  `bson:"expiresAt" json:"expiresAt"`
+	AcceptedAt *time.Time `bson:"acceptedAt,omitempty" json:"acceptedAt,omitempty"`
+	UserID     string     `bson:"userId,omitempty" json:"userId,omitempty"` // set once accepted
+}
+
+type InvitationForm struct {
+	Email     string `json:"email" form:"email" validate:"required,email"`
+	FirstName string `json:"firstName" form:"firstName" validate:"max=255"`
+	LastName  string `json:"lastName" form:"lastName" validate:"max=255"`
+	Role      *Role  `json:"role" form:"role" validate:"omitempty,oneof=USER ADMIN"`
+}
+
+type AcceptInvitationForm struct {
+	Token           string `json:"token" form:"token" validate:"required"`
+	Group           string `json:"group" form:"group" validate:"required"`
+	Username        string `json:"username" form:"username" validate:"required,min=3,max=15,alphanum,startswithalpha"`
+	Password        string `json:"password" form:"password" validate:"required,min=6,max=18,password"`
+	ConfirmPassword string `json:"confirmPassword" form:"confirmPassword" validate:"eqcsfield=Password"`
+	AcceptTerms     bool   `json:"acceptTerms" form:"acceptTerms" validate:"required"`
+}
+
+type PasswordResetToken struct {
+	ID        string     `bson:"_id" json:"_id"`
+	UserID    string     `bson:"userId" json:"userId"`
+	Hash      string     `bson:"hash" json:"-"` // sha256 of the token sent by email
+	Group     Group      `bson:"group" json:"group"`
+	CreatedAt time.Time  `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time  `bson:"expiresAt" json:"expiresAt"`
+	UsedAt    *time.Time `bson:"usedAt,omitempty" json:"usedAt,omitempty"`
+}
+
+type ResetPasswordForm struct {
+	Token           string `json:"token" form:"token" validate:"required"`
+	Group           string `json:"group" form:"group" validate:"required"`
+	Password        string `json:"password" form:"password" validate:"required,min=6,max=18,password"`
+	ConfirmPassword string `json:"confirmPassword" form:"confirmPassword" validate:"eqcsfield=Password"`
+}
+
+// UpdateMeForm is a partial update of the profile and settings of the current user, nil fields are left untouched.
+type UpdateMeForm struct {
+	FirstName    *string                 `json:"firstName" validate:"omitempty,max=255"`
+	LastName     *string                 `json:"lastName" validate:"omitempty,max=255"`
+	Availability *UserNormalAvailability `json:"availability" validate:"omitempty"`
+	Lang         *string                 `json:"lang" validate:"omitempty,oneof=en fr"`
+}
+
+// AdminUserForm is a partial update of a user by an admin, nil fields are left untouched.
+type AdminUserForm struct {
+	Username     *string                 `json:"username" validate:"omitempty,min=3,max=15,alphanum,startswithalpha"`
+	Email        *string                 `json:"email" validate:"omitempty,email"`
+	FirstName    *string                 `json:"firstName" validate:"omitempty,max=255"`
+	LastName     *string                 `json:"lastName" validate:"omitempty,max=255"`
+	Availability *UserNormalAvailability `json:"availability" validate:"omitempty"`
+	Lang         *string                 `json:"lang" validate:"omitempty,oneof=en fr"`
+}
+
+type UserRolesForm struct {
+	Roles []Role `json:"roles" validate:"required,min=1,dive,oneof=USER ADMIN"`
+}
+
+type ChangePasswordForm struct {
+	CurrentPassword string `json:"currentPassword" form:"currentPassword" validate:"required"`
+	Password        string `json:"password" form:"password" validate:"required,min=6,max=18,password"`
+	ConfirmPassword string `json:"confirmPassword" form:"confirmPassword" validate:"eqcsfield=Password"`
+}
+
+type ChangeEmailForm struct {
+	Email    string `json:"email" form:"email" validate:"required,email"`
+	Password string `json:"password" form:"password" validate:"required"`
+}
+
 type Organization struct {
-	ID             string           `bson:"_id" json:"_id"`
-	Group          Group            `bson:"group" json:"group"`
-	FullName       string           `bson:"fullName" json:"fullName"`
-	AdditionalInfo []AdditionalInfo `bson:"additionalInfo" json:"additionalInfo"`
-	Email          string           `json:"email"`
+	ID                  string             `bson:"_id" json:"_id"`
+	Group               Group              `bson:"group" json:"group"`
+	FullName            string             `bson:"fullName" json:"fullName"`
+	AdditionalInfo      []AdditionalInfo   `bson:"additionalInfo" json:"additionalInfo"`
+	Email               string             `json:"email"`
+	RequireMFAForAdmins bool               `bson:"requireMfaForAdmins" json:"requireMfaForAdmins"`
+	OIDC                *OIDCConfig        `bson:"oidc,omitempty" json:"oidc,omitempty"`
+	Status              OrganizationStatus `bson:"status,omitempty" json:"status,omitempty"` // empty means active
+	SuspendedAt         *time.Time         `bson:"suspendedAt,omitempty" json:"suspendedAt,omitempty"`
+	DeletedAt           *time.Time         `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	PurgeAt             *time.Time         `bson:"purgeAt,omitempty" json:"purgeAt,omitempty"` // the database is dropped after it
+}
+
+type OrganizationStatus string
+
+const (
+	OrganizationActive    OrganizationStatus = "ACTIVE"
+	OrganizationSuspended OrganizationStatus = "SUSPENDED"
+	OrganizationDeleted   OrganizationStatus = "DELETED"
+)
+
+// IsActive tells whether the members of the organization may use the application.
+func (org Organization) IsActive() bool {
+	return org.Status == "" || org.Status == OrganizationActive
+}
+
+// Suspend blocks the members of the active organization.
+func (org *Organization) Suspend(now time.Time) error {
+	if !org.IsActive() {
+		return fmt.Errorf("organization is not active")
+	}
+	org.Status = OrganizationSuspended
+	org.SuspendedAt = &now
+	return nil
+}
+
+// Reactivate lifts the suspension of the organization.
+func (org *Organization) Reactivate() error {
+	if org.Status != OrganizationSuspended {
+		return fmt.Errorf("organization is not suspended")
+	}
+	org.Status = OrganizationActive
+	org.SuspendedAt = nil
+	return nil
+}
+
+// Delete blocks the organization and schedules its purge after the grace period.
+func (org *Organization) Delete(now time.Time, grace time.Duration) error {
+	if org.Status == OrganizationDeleted {
+		return fmt.Errorf("organization already deleted")
+	}
+	purgeAt := now.Add(grace)
+	org.Status = OrganizationDeleted
+	org.DeletedAt = &now
+	org.PurgeAt = &purgeAt
+	return nil
+}
+
+// Restore cancels the deletion during the grace period. The organization goes back to suspended
+// when it was suspended before the deletion.
+func (org *Organization) Restore(now time.Time) error {
+	if org.Status != OrganizationDeleted {
+		return fmt.Errorf("organization is not deleted")
+	}
+	if org.PurgeDue(now) {
+		return fmt.Errorf("grace period is over")
+	}
+	org.Status = OrganizationActive
+	if org.SuspendedAt != nil {
+		org.Status = OrganizationSuspended
+	}
+	org.DeletedAt = nil
+	org.PurgeAt = nil
+	return nil
+}
+
+// PurgeDue tells whether the organization is deleted and its grace period is over.
+func (org Organization) PurgeDue(now time.Time) bool {
+	return org.Status == OrganizationDeleted && org.PurgeAt != nil && !org.PurgeAt.After(now)
+}
+
+// ResetLifecycle makes the organization active again, forgetting when it was suspended or deleted.
+func (org *Organization) ResetLifecycle() {
+	org.Status = OrganizationActive
+	org.SuspendedAt = nil
+	org.DeletedAt = nil
+	org.PurgeAt = nil
+}
+
+// OIDCConfig lets the members of an organization sign in with its identity provider.
+type OIDCConfig struct {
+	Issuer       string `bson:"issuer" json:"issuer"`
+	ClientID     string `bson:"clientId" json:"clientId"`
+	ClientSecret string `bson:"clientSecret" json:"-"`
+	Provisioning bool   `bson:"provisioning" json:"provisioning"` // create unknown users on their first login
+	// TrustMFA accepts the amr claim of the identity provider as second factor, instead of the TOTP of the user
+	TrustMFA bool `bson:"trustMfa" json:"trustMfa"`
+}
+
+type OIDCForm struct {
+	Issuer       string `json:"issuer" validate:"required,url"`
+	ClientID     string `json:"clientId" validate:"required"`
+	ClientSecret string `json:"clientSecret"` // the current one is kept when empty
+	Provisioning bool   `json:"provisioning"`
+	TrustMFA     bool   `json:"trustMfa"`
+}
+
+// OIDCState is a pending single sign-on, between the redirection to the identity provider and its callback.
+type OIDCState struct {
+	ID        string    `bson:"_id" json:"_id"`
+	Hash      string    `bson:"hash" json:"-"`
+	Nonce     string    `bson:"nonce" json:"-"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"`
 }
 
 type OrganizationForm struct {
-	ID             string           `json:"_id"`
-	Group          string           `json:"group" validate:"required,min=2,max=24,alpha"`
-	FullName       string           `json:"fullName" validate:"required,min=2,max=255"`
-	AdditionalInfo []AdditionalInfo `json:"additionalInfo" validate:"omitempty"`
-	NewUser        *NewUserForm     `json:"newUser" validate:"omitempty"`
-	Email          *string          `json:"email" validate:"omitempty,email"`
+	ID                  string           `json:"_id"`
+	Group               string           `json:"group" validate:"required,min=2,max=24,alpha"`
+	FullName            string           `json:"fullName" validate:"required,min=2,max=255"`
+	AdditionalInfo      []AdditionalInfo `json:"additionalInfo" validate:"omitempty"`
+	Admin               *InvitationForm  `json:"admin" validate:"omitempty"` // invited as first admin of a new organization
+	Email               *string          `json:"email" validate:"omitempty,email"`
+	RequireMFAForAdmins *bool            `json:"requireMfaForAdmins"` // left untouched when nil
+	OIDC                *OIDCForm        `json:"oidc" validate:"omitempty"`
+	// Deprecated: use Admin. Still accepted for the existing callers, the first admin is then
+	// created at once with the given credentials, as before the invitations.
+	NewUser *NewUserForm `json:"newUser" validate:"omitempty"`
 }
 
 type AdditionalInfo struct {
@@ -65,6 +339,32 @@ type User struct {
 	Roles    []Role      `json:"roles"`
 	Group    *Group      `json:"group"`
 	Settings UserSetting `json:"settings"`
+	TOTP     *UserTOTP   `json:"-" bson:"totp,omitempty"`
+	// subject of the user at the identity provider of the organization, once signed in with it
+	OIDCSubject string `json:"-" bson:"oidcSubject,omitempty"`
+	// new address waiting for confirmation, Email stays in use until then
+	PendingEmail string `json:"pendingEmail,omitempty" bson:"pendingEmail,omitempty"`
+	// set by an admin. Unlike Enabled, which is false until the account is activated, it cannot be
+	// undone by the user
+	Disabled bool `json:"disabled" bson:"disabled,omitempty"`
+}
+
+// UserTOTP is the second factor of a user. It is only enforced once Enabled, after the first code was confirmed.
+type UserTOTP struct {
+	Secret        string    `bson:"secret"`
+	Enabled       bool      `bson:"enabled"`
+	LastStep      uint64    `bson:"lastStep"`      // last accepted time step, to prevent replays
+	RecoveryCodes []string  `bson:"recoveryCodes"` // sha256 of the unused recovery codes
+	UpdatedAt     time.Time `bson:"updatedAt"`
+}
+
+// MFAChallenge is the intermediate state of a login, between the password and the second factor.
+type MFAChallenge struct {
+	ID        string    `bson:"_id" json:"_id"`
+	UserID    string    `bson:"userId" json:"userId"`
+	Hash      string    `bson:"hash" json:"-"`
+	Attempts  int       `bson:"attempts" json:"attempts"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"`
 }
 
 type UserClaims struct {
@@ -75,13 +375,26 @@ type UserClaims struct {
 	Settings UserSetting `json:"settings"`
 	Roles    []Role      `json:"roles"`
 	Group    Group       `json:"group"`
+	// the organization requires a second factor the user didn't enroll yet, roles needing it are withheld
+	MFAEnrollmentRequired bool `json:"mfaEnrollmentRequired,omitempty"`
+	// set when the request was authenticated with an api key instead of a session
+	APIKeyID string `json:"apiKeyId,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// UserFilter selects the users listed, the zero value all of them.
+type UserFilter struct {
+	Query    string // contained in the username, email or name
+	Role     Role
+	Enabled  *bool
+	Disabled *bool
+}
+
 type UserProfile struct {
-	FirstName    string                  `json:"firstName"`
-	LastName     string                  `json:"lastName"`
-	Availability *UserNormalAvailability `json:"availability" bson:"availability,omitempty"`
+	FirstName        string                  `json:"firstName"`
+	LastName         string                  `json:"lastName"`
+	Availability     *UserNormalAvailability `json:"availability" bson:"availability,omitempty"`
+	ContractualHours float64                 `json:"contractualHours" bson:"contractualHours,omitempty" validate:"min=0,max=168"` // per week, 0 means no overtime
 }
 
 type UserSetting struct {
@@ -89,10 +402,10 @@ type UserSetting struct {
 }
 
 type UserNormalAvailability struct {
-	Days        []time.Weekday `json:"days"`
-	MinHour     int            `json:"minHour"`
-	MaxHour     int            `json:"maxHour"`
-	HoursPerDay int            `json:"hoursPerday"`
+	Days        []time.Weekday `json:"days" validate:"dive,min=0,max=6"`
+	MinHour     int            `json:"minHour" validate:"min=0,max=23"`
+	MaxHour     int            `json:"maxHour" validate:"min=0,max=23"`
+	HoursPerDay int            `json:"hoursPerday" validate:"min=0,max=24"`
 }
 
 func (availability *UserNormalAvailability) IsAvailable(startStr string, endStr string) (bool, error) {
@@ -128,6 +441,80 @@ func (availability *UserNormalAvailability) IsAvailable(startStr string, endStr
 	return false, nil
 }
 
+// CanSignIn tells whether the account was activated and not disabled by an admin.
+func (user User) CanSignIn() bool {
+	return user.Enabled && !user.Disabled
+}
+
+// LinkableTo tells whether the user may sign in as the subject of the identity provider: a user
+// is linked to a single subject, the first one.
+func (user User) LinkableTo(subject string) bool {
+	return user.OIDCSubject == "" || user.OIDCSubject == subject
+}
+
+// SetEnabled enables or disables the user by an admin. Enabling also activates the account.
+func (user *User) SetEnabled(enabled bool) {
+	user.Disabled = !enabled
+	if enabled {
+		user.Enabled = true
+	}
+}
+
+// ApplyMeForm applies the non nil fields of the form.
+func (user *User) ApplyMeForm(form *UpdateMeForm) {
+	if form.FirstName != nil {
+		user.Profile.FirstName = *form.FirstName
+	}
+	if form.LastName != nil {
+		user.Profile.LastName = *form.LastName
+	}
+	if form.Availability != nil {
+		user.Profile.Availability = form.Availability
+	}
+	if form.Lang != nil {
+		user.Settings.Lang = *form.Lang
+	}
+}
+
+// ApplyAdminForm applies the non nil fields of the form, and tells whether the username or the
+// email changed, which must then be checked for uniqueness. A new email drops the pending one.
+func (user *User) ApplyAdminForm(form *AdminUserForm) (usernameChanged bool, emailChanged bool) {
+	if form.Username != nil && *form.Username != user.Username {
+		user.Username = *form.Username
+		usernameChanged = true
+	}
+	if form.Email != nil && *form.Email != user.Email {
+		user.Email = *form.Email
+		user.PendingEmail = ""
+		emailChanged = true
+	}
+	if form.FirstName != nil {
+		user.Profile.FirstName = *form.FirstName
+	}
+	if form.LastName != nil {
+		user.Profile.LastName = *form.LastName
+	}
+	if form.Availability != nil {
+		user.Profile.Availability = form.Availability
+	}
+	if form.Lang != nil {
+		user.Settings.Lang = *form.Lang
+	}
+	return usernameChanged, emailChanged
+}
+
+// SetRoles replaces the roles of the user, USER is always kept and the unknown ones are ignored.
+// It tells whether ADMIN was withdrawn.
+func (user *User) SetRoles(roles []Role) (demoted bool) {
+	newRoles := []Role{USER}
+	if slices.Contains(roles, ADMIN) {
+		newRoles = append(newRoles, ADMIN)
+	}
+	demoted = slices.Contains(user.Roles, ADMIN) && !slices.Contains(newRoles, ADMIN)
+	user.Roles = newRoles
+	return demoted
+}
+
 func (user User) GetID() string {
 	return user.ID
 }
@@ -152,6 +539,76 @@ func (userActivationURL *UserActivationURL) SetID(id string) {
 	userActivationURL.ID = id
 }
 
+func (session Session) GetID() string {
+	return session.ID
+}
+
+func (session *Session) SetID(id string) {
+	session.ID = id
+}
+
+func (challenge MFAChallenge) GetID() string {
+	return challenge.ID
+}
+
+func (challenge *MFAChallenge) SetID(id string) {
+	challenge.ID = id
+}
+
+func (token PasswordResetToken) GetID() string {
+	return token.ID
+}
+
+func (token *PasswordResetToken) SetID(id string) {
+	token.ID = id
+}
+
+func (token EmailChangeToken) GetID() string {
+	return token.ID
+}
+
+func (token *EmailChangeToken) SetID(id string) {
+	token.ID = id
+}
+
+// Confirms tells whether the unexpired token confirms the address the user is still waiting for.
+// A later request or an admin setting another email leaves the token without effect.
+func (token EmailChangeToken) Confirms(user User, now time.Time) bool {
+	return token.UserID == user.ID && now.Before(token.ExpiresAt) && token.Email != "" && token.Email == user.PendingEmail
+}
+
 func (user *UserActivationURL) GenerateURL(baseURL string) string {
 	return fmt.Sprintf("%s?hash=%s&group=%s", baseURL, user.Hash, string(user.Group))
 }
+
+func (state OIDCState) GetID() string {
+	return state.ID
+}
+
+func (state *OIDCState) SetID(id string) {
+	state.ID = id
+}
+
+func (key APIKey) GetID() string {
+	return key.ID
+}
+
+func (key *APIKey) SetID(id string) {
+	key.ID = id
+}
+
+func (throttle LoginThrottle) GetID() string {
+	return throttle.ID
+}
+
+func (throttle *LoginThrottle) SetID(id string) {
+	throttle.ID = id
+}
+
+func (invitation Invitation) GetID() string {
+	return invitation.ID
+}
+
+func (invitation *Invitation) SetID(id string) {
+	invitation.ID = id
+}